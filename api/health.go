@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/migrations"
+	"github.com/mohammadrabetian/quick/pkg/health"
+)
+
+// newHealthChecker checks the stores the requests depend on.
+func newHealthChecker(store *Store, timeout time.Duration) *health.Checker {
+	checker := health.NewChecker(timeout)
+	checker.Add("mysql", func(ctx context.Context) error {
+		db, err := store.SQL.DB()
+		if err != nil {
+			return err
+		}
+		return db.PingContext(ctx)
+	})
+	checker.Add("redis", func(ctx context.Context) error {
+		return store.Cache.Ping(ctx).Err()
+	})
+	return checker
+}
+
+// liveness only reports that the process serves requests. It does not check
+// the dependencies, restarting would not bring them back.
+func (s *Server) liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// readiness fails until the server has started, while draining, so load
+// balancers stop routing to this instance, and while a dependency is down.
+func (s *Server) readiness(c *gin.Context) {
+	status, report := s.health(c.Request.Context())
+
+	code := http.StatusOK
+	if status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": report.Checks})
+}
+
+// debugStatus reports the dependencies along with the connection pools, the
+// schema and the runtime, to diagnose an instance.
+func (s *Server) debugStatus(c *gin.Context) {
+	status, report := s.health(c.Request.Context())
+
+	response := gin.H{
+		"status":          status,
+		"checks":          report.Checks,
+		"environment":     s.config.Environment,
+		"started_at":      s.startedAt,
+		"uptime":          time.Since(s.startedAt).Round(time.Second).String(),
+		"go_version":      runtime.Version(),
+		"goroutines":      runtime.NumGoroutine(),
+		"workers_running": s.Store.WorkersRunning(),
+		"schema":          s.schemaStatus(),
+	}
+
+	if db, err := s.Store.SQL.DB(); err == nil {
+		stats := db.Stats()
+		response["mysql_pool"] = gin.H{
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+			"wait_count":       stats.WaitCount,
+			"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+		}
+	}
+
+	stats := s.Store.Cache.PoolStats()
+	response["redis_pool"] = gin.H{
+		"total_connections": stats.TotalConns,
+		"idle":              stats.IdleConns,
+		"stale":             stats.StaleConns,
+		"hits":              stats.Hits,
+		"misses":            stats.Misses,
+		"timeouts":          stats.Timeouts,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// health returns ready, starting, draining or degraded along with the
+// dependency checks, which are skipped while draining.
+func (s *Server) health(ctx context.Context) (string, health.Report) {
+	if !s.ready.Load() {
+		return "draining", health.Report{Checks: map[string]health.Result{}}
+	}
+
+	report := s.checker.Run(ctx)
+	if !report.Healthy {
+		return "degraded", report
+	}
+	if !s.started.Load() {
+		return "starting", report
+	}
+	return "ready", report
+}
+
+// schemaStatus returns the latest applied migration and the number of
+// pending ones.
+func (s *Server) schemaStatus() gin.H {
+	migrator, err := migrations.New(s.Store.SQL, migrations.Settings{DefaultCurrency: s.config.Wallet.DefaultCurrency})
+	if err != nil {
+		return gin.H{"error": err.Error()}
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return gin.H{"error": err.Error()}
+	}
+
+	var version uint64
+	pending, dirty := 0, false
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+			continue
+		}
+		version = status.Version
+		dirty = dirty || status.Dirty
+	}
+	return gin.H{"version": version, "pending": pending, "dirty": dirty}
+}
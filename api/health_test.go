@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status    string  `json:"status"`
+		LatencyMS float64 `json:"latency_ms"`
+		Error     string  `json:"error"`
+	} `json:"checks"`
+	WorkersRunning bool `json:"workers_running"`
+	Schema         struct {
+		Pending int `json:"pending"`
+	} `json:"schema"`
+}
+
+func newHealthTestServer(t *testing.T) (*Server, *miniredis.Miniredis) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	redisServer := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: redisServer.Addr(), MaxRetries: -1})
+
+	store := &Store{SQL: db, Cache: rdb}
+	server := &Server{
+		Store:     store,
+		checker:   newHealthChecker(store, 200*time.Millisecond),
+		startedAt: time.Now(),
+	}
+	server.ready.Store(true)
+	server.MarkStarted()
+
+	// The user of the request is named by a header instead of a token
+	authenticate := func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: c.GetHeader("X-User")})
+	}
+
+	server.router = gin.New()
+	server.router.GET("/livez", server.liveness)
+	server.router.GET("/readyz", server.readiness)
+	server.router.GET("/debug/status", authenticate, middleware.Admin([]string{"Admin"}), server.debugStatus)
+	return server, redisServer
+}
+
+func get(t *testing.T, server *Server, path string) (int, healthResponse) {
+	t.Helper()
+	return getAs(t, server, path, "admin")
+}
+
+func getAs(t *testing.T, server *Server, path, username string) (int, healthResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-User", username)
+	server.router.ServeHTTP(w, req)
+
+	var response healthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	server, _ := newHealthTestServer(t)
+
+	code, response := get(t, server, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response.Status)
+	assert.Equal(t, "up", response.Checks["mysql"].Status)
+	assert.Equal(t, "up", response.Checks["redis"].Status)
+}
+
+func TestReadinessFailsWhileADependencyIsDown(t *testing.T) {
+	server, redisServer := newHealthTestServer(t)
+	redisServer.Close()
+
+	code, response := get(t, server, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "degraded", response.Status)
+	assert.Equal(t, "up", response.Checks["mysql"].Status)
+	assert.Equal(t, "down", response.Checks["redis"].Status)
+	assert.NotEmpty(t, response.Checks["redis"].Error)
+
+	// Liveness does not depend on the stores
+	code, response = get(t, server, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alive", response.Status)
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	server, _ := newHealthTestServer(t)
+	server.ready.Store(false)
+
+	code, response := get(t, server, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", response.Status)
+	assert.Empty(t, response.Checks)
+}
+
+func TestReadinessFailsUntilStarted(t *testing.T) {
+	server, _ := newHealthTestServer(t)
+	server.started.Store(false)
+
+	code, response := get(t, server, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "starting", response.Status)
+	assert.Equal(t, "up", response.Checks["mysql"].Status)
+
+	server.MarkStarted()
+	code, response = get(t, server, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response.Status)
+}
+
+func TestDebugStatus(t *testing.T) {
+	server, _ := newHealthTestServer(t)
+
+	code, response := get(t, server, "/debug/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", response.Status)
+	assert.Len(t, response.Checks, 2)
+	assert.False(t, response.WorkersRunning)
+	// The test database has none of the migrations applied
+	assert.Positive(t, response.Schema.Pending)
+}
+
+func TestDebugStatusIsAdminOnly(t *testing.T) {
+	server, _ := newHealthTestServer(t)
+
+	code, _ := getAs(t, server, "/debug/status", "user1")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// Names are compared in any case, like at sign-in
+	code, _ = getAs(t, server, "/debug/status", "ADMIN")
+	assert.Equal(t, http.StatusOK, code)
+}
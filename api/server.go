@@ -1,38 +1,86 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
 	"github.com/mohammadrabetian/quick/docs"
 	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/metrics"
 	"github.com/mohammadrabetian/quick/middleware"
+	"github.com/mohammadrabetian/quick/pkg/health"
+	"github.com/mohammadrabetian/quick/rpc"
 	"github.com/mohammadrabetian/quick/util"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"google.golang.org/grpc"
 )
 
 type Server struct {
-	Store  *Store
-	config util.Config
-	router *gin.Engine
+	Store      *Store
+	config     util.Config
+	router     *gin.Engine
+	grpcServer *grpc.Server
+
+	// ready is reported by /readyz, it is set while serving and cleared as
+	// soon as draining starts
+	ready atomic.Bool
+	// started is set once the schema was checked, the fixtures were loaded
+	// and the workers run
+	started   atomic.Bool
+	checker   *health.Checker
+	startedAt time.Time
 }
 
-// creates an HTTP server
+// creates an HTTP server, and a gRPC server when grpc_server.address is set
 func NewServer(config util.Config) *Server {
 	store := NewStore(config)
-	server := &Server{config: config, Store: store}
+	server := &Server{
+		config:    config,
+		Store:     store,
+		checker:   newHealthChecker(store, config.Health.Timeout),
+		startedAt: time.Now(),
+	}
 	server.setupRouter()
+	if config.GRPCServer.Address != "" {
+		server.grpcServer = rpc.NewServer(&store.walletSvc, &store.userSvc, server.started.Load, config.GRPCServer.Reflection)
+	}
 	return server
 
 }
 
 func (s *Server) setupRouter() {
 	router := gin.Default()
+	// Continues the trace of a W3C traceparent header, or starts one
+	router.Use(otelgin.Middleware(s.config.Tracing.ServiceName, otelgin.WithFilter(tracedRequest)))
+	router.Use(middleware.Metrics())
+
+	// Probes and metrics are registered before the request logger to keep
+	// them out of the logs
+	router.GET("/livez", s.liveness)
+	router.GET("/readyz", s.readiness)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// The other routes answer 503 until the schema was checked
+	router.Use(s.requireStarted)
 
 	// Auth endpoints
 	versionOne := router.Group("v1/auth")
 	versionOne.POST("/login", handlers.Login)
+	versionOne.POST("/refresh", handlers.Refresh)
+	versionOne.POST("/register", handlers.Register)
+
+	sessionGroup := router.Group("v1/auth")
+	sessionGroup.Use(middleware.Auth(&s.Store.userSvc))
 
 	// Register the request logger middleware
 	router.Use(s.SetupRequestLogger())
@@ -42,6 +90,24 @@ func (s *Server) setupRouter() {
 	// Apply authentication middleware to walletGroup routes
 	walletGroup.Use(middleware.Auth(&s.Store.userSvc))
 
+	transferGroup := router.Group("/api/v1/transfers")
+	transferGroup.Use(middleware.Auth(&s.Store.userSvc))
+
+	transactionGroup := router.Group("/api/v1/transactions")
+	transactionGroup.Use(middleware.Auth(&s.Store.userSvc), middleware.MarkAdmin(s.config.Auth.Admins))
+
+	webhookGroup := router.Group("/api/v1/webhooks")
+	webhookGroup.Use(middleware.Auth(&s.Store.userSvc))
+
+	fxGroup := router.Group("/api/v1/fx")
+	fxGroup.Use(middleware.Auth(&s.Store.userSvc))
+
+	debugGroup := router.Group("/debug")
+	debugGroup.Use(middleware.Auth(&s.Store.userSvc), middleware.Admin(s.config.Auth.Admins))
+
+	// Replays stored responses for retried mutations, must run after Auth
+	idempotency := middleware.Idempotency(s.Store.idempotencyRepo)
+
 	err := router.SetTrustedProxies([]string{"192.168.1.2"})
 	if err != nil {
 		logrus.Fatalf("failed to set trusted proxies")
@@ -58,16 +124,189 @@ func (s *Server) setupRouter() {
 
 	// business logic controllers
 	{
+		sessionGroup.POST("/logout", handlers.Logout)
+		sessionGroup.POST("/logout-all", handlers.LogoutAll)
+		sessionGroup.GET("/sessions", handlers.ListSessions)
+		sessionGroup.DELETE("/sessions/:session_id", handlers.RevokeSession)
+
+		walletGroup.POST("", idempotency, handlers.CreateWallet)
+		walletGroup.GET("", handlers.ListWallets)
 		walletGroup.GET("/:wallet_id/balance", handlers.GetBalance)
-		walletGroup.POST("/:wallet_id/credit", handlers.CreditWallet)
-		walletGroup.POST("/:wallet_id/debit", handlers.DebitWallet)
+		walletGroup.POST("/:wallet_id/credit", idempotency, handlers.CreditWallet)
+		walletGroup.POST("/:wallet_id/debit", idempotency, handlers.DebitWallet)
+		walletGroup.GET("/:wallet_id/transactions", handlers.ListTransactions)
+		walletGroup.POST("/:wallet_id/holds", idempotency, handlers.PlaceHold)
+		walletGroup.POST("/:wallet_id/holds/:hold_id/capture", idempotency, handlers.CaptureHold)
+		walletGroup.POST("/:wallet_id/holds/:hold_id/release", idempotency, handlers.ReleaseHold)
+
+		transferGroup.POST("", idempotency, handlers.Transfer)
+
+		transactionGroup.POST("/:id/reverse", idempotency, handlers.ReverseTransaction)
+
+		webhookGroup.POST("", handlers.CreateWebhook)
+		webhookGroup.GET("", handlers.ListWebhooks)
+		webhookGroup.GET("/:id", handlers.GetWebhook)
+		webhookGroup.PATCH("/:id", handlers.UpdateWebhook)
+		webhookGroup.DELETE("/:id", handlers.DeleteWebhook)
+		webhookGroup.GET("/:id/deliveries", handlers.ListWebhookDeliveries)
+		webhookGroup.POST("/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhook)
+
+		fxGroup.POST("/quotes", handlers.CreateQuote)
+
+		debugGroup.GET("/status", s.debugStatus)
 	}
 
 	s.router = router
 }
 
-func (s *Server) Start(address string) error {
-	return s.router.Run(address)
+// requireStarted answers 503 until MarkStarted was called.
+func (s *Server) requireStarted(c *gin.Context) {
+	if !s.started.Load() {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is starting"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// MarkStarted reports the server ready once it is serving. Until then /readyz
+// reports starting.
+func (s *Server) MarkStarted() {
+	s.started.Store(true)
+}
+
+// Run serves the HTTP API, and the gRPC API when enabled, until ctx is done or
+// a listener fails, then drains: /readyz reports not ready for the drain
+// delay, the listeners stop and in-flight requests get until the shutdown
+// timeout to finish. The workers are stopped and the store closed last.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.HTTPServer.Address)
+	if err != nil {
+		return err
+	}
+
+	var grpcListener net.Listener
+	if s.grpcServer != nil {
+		grpcListener, err = net.Listen("tcp", s.config.GRPCServer.Address)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	return s.serve(ctx, listener, grpcListener)
+}
+
+func (s *Server) serve(ctx context.Context, listener, grpcListener net.Listener) error {
+	config := s.config.HTTPServer
+	httpServer := &http.Server{
+		Handler:           s.router,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+
+	serveErrs := make(chan error, 2)
+	if grpcListener != nil {
+		go func() {
+			if err := s.grpcServer.Serve(grpcListener); err != nil {
+				serveErrs <- fmt.Errorf("grpc server: %w", err)
+			}
+		}()
+		logrus.Infof("Serving gRPC on %s", grpcListener.Addr())
+	}
+	go func() {
+		if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			serveErrs <- fmt.Errorf("http server: %w", err)
+		}
+	}()
+	logrus.Infof("Serving HTTP on %s", listener.Addr())
+	s.ready.Store(true)
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		logrus.Info("Shutting down")
+	case serveErr = <-serveErrs:
+		logrus.WithError(serveErr).Error("Server failed, shutting down")
+	}
+
+	if err := s.shutdown(httpServer); serveErr == nil {
+		serveErr = err
+	}
+	return serveErr
+}
+
+// shutdown drains the servers, then stops the workers and closes the store.
+// Every step runs even when an earlier one timed out.
+func (s *Server) shutdown(httpServer *http.Server) error {
+	config := s.config.HTTPServer
+
+	s.ready.Store(false)
+	if config.DrainDelay > 0 {
+		logrus.Infof("Reporting not ready for %s before draining", config.DrainDelay)
+		time.Sleep(config.DrainDelay)
+	}
+
+	timeout := config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	if s.grpcServer != nil {
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+
+	var shutdownErr error
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Warn("In-flight HTTP requests did not finish in time")
+		httpServer.Close()
+		shutdownErr = err
+	}
+
+	if s.grpcServer != nil {
+		select {
+		case <-grpcStopped:
+		case <-ctx.Done():
+			logrus.Warn("In-flight gRPC calls did not finish in time")
+			s.grpcServer.Stop()
+			<-grpcStopped
+			shutdownErr = ctx.Err()
+		}
+	}
+
+	if err := s.Store.StopWorkers(ctx); err != nil {
+		logrus.WithError(err).Warn("Background workers did not stop in time")
+		shutdownErr = err
+	}
+
+	if err := s.Store.Close(); err != nil {
+		logrus.WithError(err).Error("cannot close the store")
+		if shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	logrus.Info("Shutdown complete")
+	return shutdownErr
+}
+
+// tracedRequest leaves the probes and the metrics scrapes out of the traces.
+func tracedRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/livez", "/readyz", "/metrics":
+		return false
+	default:
+		return true
+	}
 }
 
 func (s *Server) SetupRequestLogger() gin.HandlerFunc {
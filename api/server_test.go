@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestServer returns a server with a slow endpoint that holds requests
+// until release is closed, and a worker that pings Redis once it is stopped.
+func newTestServer(t *testing.T, config util.HTTPServerConfig) (*Server, chan struct{}, chan struct{}, chan error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	store := &Store{SQL: db, Cache: rdb}
+	server := &Server{
+		Store:     store,
+		config:    util.Config{HTTPServer: config},
+		checker:   newHealthChecker(store, time.Second),
+		startedAt: time.Now(),
+	}
+	server.MarkStarted()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.router = gin.New()
+	server.router.GET("/readyz", server.readiness)
+	server.router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	workerStopped := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	server.Store.stopWorkers = cancel
+	server.Store.goWorker(func() {
+		<-ctx.Done()
+		workerStopped <- rdb.Ping(context.Background()).Err()
+	})
+
+	return server, started, release, workerStopped
+}
+
+func serveInBackground(t *testing.T, ctx context.Context, server *Server) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- server.serve(ctx, listener, nil) }()
+
+	url := "http://" + listener.Addr().String()
+	require.Eventually(t, func() bool { return server.ready.Load() }, time.Second, 5*time.Millisecond)
+	return url, done
+}
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServeDrainsBeforeClosingTheStore(t *testing.T) {
+	server, started, release, workerStopped := newTestServer(t, util.HTTPServerConfig{
+		DrainDelay:      200 * time.Millisecond,
+		ShutdownTimeout: 2 * time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, done := serveInBackground(t, ctx, server)
+
+	assert.Equal(t, http.StatusOK, getStatus(t, url+"/readyz"))
+
+	slow := make(chan int, 1)
+	go func() { slow <- getStatus(t, url+"/slow") }()
+	<-started
+
+	cancel()
+
+	// Not ready during the drain delay, while still accepting requests
+	require.Eventually(t, func() bool { return !server.ready.Load() }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, getStatus(t, url+"/readyz"))
+
+	// The in-flight request is allowed to finish
+	close(release)
+	assert.Equal(t, http.StatusOK, <-slow)
+
+	require.NoError(t, <-done)
+	// The store was still open while the worker finished its pass
+	assert.NoError(t, <-workerStopped)
+
+	sqlDB, err := server.Store.SQL.DB()
+	require.NoError(t, err)
+	assert.Error(t, sqlDB.Ping())
+	assert.ErrorIs(t, server.Store.Cache.Ping(context.Background()).Err(), redis.ErrClosed)
+}
+
+func TestServeGivesUpAfterShutdownTimeout(t *testing.T) {
+	server, started, release, _ := newTestServer(t, util.HTTPServerConfig{
+		ShutdownTimeout: 100 * time.Millisecond,
+	})
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := serveInBackground(t, ctx, server)
+
+	go func() {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		if resp, err := client.Get(url + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.ErrorIs(t, server.Store.Cache.Ping(context.Background()).Err(), redis.ErrClosed)
+}
+
+func TestRequestsContinueTheTraceparent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	server := &Server{Store: &Store{}}
+	server.setupRouter()
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/wallets", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Probes are not traced
+	server.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "/api/v1/wallets", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}
+
+func TestRoutesAnswerUnavailableUntilStarted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := &Server{Store: &Store{}}
+	server.setupRouter()
+
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, request("/v1/auth/login"))
+	assert.Equal(t, http.StatusServiceUnavailable, request("/api/v1/wallets/1/credit"))
+
+	// The probes are served while starting
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	server.MarkStarted()
+	assert.Equal(t, http.StatusUnauthorized, request("/api/v1/wallets/1/credit"))
+}
@@ -1,45 +1,285 @@
 package api
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/go-redis/redis/v8"
 	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/metrics"
+	"github.com/mohammadrabetian/quick/outbox"
+	"github.com/mohammadrabetian/quick/pkg/accesstoken"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/pkg/fxrate"
 	"github.com/mohammadrabetian/quick/pkg/mysql"
+	"github.com/mohammadrabetian/quick/pkg/tracing"
+	"github.com/mohammadrabetian/quick/pkg/webhook"
 	"github.com/mohammadrabetian/quick/repository"
 	"github.com/mohammadrabetian/quick/service"
 	"github.com/mohammadrabetian/quick/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"gorm.io/gorm"
 )
 
 // All stores e.g. nosql,sql
 type Store struct {
-	SQL       *gorm.DB
-	Cache     *redis.Client
-	walletSvc service.WalletService
-	userSvc   service.UserService
+	SQL        *gorm.DB
+	Cache      *redis.Client
+	walletSvc  service.WalletService
+	userSvc    service.UserService
+	holdSvc    service.HoldService
+	webhookSvc service.WebhookService
+	adminSvc   service.AdminService
+	relay      *outbox.Relay
+
+	// workersMu guards the start and stop of the workers, which are never
+	// started again once stopped
+	workersMu      sync.Mutex
+	workers        sync.WaitGroup
+	stopWorkers    context.CancelFunc
+	workersStopped bool
+
+	idempotencyRepo repository.IdempotencyRepository
+	config          util.Config
 }
 
 func NewStore(config util.Config) *Store {
 	db := mysql.NewDatabase(config)
+	if err := db.Use(tracing.GormPlugin{DBSystem: semconv.DBSystemMySQL}); err != nil {
+		logrus.Fatalf("cannot trace the mysql queries: %v", err)
+	}
+	if sqlDB, err := db.DB.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB, config.MySQL.DBName); err != nil {
+			logrus.WithError(err).Warn("cannot export the connection pool metrics")
+		}
+	}
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     config.Redis.Host,
 		Password: config.Redis.Password,
 		DB:       config.Redis.DBName,
 	})
+	rdb.AddHook(tracing.RedisHook{})
 
 	// initialize the repo
 	walletRepo := repository.NewWalletMySQLRepository(db.DB, rdb)
 	userRepo := repository.NewUserMySQLRepository(db.DB)
+	transactionRepo := repository.NewTransactionMySQLRepository(db.DB)
+	sessionRepo := repository.NewSessionMySQLRepository(db.DB)
+	refreshTokenRepo := repository.NewRefreshTokenMySQLRepository(db.DB)
+	idempotencyRepo := repository.NewIdempotencyMySQLRepository(db.DB, rdb, config.Idempotency.TTL)
+	fxRepo := repository.NewFXMySQLRepository(db.DB, rdb)
+	holdRepo := repository.NewHoldMySQLRepository(db.DB)
+	outboxRepo := repository.NewOutboxMySQLRepository(db.DB, rdb)
+	webhookRepo := repository.NewWebhookMySQLRepository(db.DB)
+	auditRepo := repository.NewAuditMySQLRepository(db.DB)
+
+	sessionTTL, tokens := authMode(config.Auth)
+
+	defaultCurrency, err := currency.Lookup(config.Wallet.DefaultCurrency)
+	if err != nil {
+		logrus.Fatalf("invalid wallet default_currency %q: %v", config.Wallet.DefaultCurrency, err)
+	}
 
 	// initialize the service and handlers
-	walletSvc := service.NewWalletService(walletRepo)
-	userSvc := service.NewUserService(userRepo)
+	timeouts := service.Timeouts{Read: config.Timeouts.Read, Write: config.Timeouts.Write}
+	books := ledger.New(walletRepo)
+	walletSvc := service.NewWalletService(walletRepo, transactionRepo, fxRepo, outboxRepo, books, defaultCurrency.Code, timeouts)
+	fxSvc := newFXService(fxRepo, config.FX, timeouts)
+	holdSvc := service.NewHoldService(holdRepo, walletRepo, transactionRepo, outboxRepo, books, config.Holds.TTL, timeouts)
+	userSvc := service.NewUserService(userRepo, sessionRepo, refreshTokenRepo, outboxRepo, sessionTTL, tokens, timeouts)
+	webhookSvc := newWebhookService(webhookRepo, walletRepo, config.Webhooks)
+	adminSvc := service.NewAdminService(userSvc, userRepo, walletRepo, transactionRepo, auditRepo, outboxRepo, books, timeouts)
+	relay := outbox.NewRelay(outboxRepo, outbox.Fanout{newEventSink(rdb, config.Outbox), webhookSvc}, config.Outbox.BatchSize, config.Outbox.MaxAttempts)
 	handlers.InitWalletHandlers(walletSvc)
+	handlers.InitTransferHandlers(walletSvc)
+	handlers.InitTransactionHandlers(walletSvc)
+	handlers.InitFXHandlers(fxSvc)
+	handlers.InitHoldHandlers(holdSvc)
+	handlers.InitWebhookHandlers(webhookSvc)
 	handlers.InitUserHandlers(userSvc)
+	handlers.InitSessionHandlers(userSvc)
 
 	return &Store{
-		SQL:       db.DB,
-		Cache:     rdb,
-		walletSvc: *walletSvc,
-		userSvc:   *userSvc,
+		SQL:        db.DB,
+		Cache:      rdb,
+		walletSvc:  *walletSvc,
+		userSvc:    *userSvc,
+		holdSvc:    *holdSvc,
+		webhookSvc: *webhookSvc,
+		adminSvc:   *adminSvc,
+		relay:      relay,
+
+		idempotencyRepo: idempotencyRepo,
+		config:          config,
+	}
+}
+
+// StartWorkers runs the background jobs until ctx is done or StopWorkers is
+// called, after which it does nothing. The database must be migrated before.
+func (s *Store) StartWorkers(ctx context.Context) {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+	if s.workersStopped || s.stopWorkers != nil {
+		return
+	}
+	ctx, s.stopWorkers = context.WithCancel(ctx)
+
+	sweepInterval := s.config.Holds.SweepInterval
+	if sweepInterval <= 0 {
+		sweepInterval = time.Minute
+	}
+	s.goWorker(func() { s.holdSvc.RunSweeper(ctx, sweepInterval) })
+
+	relayInterval := s.config.Outbox.Interval
+	if relayInterval <= 0 {
+		relayInterval = time.Second
+	}
+	s.goWorker(func() { s.relay.Run(ctx, relayInterval) })
+
+	deliveryInterval := s.config.Webhooks.Interval
+	if deliveryInterval <= 0 {
+		deliveryInterval = 5 * time.Second
+	}
+	s.goWorker(func() { s.webhookSvc.RunDeliverer(ctx, deliveryInterval) })
+
+	purgeInterval := s.config.Auth.PurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = time.Hour
+	}
+	s.goWorker(func() { s.userSvc.RunSessionPurger(ctx, purgeInterval) })
+}
+
+func (s *Store) goWorker(run func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		run()
+	}()
+}
+
+// StopWorkers stops the background jobs and waits for the running passes to
+// finish, or until ctx is done.
+func (s *Store) StopWorkers(ctx context.Context) error {
+	s.workersMu.Lock()
+	s.workersStopped = true
+	if s.stopWorkers != nil {
+		s.stopWorkers()
+	}
+	s.workersMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WorkersRunning reports whether the background jobs have been started and
+// not stopped since.
+func (s *Store) WorkersRunning() bool {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+	return s.stopWorkers != nil && !s.workersStopped
+}
+
+// Close closes the database and Redis connections. The workers must be
+// stopped before.
+func (s *Store) Close() error {
+	var closeErr error
+	if s.SQL != nil {
+		db, err := s.SQL.DB()
+		if err == nil {
+			err = db.Close()
+		}
+		closeErr = err
+	}
+	if s.Cache != nil {
+		if err := s.Cache.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// Admin returns the service behind the admin CLI.
+func (s *Store) Admin() *service.AdminService {
+	return &s.adminSvc
+}
+
+// authMode returns the session lifetime and, in jwt mode, the access token
+// manager. A nil manager means opaque session tokens.
+func authMode(config util.AuthConfig) (time.Duration, *accesstoken.Manager) {
+	switch config.Mode {
+	case "", "opaque":
+		return config.SessionTTL, nil
+	case "jwt":
+		tokens, err := accesstoken.NewManager(config.JWT)
+		if err != nil {
+			logrus.Fatalf("invalid jwt configuration: %v", err)
+		}
+		return config.JWT.RefreshTTL, tokens
+	default:
+		logrus.Fatalf("unknown auth mode %q", config.Mode)
+		return 0, nil
 	}
 }
+
+// newFXService builds the FX service with the configured rate provider.
+func newFXService(repo repository.FXRepository, config util.FXConfig, timeouts service.Timeouts) *service.FXService {
+	spread, err := decimal.NewFromString(config.Spread)
+	if err != nil || spread.IsNegative() || spread.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		logrus.Fatalf("invalid fx spread %q, it must be a fraction between 0 and 1", config.Spread)
+	}
+
+	var provider service.RateProvider
+	switch config.Provider {
+	case "", "static":
+		provider, err = fxrate.NewStatic(config.Rates)
+	case "http":
+		provider, err = fxrate.NewHTTP(config.HTTP)
+	default:
+		logrus.Fatalf("unknown fx provider %q", config.Provider)
+	}
+	if err != nil {
+		logrus.Fatalf("invalid fx configuration: %v", err)
+	}
+
+	return service.NewFXService(repo, provider, spread, config.RateTTL, config.QuoteTTL, timeouts)
+}
+
+// newEventSink returns the configured sink of the outbox relay.
+func newEventSink(rdb *redis.Client, config util.OutboxConfig) outbox.Sink {
+	switch config.Sink {
+	case "", "redis":
+		stream := config.Stream
+		if stream == "" {
+			stream = "quick_events"
+		}
+		return outbox.NewRedisStreamSink(rdb, stream, config.MaxLen)
+	default:
+		logrus.Fatalf("unknown outbox sink %q", config.Sink)
+		return nil
+	}
+}
+
+// newWebhookService builds the webhook service with its delivery client.
+func newWebhookService(repo repository.WebhookRepository, walletRepo repository.WalletRepository, config util.WebhooksConfig) *service.WebhookService {
+	client := webhook.NewClient(config.Timeout, config.AllowPrivateURLs)
+	return service.NewWebhookService(repo, walletRepo, client, service.RetryPolicy{
+		MaxAttempts:  config.MaxAttempts,
+		BackoffBase:  config.BackoffBase,
+		BackoffMax:   config.BackoffMax,
+		DisableAfter: config.DisableAfter,
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newLedgerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ledger",
+		Short: "Check the books",
+	}
+	cmd.AddCommand(newLedgerVerifyCommand())
+	return cmd
+}
+
+func newLedgerVerifyCommand() *cobra.Command {
+	var repair bool
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the journal is balanced and wallet balances match their postings",
+		Long: "Check that every journal entry is balanced and that the stored balance of\n" +
+			"every wallet matches the sum of its postings. Exits with an error when\n" +
+			"anything is off. With --repair the stored balances are rebuilt from the\n" +
+			"ledger, which is recorded in the audit log.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			admin := newAdminService()
+			out := cmd.OutOrStdout()
+
+			mismatches, err := admin.VerifyLedger(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if len(mismatches) == 0 {
+				fmt.Fprintln(out, "ledger is balanced, all wallet balances match their postings")
+				return nil
+			}
+			for _, m := range mismatches {
+				fmt.Fprintf(out, "wallet %d: balance %s, ledger %s\n", m.WalletID, m.Balance, m.LedgerBalance)
+			}
+
+			if !repair {
+				return fmt.Errorf("%d wallet balances differ from the ledger, rerun with --repair to rebuild them", len(mismatches))
+			}
+
+			corrected, err := admin.RebuildBalances(cmd.Context(), actor, reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "rebuilt the balance of %d wallets\n", len(corrected))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&repair, "repair", false, "rebuild the stored balances that differ from the ledger")
+	cmd.Flags().StringVar(&reason, "reason", "", "why the balances are rebuilt (required with --repair)")
+	return cmd
+}
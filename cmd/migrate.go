@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mohammadrabetian/quick/migrations"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, revert and inspect the versioned schema migrations",
+	}
+	cmd.AddCommand(newMigrateUpCommand(), newMigrateDownCommand(), newMigrateStatusCommand(), newMigrateForceCommand())
+	return cmd
+}
+
+func newMigrator(ctx context.Context) (*migrations.Migrator, error) {
+	db, err := connectDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrations.New(db, migrationSettings())
+}
+
+func migrationSettings() migrations.Settings {
+	return migrations.Settings{DefaultCurrency: config.Wallet.DefaultCurrency}
+}
+
+func newMigrateUpCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			migrator, err := newMigrator(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			applied, err := migrator.Up(cmd.Context())
+			for _, migration := range applied {
+				fmt.Fprintf(cmd.OutOrStdout(), "applied %d (%s)\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(applied) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "schema is up to date")
+			}
+			return nil
+		},
+	}
+}
+
+func newMigrateDownCommand() *cobra.Command {
+	var steps int
+
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the latest applied migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps < 1 {
+				return fmt.Errorf("--steps must be at least 1")
+			}
+			migrator, err := newMigrator(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			reverted, err := migrator.Down(cmd.Context(), steps)
+			for _, migration := range reverted {
+				fmt.Fprintf(cmd.OutOrStdout(), "reverted %d (%s)\n", migration.Version, migration.Name)
+			}
+			return err
+		},
+	}
+	cmd.Flags().IntVar(&steps, "steps", 1, "number of migrations to revert")
+	return cmd
+}
+
+func newMigrateStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			migrator, err := newMigrator(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			statuses, err := migrator.Status()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+			for _, status := range statuses {
+				applied := "pending"
+				if status.AppliedAt != nil {
+					applied = status.AppliedAt.Format(time.RFC3339)
+				}
+				if status.Dirty {
+					applied = "dirty, failed halfway"
+				} else if status.AppliedAt != nil && status.Up == "" {
+					applied += " (unknown to this release)"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newMigrateForceCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "force <version>",
+		Short: "Record the schema as being at version without running any SQL",
+		Long: "Record the schema as being at version without running any SQL. Migrations\n" +
+			"up to version count as applied and later ones as pending. Use it after\n" +
+			"repairing the schema by hand when a migration failed halfway, or with\n" +
+			"version 0 to forget all applied migrations.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+			migrator, err := newMigrator(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if err := migrator.Force(cmd.Context(), version); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "schema is recorded at version %d\n", version)
+			return nil
+		},
+	}
+}
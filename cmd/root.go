@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mohammadrabetian/quick/api"
+	"github.com/mohammadrabetian/quick/pkg/mysql"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	config util.Config
+	// actor is the operator recorded in the audit log
+	actor string
+)
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "quick",
+		Short:        "Quick wallet service and the tools to operate it",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			config, err = util.LoadConfig(".")
+			if err != nil {
+				return fmt.Errorf("cannot load config: %w", err)
+			}
+			setupLogger(config)
+			return nil
+		},
+		// Without a subcommand the server is started, like before there were any
+		Args: cobra.NoArgs,
+		RunE: runServe,
+	}
+	root.PersistentFlags().StringVar(&actor, "actor", os.Getenv("USER"), "operator recorded in the audit log")
+
+	root.AddCommand(
+		newServeCommand(),
+		newMigrateCommand(),
+		newSeedCommand(),
+		newUserCommand(),
+		newWalletCommand(),
+		newLedgerCommand(),
+	)
+	return root
+}
+
+func setupLogger(config util.Config) {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+
+	// More readable logs for development env
+	if config.Environment == "development" {
+		logrus.SetFormatter(&logrus.TextFormatter{
+			ForceColors:   true,
+			DisableColors: false,
+			FullTimestamp: true,
+		})
+		logrus.SetOutput(os.Stderr)
+	}
+}
+
+// newAdminService connects to the stores and returns the service the admin
+// commands make their changes through.
+func newAdminService() *service.AdminService {
+	return api.NewStore(config).Admin()
+}
+
+// connectDatabase waits up to [mysql] connect_timeout for MySQL, to let
+// commands run while it is still starting.
+func connectDatabase(ctx context.Context) (*gorm.DB, error) {
+	db := mysql.NewDatabase(config)
+
+	timeout := config.MySQL.ConnectTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := mysql.Connect(ctx, db.DB, config.MySQL); err != nil {
+		return nil, err
+	}
+	return db.DB, nil
+}
+
+func parseID(name, arg string) (uint64, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid %s ID %q", name, arg)
+	}
+	return id, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mohammadrabetian/quick/seed"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+func newSeedCommand() *cobra.Command {
+	var fixtures []string
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Load the configured fixtures, only what is missing is added",
+		Long: "Load the users and wallets of the fixtures named by [seed] fixtures, or by\n" +
+			"--fixture. Outside of the development and testing environments this\n" +
+			"requires [seed] enabled = true.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !seed.Allowed(config.Environment, config.Seed.Enabled) {
+				return fmt.Errorf("seeding is disabled in the %s environment, set [seed] enabled to load fixtures", config.Environment)
+			}
+			if len(fixtures) == 0 {
+				fixtures = config.Seed.Fixtures
+			}
+
+			db, err := connectDatabase(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return loadFixtures(db, fixtures)
+		},
+	}
+	cmd.Flags().StringSliceVar(&fixtures, "fixture", nil, "fixture file to load instead of the configured ones, can be repeated")
+	return cmd
+}
+
+// seedDatabase loads the configured fixtures when the environment allows it.
+func seedDatabase(db *gorm.DB) error {
+	if !seed.Allowed(config.Environment, config.Seed.Enabled) {
+		return nil
+	}
+	return loadFixtures(db, config.Seed.Fixtures)
+}
+
+func loadFixtures(db *gorm.DB, paths []string) error {
+	seeder := seed.NewSeeder(db, config.Wallet.DefaultCurrency)
+	for _, path := range paths {
+		fixtures, err := seed.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		result, err := seeder.Apply(fixtures)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", path, err)
+		}
+		logrus.WithFields(logrus.Fields{
+			"fixture":         path,
+			"users_created":   result.UsersCreated,
+			"users_updated":   result.UsersUpdated,
+			"wallets_created": result.WalletsCreated,
+		}).Info("Fixtures loaded")
+	}
+	return nil
+}
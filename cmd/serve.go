@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mohammadrabetian/quick/api"
+	"github.com/mohammadrabetian/quick/migrations"
+	"github.com/mohammadrabetian/quick/pkg/mysql"
+	"github.com/mohammadrabetian/quick/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the APIs and the background workers, the schema must be migrated",
+		Args:  cobra.NoArgs,
+		RunE:  runServe,
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	shutdownTracing, err := tracing.Setup(config.Tracing, config.Environment)
+	if err != nil {
+		return fmt.Errorf("cannot set up tracing: %w", err)
+	}
+	defer func() {
+		// Flushes the spans of the drained requests
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.WithError(err).Warn("cannot flush the traces")
+		}
+	}()
+
+	server := api.NewServer(config)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal kills the process instead of waiting for the drain
+		<-ctx.Done()
+		stop()
+	}()
+
+	// The probes are served right away, the APIs answer 503 until start
+	// checked the schema
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	served := make(chan error, 1)
+	go func() { served <- server.Run(runCtx) }()
+
+	if err := start(ctx, cmd, server); err != nil {
+		cancelRun()
+		<-served
+		return err
+	}
+
+	if err := <-served; err != nil {
+		return fmt.Errorf("cannot run server: %w", err)
+	}
+	return nil
+}
+
+// start waits for MySQL, checks the schema, loads the fixtures and starts the
+// workers.
+func start(ctx context.Context, cmd *cobra.Command, server *api.Server) error {
+	if err := mysql.Connect(ctx, server.Store.SQL, config.MySQL); err != nil {
+		if ctx.Err() != nil {
+			return nil // stopped before MySQL was reachable
+		}
+		return err
+	}
+
+	migrator, err := migrations.New(server.Store.SQL, migrationSettings())
+	if err != nil {
+		return err
+	}
+	if err := migrator.CheckCurrent(); errors.Is(err, migrations.ErrSchemaBehind) {
+		return fmt.Errorf("refusing to start: %w, run quick migrate up", err)
+	} else if err != nil {
+		return fmt.Errorf("refusing to start: %w", err)
+	}
+
+	if err := seedDatabase(server.Store.SQL); err != nil {
+		return fmt.Errorf("cannot seed the database: %w", err)
+	}
+
+	// Workers outlive the signal, the server stops them once the APIs drained
+	server.Store.StartWorkers(cmd.Context())
+	server.MarkStarted()
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newUserCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users",
+	}
+	cmd.AddCommand(newUserCreateCommand(), newUserListCommand(), newUserDisableCommand(), newUserEnableCommand())
+	return cmd
+}
+
+func newUserCreateCommand() *cobra.Command {
+	var plaintext string
+
+	cmd := &cobra.Command{
+		Use:   "create <username>",
+		Short: "Create a user, the password is read from stdin unless --password is given",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if plaintext == "" {
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && line == "" {
+					return fmt.Errorf("cannot read the password from stdin: %w", err)
+				}
+				plaintext = strings.TrimRight(line, "\r\n")
+			}
+
+			user, err := newAdminService().CreateUser(cmd.Context(), actor, args[0], plaintext)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "created user %d (%s)\n", user.ID, user.Username)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&plaintext, "password", "", "password of the new user, visible in the shell history")
+	return cmd
+}
+
+func newUserListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List all users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			users, err := newAdminService().ListUsers(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tCREATED\tDISABLED")
+			for _, user := range users {
+				disabled := "-"
+				if user.Disabled() {
+					disabled = user.DisabledAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.CreatedAt.Format(time.RFC3339), disabled)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newUserDisableCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "disable <user-id>",
+		Short: "Stop a user from signing in and revoke their sessions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userID, err := parseID("user", args[0])
+			if err != nil {
+				return err
+			}
+
+			user, err := newAdminService().DisableUser(cmd.Context(), actor, userID, reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "disabled user %d (%s)\n", user.ID, user.Username)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "why the user is disabled (required)")
+	return cmd
+}
+
+func newUserEnableCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "enable <user-id>",
+		Short: "Let a disabled user sign in again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userID, err := parseID("user", args[0])
+			if err != nil {
+				return err
+			}
+
+			user, err := newAdminService().EnableUser(cmd.Context(), actor, userID, reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "enabled user %d (%s)\n", user.ID, user.Username)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "why the user is enabled again (required)")
+	return cmd
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+)
+
+func newWalletCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wallet",
+		Short: "Inspect and correct wallets",
+	}
+	cmd.AddCommand(newWalletShowCommand(), newWalletAdjustCommand(), newWalletFreezeCommand(), newWalletUnfreezeCommand())
+	return cmd
+}
+
+func newWalletShowCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "show <wallet-id>",
+		Short: "Show a wallet with its latest transactions and audit log",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			walletID, err := parseID("wallet", args[0])
+			if err != nil {
+				return err
+			}
+
+			details, err := newAdminService().GetWallet(cmd.Context(), walletID, limit)
+			if err != nil {
+				return err
+			}
+			wallet := details.Wallet
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Wallet\t%d\n", wallet.ID)
+			fmt.Fprintf(w, "Owner\t%d\n", wallet.OwnerID)
+			fmt.Fprintf(w, "Currency\t%s\n", wallet.Currency)
+			fmt.Fprintf(w, "Balance\t%s\n", wallet.Balance)
+			fmt.Fprintf(w, "Held\t%s\n", wallet.HeldBalance)
+			ledgerBalance := details.LedgerBalance.String()
+			if !details.LedgerBalance.Equal(wallet.Balance) {
+				ledgerBalance += " (differs, see quick ledger verify)"
+			}
+			fmt.Fprintf(w, "Ledger balance\t%s\n", ledgerBalance)
+			if wallet.Frozen() {
+				fmt.Fprintf(w, "Frozen\t%s\n", wallet.FrozenAt.Format(time.RFC3339))
+			}
+
+			fmt.Fprintln(w, "\nID\tTYPE\tAMOUNT\tBALANCE AFTER\tREFERENCE\tCREATED")
+			for _, t := range details.Transactions {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Type, t.Amount, t.BalanceAfter, t.Reference, t.CreatedAt.Format(time.RFC3339))
+			}
+
+			fmt.Fprintln(w, "\nAUDITED\tACTOR\tACTION\tREASON")
+			for _, e := range details.AuditEntries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.CreatedAt.Format(time.RFC3339), e.Actor, e.Action, e.Reason)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 10, "number of transactions and audit entries to show")
+	return cmd
+}
+
+func newWalletAdjustCommand() *cobra.Command {
+	var amount, reason string
+
+	cmd := &cobra.Command{
+		Use:   "adjust <wallet-id>",
+		Short: "Correct a wallet's balance, booked in the ledger and the audit log",
+		Example: "  quick wallet adjust 42 --amount 12.50 --reason \"refund of ticket 981\"\n" +
+			"  quick wallet adjust 42 --amount=-3 --reason \"duplicate credit\"",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			walletID, err := parseID("wallet", args[0])
+			if err != nil {
+				return err
+			}
+			delta, err := decimal.NewFromString(amount)
+			if err != nil {
+				return fmt.Errorf("invalid amount %q", amount)
+			}
+
+			transaction, err := newAdminService().AdjustBalance(cmd.Context(), actor, walletID, delta, reason)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "adjusted wallet %d by %s, balance is now %s (transaction %d, %s)\n",
+				walletID, delta, transaction.BalanceAfter, transaction.ID, transaction.Reference)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&amount, "amount", "", "amount to add, negative to take money out (required)")
+	cmd.Flags().StringVar(&reason, "reason", "", "why the balance is corrected (required)")
+	cmd.MarkFlagRequired("amount")
+	return cmd
+}
+
+func newWalletFreezeCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "freeze <wallet-id>",
+		Short: "Stop all money movements of a wallet",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			walletID, err := parseID("wallet", args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := newAdminService().FreezeWallet(cmd.Context(), actor, walletID, reason); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "froze wallet %d\n", walletID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "why the wallet is frozen (required)")
+	return cmd
+}
+
+func newWalletUnfreezeCommand() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "unfreeze <wallet-id>",
+		Short: "Allow money movements of a frozen wallet again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			walletID, err := parseID("wallet", args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := newAdminService().UnfreezeWallet(cmd.Context(), actor, walletID, reason); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "unfroze wallet %d\n", walletID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "why the wallet is unfrozen (required)")
+	return cmd
+}
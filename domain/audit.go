@@ -0,0 +1,31 @@
+package domain
+
+import "gorm.io/gorm"
+
+const (
+	AuditUserCreated     = "user.created"
+	AuditUserDisabled    = "user.disabled"
+	AuditUserEnabled     = "user.enabled"
+	AuditWalletAdjusted  = "wallet.adjusted"
+	AuditWalletFrozen    = "wallet.frozen"
+	AuditWalletUnfrozen  = "wallet.unfrozen"
+	AuditBalancesRebuilt = "ledger.balances_rebuilt"
+
+	AuditTargetUser   = "user"
+	AuditTargetWallet = "wallet"
+	AuditTargetLedger = "ledger"
+)
+
+// AuditEntry records a change an operator made outside of the API. Entries
+// are only ever added.
+type AuditEntry struct {
+	gorm.Model
+	ID uint64 `gorm:"primaryKey"`
+	// Actor is the operator, e.g. their login on the machine running the CLI
+	Actor      string `gorm:"type:varchar(64);not null"`
+	Action     string `gorm:"type:varchar(64);index;not null"`
+	TargetType string `gorm:"type:varchar(32);index:idx_audit_target;not null"`
+	TargetID   uint64 `gorm:"index:idx_audit_target;not null"`
+	Reason     string `gorm:"type:varchar(255);not null"`
+	Details    string `gorm:"type:text"` // JSON
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// FXQuote fixes the rate at which a user may convert Amount of FromCurrency
+// into ConvertedAmount of ToCurrency. It can be used for one transfer before
+// ExpiresAt.
+type FXQuote struct {
+	gorm.Model
+	ID              uint64          `gorm:"primaryKey"`
+	UserID          uint64          `gorm:"index;not null"`
+	FromCurrency    string          `gorm:"type:char(3);not null"`
+	ToCurrency      string          `gorm:"type:char(3);not null"`
+	Amount          decimal.Decimal `gorm:"type:decimal(64,8);not null"`
+	ConvertedAmount decimal.Decimal `gorm:"type:decimal(64,8);not null"`
+	// Rate is the provider's rate, AppliedRate what is left of it after the spread
+	Rate        decimal.Decimal `gorm:"type:decimal(32,12);not null"`
+	Spread      decimal.Decimal `gorm:"type:decimal(10,6);not null"`
+	AppliedRate decimal.Decimal `gorm:"type:decimal(32,12);not null"`
+	ExpiresAt   time.Time       `gorm:"not null"`
+	UsedAt      *time.Time
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type HoldStatus string
+
+const (
+	HoldStatusActive   HoldStatus = "active"
+	HoldStatusCaptured HoldStatus = "captured"
+	HoldStatusReleased HoldStatus = "released"
+	HoldStatusExpired  HoldStatus = "expired"
+)
+
+// Hold reserves Amount of a wallet's balance, e.g. for a checkout whose final
+// amount is not known yet. While it is active the amount counts towards the
+// wallet's HeldBalance, until it is captured, released or expires.
+type Hold struct {
+	gorm.Model
+	ID             uint64          `gorm:"primaryKey"`
+	WalletID       uint64          `gorm:"index;not null"`
+	Amount         decimal.Decimal `gorm:"type:decimal(64,8);not null"`
+	CapturedAmount decimal.Decimal `gorm:"type:decimal(64,8);not null;default:0"`
+	Status         HoldStatus      `gorm:"type:varchar(16);index:idx_holds_status_expires_at;not null"`
+	ExpiresAt      time.Time       `gorm:"index:idx_holds_status_expires_at;not null"`
+	ActorID        uint64          `gorm:"not null"`
+	Reference      string          `gorm:"type:varchar(255);index"`
+}
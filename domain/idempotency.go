@@ -0,0 +1,17 @@
+package domain
+
+import "gorm.io/gorm"
+
+// IdempotencyRecord keeps the first response given to a request carrying an
+// Idempotency-Key, so that retries of the same request can be answered with it.
+// It is created before the request runs; StatusCode stays 0 until the response
+// is stored, and for good when it could not be.
+type IdempotencyRecord struct {
+	gorm.Model
+	ID             uint64 `gorm:"primaryKey"`
+	UserID         uint64 `gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	IdempotencyKey string `gorm:"type:varchar(255);uniqueIndex:idx_idempotency_user_key;not null"`
+	RequestHash    string `gorm:"type:char(64);not null"`
+	StatusCode     int    `gorm:"not null"`
+	ResponseBody   []byte `gorm:"type:blob"`
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventWalletCredited    = "wallet.credited"
+	EventWalletDebited     = "wallet.debited"
+	EventTransferCompleted = "transfer.completed"
+	EventUserLoggedIn      = "user.logged_in"
+)
+
+// OutboxEvent is a domain event waiting to be published. It is written in the
+// same database transaction as the change it describes, so it exists if and
+// only if the change was committed.
+type OutboxEvent struct {
+	gorm.Model
+	ID   uint64 `gorm:"primaryKey"`
+	Type string `gorm:"type:varchar(64);not null"`
+	// PartitionKey, e.g. wallet:12, orders the events. Events of the same key
+	// are published in the order they were written.
+	PartitionKey string     `gorm:"type:varchar(64);not null"`
+	Payload      string     `gorm:"type:text;not null"` // JSON
+	Attempts     int        `gorm:"not null;default:0"`
+	LastError    string     `gorm:"type:varchar(255)"`
+	PublishedAt  *time.Time `gorm:"index"`
+	// DeadLetteredAt is set once the event failed too often to be retried
+	DeadLetteredAt *time.Time
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken belongs to a session and can be exchanged exactly once for a
+// new access token and a new refresh token. Presenting a used token again
+// means it leaked, and revokes the whole session.
+type RefreshToken struct {
+	gorm.Model
+	ID        uint64    `gorm:"primaryKey"`
+	SessionID uint64    `gorm:"index;not null"`
+	TokenHash string    `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a signed-in device of a user. Only the SHA-256 hash of the
+// bearer token is stored, so a database leak does not leak usable tokens.
+type Session struct {
+	gorm.Model
+	ID         uint64    `gorm:"primaryKey"`
+	UserID     uint64    `gorm:"index;not null"`
+	TokenHash  string    `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt  time.Time `gorm:"index;not null"`
+	LastUsedAt time.Time
+	UserAgent  string `gorm:"type:varchar(512)"`
+	IP         string `gorm:"type:varchar(45)"`
+}
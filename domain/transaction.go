@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type TransactionType string
+
+const (
+	TransactionTypeCredit TransactionType = "credit"
+	TransactionTypeDebit  TransactionType = "debit"
+)
+
+// TransactionOrigin is the operation which booked a transaction.
+type TransactionOrigin string
+
+const (
+	TransactionOriginCredit     TransactionOrigin = "credit"
+	TransactionOriginDebit      TransactionOrigin = "debit"
+	TransactionOriginCapture    TransactionOrigin = "capture"
+	TransactionOriginTransfer   TransactionOrigin = "transfer"
+	TransactionOriginAdjustment TransactionOrigin = "adjustment"
+	TransactionOriginReversal   TransactionOrigin = "reversal"
+)
+
+// Transaction records a single balance change of a wallet.
+type Transaction struct {
+	gorm.Model
+	ID       uint64          `gorm:"primaryKey"`
+	WalletID uint64          `gorm:"index;not null"`
+	Type     TransactionType `gorm:"type:varchar(16);index;not null"`
+	// Origin is empty on transactions booked before it was recorded
+	Origin       TransactionOrigin `gorm:"type:varchar(16);not null;default:''"`
+	Amount       decimal.Decimal   `gorm:"type:decimal(64,8);not null"`
+	BalanceAfter decimal.Decimal   `gorm:"type:decimal(64,8);not null"`
+	// ActorID is the user who made the change, 0 for manual adjustments
+	ActorID   uint64 `gorm:"index;not null"`
+	Reference string `gorm:"type:varchar(255);index"`
+	// QuoteID is set on both legs of a transfer between currencies
+	QuoteID *uint64 `gorm:"index"`
+	// ReversalOfID is set on a reversal and points to the transaction it
+	// compensates
+	ReversalOfID *uint64 `gorm:"index"`
+	// ReversedAmount is how much of the transaction has been reversed so far
+	ReversedAmount decimal.Decimal `gorm:"type:decimal(64,8);not null;default:0"`
+}
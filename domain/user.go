@@ -1,11 +1,28 @@
 package domain
 
-import "gorm.io/gorm"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	ID       uint64 `gorm:"primaryKey"`
 	Username string `gorm:"type:varchar(255);unique;not null" json:"username"`
 	Password string `gorm:"type:varchar(255);not null"`
-	Token    string `gorm:"type:varchar(255);unique;not null" json:"token"`
+	// DisabledAt is set when an operator disabled the user, who can no longer
+	// sign in
+	DisabledAt *time.Time
+}
+
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// NormalizeUsername returns username the way it is stored: usernames are
+// case-insensitive and stored in lowercase.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
 }
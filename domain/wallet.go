@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"time"
+
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
@@ -9,5 +11,22 @@ type Wallet struct {
 	gorm.Model
 	ID      uint64          `gorm:"primaryKey"`
 	Balance decimal.Decimal `gorm:"type:decimal(64,8)"`
-	UserID  string          `gorm:"index"`
+	// Sum of the active holds. Only Balance - HeldBalance can be spent.
+	HeldBalance decimal.Decimal `gorm:"type:decimal(64,8);not null;default:0"`
+	// ISO 4217 code, e.g. EUR. It is set when the wallet is created and never changes.
+	Currency string `gorm:"type:char(3);not null"`
+	OwnerID  uint64 `gorm:"index;not null"`
+	Owner    *User  `gorm:"foreignKey:OwnerID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-"`
+	// FrozenAt is set while an operator has frozen the wallet. No money moves
+	// in or out of a frozen wallet, except through manual adjustments.
+	FrozenAt *time.Time
+}
+
+func (w *Wallet) Frozen() bool {
+	return w.FrozenAt != nil
+}
+
+// AvailableBalance is what can be spent, i.e. the balance minus active holds.
+func (w *Wallet) AvailableBalance() decimal.Decimal {
+	return w.Balance.Sub(w.HeldBalance)
 }
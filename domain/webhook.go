@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookSubscription is a user's endpoint that receives the events of their
+// wallets.
+type WebhookSubscription struct {
+	gorm.Model
+	ID     uint64 `gorm:"primaryKey"`
+	UserID uint64 `gorm:"index;not null"`
+	URL    string `gorm:"type:varchar(2048);not null"`
+	// Secret signs the deliveries, so it has to be kept in the clear
+	Secret string `gorm:"type:varchar(128);not null"`
+	// EventTypes is a comma separated list, e.g. wallet.credited,wallet.debited
+	EventTypes string `gorm:"type:varchar(255);not null"`
+	Active     bool   `gorm:"not null;default:true"`
+	// ConsecutiveFailures counts failed attempts since the last successful one
+	ConsecutiveFailures int `gorm:"not null;default:0"`
+	DisabledAt          *time.Time
+}
+
+func (s *WebhookSubscription) Events() []string {
+	return strings.Split(s.EventTypes, ",")
+}
+
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range s.Events() {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one subscription, and the outcome of
+// its latest attempt.
+type WebhookDelivery struct {
+	gorm.Model
+	ID             uint64                `gorm:"primaryKey"`
+	SubscriptionID uint64                `gorm:"uniqueIndex:idx_webhook_delivery_event;not null"`
+	Subscription   *WebhookSubscription  `gorm:"foreignKey:SubscriptionID" json:"-"`
+	EventID        uint64                `gorm:"uniqueIndex:idx_webhook_delivery_event;not null"`
+	EventType      string                `gorm:"type:varchar(64);not null"`
+	Body           string                `gorm:"type:text;not null"` // JSON
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(16);not null;index:idx_webhook_delivery_due,priority:1"`
+	Attempts       int                   `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time             `gorm:"index:idx_webhook_delivery_due,priority:2"`
+	LastStatusCode int
+	LastError      string `gorm:"type:varchar(255)"`
+	DeliveredAt    *time.Time
+}
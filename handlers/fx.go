@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/pkg/fxrate"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var fxSvc FXService
+
+type FXService interface {
+	CreateQuote(ctx context.Context, userID uint64, fromCode, toCode string, amount decimal.Decimal) (*domain.FXQuote, error)
+}
+
+func InitFXHandlers(fxService FXService) {
+	fxSvc = fxService
+}
+
+type quoteReqBody struct {
+	FromCurrency string `json:"from_currency"`
+	ToCurrency   string `json:"to_currency"`
+	Amount       string `json:"amount"`
+}
+
+type quoteResponse struct {
+	ID              uint64          `json:"id"`
+	FromCurrency    string          `json:"from_currency"`
+	ToCurrency      string          `json:"to_currency"`
+	Amount          decimal.Decimal `json:"amount"`
+	ConvertedAmount decimal.Decimal `json:"converted_amount"`
+	Rate            decimal.Decimal `json:"rate"`
+	Spread          decimal.Decimal `json:"spread"`
+	AppliedRate     decimal.Decimal `json:"applied_rate"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+}
+
+//	@Summary		Create FX Quote API
+//	@Description	Price a currency conversion. Transfers between wallets of different currencies must reference an unexpired quote.
+//	@Tags			fx
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_	body		quoteReqBody	false	"currencies to convert between and the amount to convert"
+//
+//	@Success		201	{object}	string
+//	@Failure		400	{string}	httputil.HTTPError
+//	@Failure		422	{string}	httputil.HTTPError
+//	@Router			/api/v1/fx/quotes [post]
+//	@Security		ApiKeyAuth
+func CreateQuote(c *gin.Context) {
+	req := quoteReqBody{}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or non-positive amount"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	quote, err := fxSvc.CreateQuote(c.Request.Context(), user.ID, req.FromCurrency, req.ToCurrency, amount)
+	if err != nil {
+		logrus.Errorf("error in creating a quote, err: %s", err)
+		if errors.Is(err, currency.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or unsupported currency"})
+		} else if errors.Is(err, service.ErrSameCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot convert a currency into itself"})
+		} else if errors.Is(err, service.ErrAmountPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the currency allows"})
+		} else if errors.Is(err, service.ErrAmountTooSmall) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount is too small to be converted"})
+		} else if errors.Is(err, fxrate.ErrRateUnavailable) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No exchange rate available for the currency pair"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create quote"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, quoteResponse{
+		ID:              quote.ID,
+		FromCurrency:    quote.FromCurrency,
+		ToCurrency:      quote.ToCurrency,
+		Amount:          quote.Amount,
+		ConvertedAmount: quote.ConvertedAmount,
+		Rate:            quote.Rate,
+		Spread:          quote.Spread,
+		AppliedRate:     quote.AppliedRate,
+		ExpiresAt:       quote.ExpiresAt,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/pkg/fxrate"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockFXService struct {
+	mock.Mock
+}
+
+func (m *MockFXService) CreateQuote(ctx context.Context, userID uint64, fromCode, toCode string, amount decimal.Decimal) (*domain.FXQuote, error) {
+	args := m.Called(userID, fromCode, toCode, amount)
+	quote, _ := args.Get(0).(*domain.FXQuote)
+	return quote, args.Error(1)
+}
+
+func newFXRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: "user1"})
+		c.Next()
+	})
+	r.POST("/fx/quotes", handlers.CreateQuote)
+	return r
+}
+
+func TestCreateQuote(t *testing.T) {
+	mockFXSvc := new(MockFXService)
+	handlers.InitFXHandlers(mockFXSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		quote := &domain.FXQuote{
+			ID:              5,
+			FromCurrency:    "EUR",
+			ToCurrency:      "JPY",
+			Amount:          decimal.NewFromInt(10),
+			ConvertedAmount: decimal.NewFromInt(1584),
+			Rate:            decimal.NewFromInt(160),
+			Spread:          decimal.RequireFromString("0.01"),
+			AppliedRate:     decimal.RequireFromString("158.4"),
+			ExpiresAt:       time.Date(2023, 4, 1, 12, 0, 30, 0, time.UTC),
+		}
+		mockFXSvc.On("CreateQuote", uint64(1), "EUR", "JPY", decimal.NewFromInt(10)).Return(quote, nil).Once()
+
+		w := httptest.NewRecorder()
+		reqBody := `{"from_currency": "EUR", "to_currency": "JPY", "amount": "10"}`
+		req, _ := http.NewRequest("POST", "/fx/quotes", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		newFXRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{
+			"id": 5,
+			"from_currency": "EUR",
+			"to_currency": "JPY",
+			"amount": "10",
+			"converted_amount": "1584",
+			"rate": "160",
+			"spread": "0.01",
+			"applied_rate": "158.4",
+			"expires_at": "2023-04-01T12:00:30Z"
+		}`, w.Body.String())
+		mockFXSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		reqBody := `{"from_currency": "EUR", "to_currency": "JPY", "amount": "0"}`
+		req, _ := http.NewRequest("POST", "/fx/quotes", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		newFXRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	errorCases := []struct {
+		name    string
+		err     error
+		code    int
+		message string
+	}{
+		{"unknown currency", currency.ErrUnknownCurrency, http.StatusBadRequest, "Unknown or unsupported currency"},
+		{"same currency", service.ErrSameCurrency, http.StatusBadRequest, "Cannot convert a currency into itself"},
+		{"amount too small", service.ErrAmountTooSmall, http.StatusBadRequest, "Amount is too small to be converted"},
+		{"no rate", fxrate.ErrRateUnavailable, http.StatusUnprocessableEntity, "No exchange rate available for the currency pair"},
+		{"provider down", errors.New("connection refused"), http.StatusInternalServerError, "Unable to create quote"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockFXSvc.On("CreateQuote", uint64(1), "EUR", "JPY", decimal.NewFromInt(10)).Return(nil, tc.err).Once()
+
+			w := httptest.NewRecorder()
+			reqBody := `{"from_currency": "EUR", "to_currency": "JPY", "amount": "10"}`
+			req, _ := http.NewRequest("POST", "/fx/quotes", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			newFXRouter().ServeHTTP(w, req)
+
+			var response map[string]string
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.code, w.Code)
+			assert.Equal(t, tc.message, response["error"])
+		})
+	}
+}
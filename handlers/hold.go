@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var holdSvc HoldService
+
+type HoldService interface {
+	PlaceHold(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error)
+	CaptureHold(ctx context.Context, walletID, holdID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error)
+	ReleaseHold(ctx context.Context, walletID, holdID, userID uint64) (*domain.Hold, error)
+}
+
+func InitHoldHandlers(holdService HoldService) {
+	holdSvc = holdService
+}
+
+type holdReqBody struct {
+	Amount string `json:"amount"`
+}
+
+type holdResponse struct {
+	ID             uint64            `json:"id"`
+	WalletID       uint64            `json:"wallet_id"`
+	Amount         decimal.Decimal   `json:"amount"`
+	CapturedAmount decimal.Decimal   `json:"captured_amount"`
+	Status         domain.HoldStatus `json:"status"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+}
+
+func newHoldResponse(h *domain.Hold) holdResponse {
+	return holdResponse{
+		ID:             h.ID,
+		WalletID:       h.WalletID,
+		Amount:         h.Amount,
+		CapturedAmount: h.CapturedAmount,
+		Status:         h.Status,
+		ExpiresAt:      h.ExpiresAt,
+	}
+}
+
+//	@Summary		Place Hold API
+//	@Description	Reserve an amount of the wallet. It lowers the available balance, but not the balance.
+//	@Tags			hold
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			wallet_id		path		string		true	"wallet id to place the hold on"
+//	@Param			_				body		holdReqBody	false	"amount to reserve"
+//	@Param			Idempotency-Key	header		string		false	"unique key to safely retry the request"
+//
+//	@Success		201				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
+//	@Failure		402				{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets/{wallet_id}/holds [post]
+//	@Security		ApiKeyAuth
+func PlaceHold(c *gin.Context) {
+	walletID, err := strconv.ParseUint(c.Param("wallet_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+		return
+	}
+
+	req := holdReqBody{}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or non-positive amount"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	hold, err := holdSvc.PlaceHold(c.Request.Context(), walletID, amount, user.ID)
+	if err != nil {
+		logrus.Errorf("error in placing a hold, err: %s", err)
+		respondHoldError(c, err, "Error in placing the hold")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newHoldResponse(hold))
+}
+
+//	@Summary		Capture Hold API
+//	@Description	Debit the wallet by the held amount, or by a smaller amount, and free the rest of the hold
+//	@Tags			hold
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			wallet_id		path		string		true	"wallet id of the hold"
+//	@Param			hold_id			path		string		true	"hold id to capture"
+//	@Param			_				body		holdReqBody	false	"amount to capture, the whole hold if left out"
+//	@Param			Idempotency-Key	header		string		false	"unique key to safely retry the request"
+//
+//	@Success		200				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
+//	@Failure		409				{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets/{wallet_id}/holds/{hold_id}/capture [post]
+//	@Security		ApiKeyAuth
+func CaptureHold(c *gin.Context) {
+	walletID, holdID, ok := holdParams(c)
+	if !ok {
+		return
+	}
+
+	req := holdReqBody{}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	amount := decimal.Zero
+	if req.Amount != "" {
+		var err error
+		amount, err = decimal.NewFromString(req.Amount)
+		if err != nil || amount.Sign() <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or non-positive amount"})
+			return
+		}
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	hold, err := holdSvc.CaptureHold(c.Request.Context(), walletID, holdID, amount, user.ID)
+	if err != nil {
+		logrus.Errorf("error in capturing the hold, err: %s", err)
+		respondHoldError(c, err, "Error in capturing the hold")
+		return
+	}
+
+	c.JSON(http.StatusOK, newHoldResponse(hold))
+}
+
+//	@Summary		Release Hold API
+//	@Description	Free the held amount without debiting the wallet
+//	@Tags			hold
+//	@Produce		json
+//
+//	@Param			wallet_id		path		string	true	"wallet id of the hold"
+//	@Param			hold_id			path		string	true	"hold id to release"
+//	@Param			Idempotency-Key	header		string	false	"unique key to safely retry the request"
+//
+//	@Success		200				{object}	string
+//	@Failure		404				{string}	httputil.HTTPError
+//	@Failure		409				{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets/{wallet_id}/holds/{hold_id}/release [post]
+//	@Security		ApiKeyAuth
+func ReleaseHold(c *gin.Context) {
+	walletID, holdID, ok := holdParams(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	hold, err := holdSvc.ReleaseHold(c.Request.Context(), walletID, holdID, user.ID)
+	if err != nil {
+		logrus.Errorf("error in releasing the hold, err: %s", err)
+		respondHoldError(c, err, "Error in releasing the hold")
+		return
+	}
+
+	c.JSON(http.StatusOK, newHoldResponse(hold))
+}
+
+func holdParams(c *gin.Context) (walletID, holdID uint64, ok bool) {
+	walletID, err := strconv.ParseUint(c.Param("wallet_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+		return 0, 0, false
+	}
+
+	holdID, err = strconv.ParseUint(c.Param("hold_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return 0, 0, false
+	}
+	return walletID, holdID, true
+}
+
+func respondHoldError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, repository.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+	} else if errors.Is(err, repository.ErrHoldNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+	} else if errors.Is(err, service.ErrAccessDenied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
+	} else if errors.Is(err, service.ErrAmountPrecision) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the wallet's currency allows"})
+	} else if errors.Is(err, service.ErrCaptureExceedsHold) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot capture more than the held amount"})
+	} else if errors.Is(err, repository.ErrInsufficientFunds) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient available balance"})
+	} else if errors.Is(err, repository.ErrWalletFrozen) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Wallet is frozen"})
+	} else if errors.Is(err, service.ErrHoldExpired) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Hold has expired"})
+	} else if errors.Is(err, service.ErrHoldNotActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Hold has already been captured, released or has expired"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
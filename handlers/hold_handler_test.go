@@ -0,0 +1,211 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockHoldService struct {
+	mock.Mock
+}
+
+func (m *MockHoldService) PlaceHold(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error) {
+	args := m.Called(walletID, amount, userID)
+	hold, _ := args.Get(0).(*domain.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockHoldService) CaptureHold(ctx context.Context, walletID, holdID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error) {
+	args := m.Called(walletID, holdID, amount, userID)
+	hold, _ := args.Get(0).(*domain.Hold)
+	return hold, args.Error(1)
+}
+
+func (m *MockHoldService) ReleaseHold(ctx context.Context, walletID, holdID, userID uint64) (*domain.Hold, error) {
+	args := m.Called(walletID, holdID, userID)
+	hold, _ := args.Get(0).(*domain.Hold)
+	return hold, args.Error(1)
+}
+
+func newHoldRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: "user1"})
+		c.Next()
+	})
+	r.POST("/wallets/:wallet_id/holds", handlers.PlaceHold)
+	r.POST("/wallets/:wallet_id/holds/:hold_id/capture", handlers.CaptureHold)
+	r.POST("/wallets/:wallet_id/holds/:hold_id/release", handlers.ReleaseHold)
+	return r
+}
+
+func newTestHold(status domain.HoldStatus, captured int64) *domain.Hold {
+	return &domain.Hold{
+		ID:             3,
+		WalletID:       1,
+		Amount:         decimal.NewFromInt(60),
+		CapturedAmount: decimal.NewFromInt(captured),
+		Status:         status,
+		ExpiresAt:      time.Date(2023, 4, 8, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestPlaceHold(t *testing.T) {
+	mockHoldSvc := new(MockHoldService)
+	handlers.InitHoldHandlers(mockHoldSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		mockHoldSvc.On("PlaceHold", uint64(1), decimal.NewFromInt(60), uint64(1)).Return(newTestHold(domain.HoldStatusActive, 0), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds", strings.NewReader(`{"amount": "60"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{
+			"id": 3,
+			"wallet_id": 1,
+			"amount": "60",
+			"captured_amount": "0",
+			"status": "active",
+			"expires_at": "2023-04-08T12:00:00Z"
+		}`, w.Body.String())
+		mockHoldSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds", strings.NewReader(`{"amount": "-5"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("insufficient available balance", func(t *testing.T) {
+		mockHoldSvc.On("PlaceHold", uint64(1), decimal.NewFromInt(500), uint64(1)).Return(nil, repository.ErrInsufficientFunds).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds", strings.NewReader(`{"amount": "500"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPaymentRequired, w.Code)
+		assert.JSONEq(t, `{"error": "Insufficient available balance"}`, w.Body.String())
+	})
+}
+
+func TestCaptureHold(t *testing.T) {
+	mockHoldSvc := new(MockHoldService)
+	handlers.InitHoldHandlers(mockHoldSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("whole hold without a body", func(t *testing.T) {
+		mockHoldSvc.On("CaptureHold", uint64(1), uint64(3), decimal.Zero, uint64(1)).Return(newTestHold(domain.HoldStatusCaptured, 60), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/3/capture", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"captured_amount":"60"`)
+		mockHoldSvc.AssertExpectations(t)
+	})
+
+	t.Run("partial capture", func(t *testing.T) {
+		mockHoldSvc.On("CaptureHold", uint64(1), uint64(3), decimal.NewFromInt(45), uint64(1)).Return(newTestHold(domain.HoldStatusCaptured, 45), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/3/capture", strings.NewReader(`{"amount": "45"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"captured_amount":"45"`)
+	})
+
+	t.Run("more than held", func(t *testing.T) {
+		mockHoldSvc.On("CaptureHold", uint64(1), uint64(3), decimal.NewFromInt(70), uint64(1)).Return(nil, service.ErrCaptureExceedsHold).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/3/capture", strings.NewReader(`{"amount": "70"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("expired hold", func(t *testing.T) {
+		mockHoldSvc.On("CaptureHold", uint64(1), uint64(4), decimal.Zero, uint64(1)).Return(nil, service.ErrHoldExpired).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/4/capture", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.JSONEq(t, `{"error": "Hold has expired"}`, w.Body.String())
+	})
+
+	t.Run("invalid hold id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/abc/capture", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error": "Invalid hold ID"}`, w.Body.String())
+	})
+}
+
+func TestReleaseHold(t *testing.T) {
+	mockHoldSvc := new(MockHoldService)
+	handlers.InitHoldHandlers(mockHoldSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		mockHoldSvc.On("ReleaseHold", uint64(1), uint64(3), uint64(1)).Return(newTestHold(domain.HoldStatusReleased, 0), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/3/release", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"released"`)
+		mockHoldSvc.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockHoldSvc.On("ReleaseHold", uint64(1), uint64(9), uint64(1)).Return(nil, repository.ErrHoldNotFound).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/9/release", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error": "Hold not found"}`, w.Body.String())
+	})
+
+	t.Run("already released", func(t *testing.T) {
+		mockHoldSvc.On("ReleaseHold", uint64(1), uint64(3), uint64(1)).Return(nil, service.ErrHoldNotActive).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/1/holds/3/release", nil)
+		newHoldRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/sirupsen/logrus"
+)
+
+var sessionSvc SessionService
+
+type SessionService interface {
+	ListSessions(ctx context.Context, userID uint64) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uint64) error
+	RevokeAllSessions(ctx context.Context, userID uint64) (int64, error)
+}
+
+func InitSessionHandlers(sessionService SessionService) {
+	sessionSvc = sessionService
+}
+
+type sessionResponse struct {
+	ID         uint64    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+//	@Summary		Logout API
+//	@Description	Revoke the session of the token used for this request
+//	@Tags			auth
+//	@Produce		json
+//
+//	@Success		200	{object}	string
+//	@Failure		401	{string}	httputil.HTTPError
+//	@Router			/v1/auth/logout [post]
+//	@Security		ApiKeyAuth
+func Logout(c *gin.Context) {
+	user := c.MustGet("user").(*domain.User)
+	sessionID := c.GetUint64("session_id")
+
+	err := sessionSvc.RevokeSession(c.Request.Context(), user.ID, sessionID)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		logrus.Errorf("error in revoking the session, err: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke the session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+//	@Summary		Logout All API
+//	@Description	Revoke every session of the user
+//	@Tags			auth
+//	@Produce		json
+//
+//	@Success		200	{object}	string
+//	@Failure		401	{string}	httputil.HTTPError
+//	@Router			/v1/auth/logout-all [post]
+//	@Security		ApiKeyAuth
+func LogoutAll(c *gin.Context) {
+	user := c.MustGet("user").(*domain.User)
+
+	revoked, err := sessionSvc.RevokeAllSessions(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("error in revoking the sessions, err: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke the sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "revoked": revoked})
+}
+
+//	@Summary		List Sessions API
+//	@Description	List the active sessions of the user
+//	@Tags			auth
+//	@Produce		json
+//
+//	@Success		200	{object}	string
+//	@Failure		401	{string}	httputil.HTTPError
+//	@Router			/v1/auth/sessions [get]
+//	@Security		ApiKeyAuth
+func ListSessions(c *gin.Context) {
+	user := c.MustGet("user").(*domain.User)
+	currentID := c.GetUint64("session_id")
+
+	sessions, err := sessionSvc.ListSessions(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("error in listing the sessions, err: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list sessions"})
+		return
+	}
+
+	items := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, sessionResponse{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt,
+			ExpiresAt:  s.ExpiresAt,
+			LastUsedAt: s.LastUsedAt,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": items})
+}
+
+//	@Summary		Revoke Session API
+//	@Description	Revoke one of the user's sessions
+//	@Tags			auth
+//	@Produce		json
+//
+//	@Param			session_id	path		string	true	"session id to revoke"
+//
+//	@Success		200			{object}	string
+//	@Failure		404			{string}	httputil.HTTPError
+//	@Router			/v1/auth/sessions/{session_id} [delete]
+//	@Security		ApiKeyAuth
+func RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("session_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+	user := c.MustGet("user").(*domain.User)
+
+	err = sessionSvc.RevokeSession(c.Request.Context(), user.ID, sessionID)
+	if err != nil {
+		logrus.Errorf("error in revoking the session, err: %s", err)
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke the session"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSessionService struct {
+	mock.Mock
+}
+
+func (m *MockSessionService) ListSessions(ctx context.Context, userID uint64) ([]domain.Session, error) {
+	args := m.Called(userID)
+	sessions, _ := args.Get(0).([]domain.Session)
+	return sessions, args.Error(1)
+}
+
+func (m *MockSessionService) RevokeSession(ctx context.Context, userID, sessionID uint64) error {
+	args := m.Called(userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) RevokeAllSessions(ctx context.Context, userID uint64) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func newSessionRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: "user1"})
+		c.Set("session_id", uint64(5))
+		c.Next()
+	})
+	r.POST("/logout", handlers.Logout)
+	r.POST("/logout-all", handlers.LogoutAll)
+	r.GET("/sessions", handlers.ListSessions)
+	r.DELETE("/sessions/:session_id", handlers.RevokeSession)
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	mockSessionSvc := new(MockSessionService)
+	handlers.InitSessionHandlers(mockSessionSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("logout revokes the current session", func(t *testing.T) {
+		mockSessionSvc.On("RevokeSession", uint64(1), uint64(5)).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/logout", nil)
+		newSessionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockSessionSvc.AssertExpectations(t)
+	})
+
+	t.Run("logout all revokes every session", func(t *testing.T) {
+		mockSessionSvc.On("RevokeAllSessions", uint64(1)).Return(int64(3), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/logout-all", nil)
+		newSessionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status": "success", "revoked": 3}`, w.Body.String())
+	})
+
+	t.Run("list marks the current session", func(t *testing.T) {
+		sessions := []domain.Session{{ID: 5, UserID: 1}, {ID: 4, UserID: 1}}
+		mockSessionSvc.On("ListSessions", uint64(1)).Return(sessions, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/sessions", nil)
+		newSessionRouter().ServeHTTP(w, req)
+
+		var response struct {
+			Sessions []struct {
+				ID      uint64 `json:"id"`
+				Current bool   `json:"current"`
+			} `json:"sessions"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, response.Sessions, 2)
+		assert.True(t, response.Sessions[0].Current)
+		assert.False(t, response.Sessions[1].Current)
+	})
+
+	t.Run("revoking someone else's session is not found", func(t *testing.T) {
+		mockSessionSvc.On("RevokeSession", uint64(1), uint64(9)).Return(repository.ErrSessionNotFound).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/sessions/9", nil)
+		newSessionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var transactionSvc TransactionService
+
+type TransactionService interface {
+	ListTransactions(ctx context.Context, walletID uint64, filter repository.TransactionFilter, userID uint64) ([]domain.Transaction, int64, error)
+	ReverseTransaction(ctx context.Context, transactionID uint64, amount decimal.Decimal, userID uint64, admin bool) (*domain.Transaction, error)
+}
+
+func InitTransactionHandlers(transactionService TransactionService) {
+	transactionSvc = transactionService
+}
+
+type transactionResponse struct {
+	ID             uint64                 `json:"id"`
+	WalletID       uint64                 `json:"wallet_id"`
+	Type           domain.TransactionType `json:"type"`
+	Amount         decimal.Decimal        `json:"amount"`
+	BalanceAfter   decimal.Decimal        `json:"balance_after"`
+	ActorID        uint64                 `json:"actor_id"`
+	Reference      string                 `json:"reference,omitempty"`
+	QuoteID        *uint64                `json:"quote_id,omitempty"`
+	ReversalOf     *uint64                `json:"reversal_of,omitempty"`
+	ReversedAmount decimal.Decimal        `json:"reversed_amount"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+type reverseReqBody struct {
+	Amount string `json:"amount"`
+}
+
+func newTransactionResponse(t domain.Transaction) transactionResponse {
+	return transactionResponse{
+		ID:             t.ID,
+		WalletID:       t.WalletID,
+		Type:           t.Type,
+		Amount:         t.Amount,
+		BalanceAfter:   t.BalanceAfter,
+		ActorID:        t.ActorID,
+		Reference:      t.Reference,
+		QuoteID:        t.QuoteID,
+		ReversalOf:     t.ReversalOfID,
+		ReversedAmount: t.ReversedAmount,
+		CreatedAt:      t.CreatedAt,
+	}
+}
+
+//	@Summary		List Transactions API
+//	@Description	List the balance changes of a wallet, newest first
+//	@Tags			wallet
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			wallet_id	path		string	true	"wallet id to list the transactions of"
+//	@Param			page		query		int		false	"page number, starting at 1"
+//	@Param			page_size	query		int		false	"number of transactions per page, at most 100"
+//	@Param			type		query		string	false	"credit or debit"
+//	@Param			from		query		string	false	"only transactions at or after this RFC 3339 time"
+//	@Param			to			query		string	false	"only transactions before this RFC 3339 time"
+//
+//	@Success		200			{object}	string
+//	@Failure		400			{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets/{wallet_id}/transactions [get]
+//	@Security		ApiKeyAuth
+func ListTransactions(c *gin.Context) {
+	walletID, err := strconv.ParseUint(c.Param("wallet_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	transactions, total, err := transactionSvc.ListTransactions(c.Request.Context(), walletID, filter, user.ID)
+	if err != nil {
+		logrus.Errorf("error in listing the transactions, err: %s", err)
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		} else if errors.Is(err, service.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list transactions"})
+		}
+		return
+	}
+
+	items := make([]transactionResponse, 0, len(transactions))
+	for _, t := range transactions {
+		items = append(items, newTransactionResponse(t))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": items,
+		"page":         filter.Page,
+		"page_size":    filter.PageSize,
+		"total":        total,
+	})
+}
+
+//	@Summary		Reverse Transaction API
+//	@Description	Compensate a credit, debit or hold capture with a transaction in the opposite direction. Leave out the amount to reverse whatever has not been reversed yet. Only admins can reverse debits and captures.
+//	@Tags			transaction
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			id				path		string			true	"id of the transaction to reverse"
+//	@Param			_				body		reverseReqBody	false	"amount to refund, at most the unreversed amount"
+//	@Param			Idempotency-Key	header		string			false	"unique key to safely retry the request"
+//
+//	@Success		201				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
+//	@Failure		402				{string}	httputil.HTTPError
+//	@Failure		403				{string}	httputil.HTTPError
+//	@Failure		404				{string}	httputil.HTTPError
+//	@Failure		409				{string}	httputil.HTTPError
+//	@Router			/api/v1/transactions/{id}/reverse [post]
+//	@Security		ApiKeyAuth
+func ReverseTransaction(c *gin.Context) {
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	req := reverseReqBody{}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	amount := decimal.Zero
+	if req.Amount != "" {
+		amount, err = decimal.NewFromString(req.Amount)
+		if err != nil || amount.Sign() <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or non-positive amount"})
+			return
+		}
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	reversal, err := transactionSvc.ReverseTransaction(c.Request.Context(), transactionID, amount, user.ID, c.GetBool("admin"))
+	if err != nil {
+		logrus.Errorf("error in reversing the transaction, err: %s", err)
+		if errors.Is(err, repository.ErrTransactionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		} else if errors.Is(err, service.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
+		} else if errors.Is(err, service.ErrReversalNeedsAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can reverse debits"})
+		} else if errors.Is(err, service.ErrNotReversible) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only credits and debits can be reversed"})
+		} else if errors.Is(err, service.ErrReversalExceedsRemaining) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reverse more than the unreversed amount"})
+		} else if errors.Is(err, service.ErrAmountPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the wallet's currency allows"})
+		} else if errors.Is(err, service.ErrAlreadyReversed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Transaction has already been reversed"})
+		} else if errors.Is(err, repository.ErrWalletFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Wallet is frozen"})
+		} else if errors.Is(err, repository.ErrInsufficientFunds) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient funds, balance cannot go below 0"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error in reversing the transaction"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, newTransactionResponse(*reversal))
+}
+
+func parseTransactionFilter(c *gin.Context) (repository.TransactionFilter, error) {
+	filter := repository.TransactionFilter{}
+
+	var err error
+	filter.Page, filter.PageSize, err = parsePage(c)
+	if err != nil {
+		return filter, err
+	}
+
+	switch t := domain.TransactionType(c.Query("type")); t {
+	case "", domain.TransactionTypeCredit, domain.TransactionTypeDebit:
+		filter.Type = t
+	default:
+		return filter, errors.New("Invalid transaction type")
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, errors.New("Invalid from date")
+		}
+		filter.From = from
+	}
+
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, errors.New("Invalid to date")
+		}
+		filter.To = to
+	}
+
+	return filter, nil
+}
+
+// parsePage reads the page and page_size query parameters.
+func parsePage(c *gin.Context) (page, pageSize int, err error) {
+	page, pageSize = 1, defaultPageSize
+
+	if v := c.Query("page"); v != "" {
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return 0, 0, errors.New("Invalid page")
+		}
+	}
+
+	if v := c.Query("page_size"); v != "" {
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, 0, errors.New("Invalid page size")
+		}
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,223 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+type MockTransactionService struct {
+	mock.Mock
+}
+
+func (m *MockTransactionService) ListTransactions(ctx context.Context, walletID uint64, filter repository.TransactionFilter, userID uint64) ([]domain.Transaction, int64, error) {
+	args := m.Called(walletID, filter, userID)
+	transactions, _ := args.Get(0).([]domain.Transaction)
+	return transactions, args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockTransactionService) ReverseTransaction(ctx context.Context, transactionID uint64, amount decimal.Decimal, userID uint64, admin bool) (*domain.Transaction, error) {
+	args := m.Called(transactionID, amount, userID, admin)
+	transaction, _ := args.Get(0).(*domain.Transaction)
+	return transaction, args.Error(1)
+}
+
+func newTransactionRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		user := &domain.User{
+			ID:       1,
+			Username: "user1",
+			Password: "password1",
+		}
+		c.Set("user", user)
+		c.Set("admin", c.GetHeader("X-Admin") == "true")
+		c.Next()
+	})
+	r.GET("/wallets/:wallet_id/transactions", handlers.ListTransactions)
+	r.POST("/transactions/:id/reverse", handlers.ReverseTransaction)
+	return r
+}
+
+func TestListTransactions(t *testing.T) {
+	mockTransactionSvc := new(MockTransactionService)
+	handlers.InitTransactionHandlers(mockTransactionSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case with filters", func(t *testing.T) {
+		from := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+		filter := repository.TransactionFilter{
+			Type:     domain.TransactionTypeCredit,
+			From:     from,
+			Page:     2,
+			PageSize: 10,
+		}
+		transactions := []domain.Transaction{
+			{ID: 7, WalletID: 1, Type: domain.TransactionTypeCredit, Amount: decimal.NewFromInt(50), BalanceAfter: decimal.NewFromInt(150), ActorID: 1},
+		}
+		mockTransactionSvc.On("ListTransactions", uint64(1), filter, uint64(1)).Return(transactions, int64(11), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets/1/transactions?type=credit&page=2&page_size=10&from=2023-04-01T00:00:00Z", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		var response struct {
+			Transactions []map[string]interface{} `json:"transactions"`
+			Total        int64                    `json:"total"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(11), response.Total)
+		assert.Len(t, response.Transactions, 1)
+		assert.Equal(t, "150", response.Transactions[0]["balance_after"])
+		mockTransactionSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid type", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets/1/transactions?type=refund", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("page size too large", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets/1/transactions?page_size=1000", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("wallet does not belong to user", func(t *testing.T) {
+		filter := repository.TransactionFilter{Page: 1, PageSize: 20}
+		mockTransactionSvc.On("ListTransactions", uint64(3), filter, uint64(1)).Return(nil, int64(0), service.ErrAccessDenied).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets/3/transactions", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestReverseTransaction(t *testing.T) {
+	mockTransactionSvc := new(MockTransactionService)
+	handlers.InitTransactionHandlers(mockTransactionSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("partial refund by an admin", func(t *testing.T) {
+		originalID := uint64(7)
+		reversal := &domain.Transaction{
+			ID:           9,
+			WalletID:     1,
+			Type:         domain.TransactionTypeCredit,
+			Amount:       decimal.NewFromInt(20),
+			BalanceAfter: decimal.NewFromInt(70),
+			ActorID:      1,
+			Reference:    "reversal_abc",
+			ReversalOfID: &originalID,
+			Model:        gorm.Model{CreatedAt: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)},
+		}
+		mockTransactionSvc.On("ReverseTransaction", uint64(7), decimal.NewFromInt(20), uint64(1), true).Return(reversal, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/7/reverse", strings.NewReader(`{"amount": "20"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin", "true")
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{
+			"id": 9,
+			"wallet_id": 1,
+			"type": "credit",
+			"amount": "20",
+			"balance_after": "70",
+			"actor_id": 1,
+			"reference": "reversal_abc",
+			"reversal_of": 7,
+			"reversed_amount": "0",
+			"created_at": "2023-04-01T12:00:00Z"
+		}`, w.Body.String())
+		mockTransactionSvc.AssertExpectations(t)
+	})
+
+	t.Run("whole remainder without a body", func(t *testing.T) {
+		mockTransactionSvc.On("ReverseTransaction", uint64(8), decimal.Zero, uint64(1), false).Return(&domain.Transaction{ID: 10}, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/8/reverse", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockTransactionSvc.AssertExpectations(t)
+	})
+
+	t.Run("already reversed", func(t *testing.T) {
+		mockTransactionSvc.On("ReverseTransaction", uint64(7), decimal.Zero, uint64(1), false).Return(nil, service.ErrAlreadyReversed).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/7/reverse", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.JSONEq(t, `{"error": "Transaction has already been reversed"}`, w.Body.String())
+	})
+
+	t.Run("insufficient funds", func(t *testing.T) {
+		mockTransactionSvc.On("ReverseTransaction", uint64(5), decimal.Zero, uint64(1), false).Return(nil, repository.ErrInsufficientFunds).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/5/reverse", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	})
+
+	t.Run("debit reversed by its owner", func(t *testing.T) {
+		mockTransactionSvc.On("ReverseTransaction", uint64(6), decimal.Zero, uint64(1), false).Return(nil, service.ErrReversalNeedsAdmin).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/6/reverse", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"error": "Only admins can reverse debits"}`, w.Body.String())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockTransactionSvc.On("ReverseTransaction", uint64(99), decimal.Zero, uint64(1), false).Return(nil, repository.ErrTransactionNotFound).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/99/reverse", nil)
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/transactions/7/reverse", strings.NewReader(`{"amount": "0"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newTransactionRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
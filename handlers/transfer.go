@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+var transferSvc TransferService
+
+type TransferService interface {
+	Transfer(ctx context.Context, fromWalletID, toWalletID uint64, amount decimal.Decimal, quoteID, userID uint64) error
+}
+
+func InitTransferHandlers(transferService TransferService) {
+	transferSvc = transferService
+}
+
+type transferReqBody struct {
+	FromWalletID uint64 `json:"from_wallet_id"`
+	ToWalletID   uint64 `json:"to_wallet_id"`
+	Amount       string `json:"amount"`
+	// Required between wallets of different currencies
+	QuoteID uint64 `json:"quote_id"`
+}
+
+//	@Summary		Transfer API
+//	@Description	Move funds from one wallet to another atomically. Wallets of different currencies need the quote_id of an unexpired quote.
+//	@Tags			transfer
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_				body		transferReqBody	false	"source wallet, destination wallet and amount"
+//	@Param			Idempotency-Key	header		string			false	"unique key to safely retry the request"
+//
+//	@Success		200				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
+//	@Router			/api/v1/transfers [post]
+//	@Security		ApiKeyAuth
+func Transfer(c *gin.Context) {
+	req := transferReqBody{}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.FromWalletID == 0 || req.ToWalletID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+		return
+	}
+
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil || amount.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or non-positive amount"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	err = transferSvc.Transfer(c.Request.Context(), req.FromWalletID, req.ToWalletID, amount, req.QuoteID, user.ID)
+	if err != nil {
+		logrus.Errorf("error in transferring between wallets, err: %s", err)
+		if errors.Is(err, service.ErrSameWallet) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer to the same wallet"})
+		} else if errors.Is(err, service.ErrCurrencyMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wallets hold different currencies, a conversion is required"})
+		} else if errors.Is(err, service.ErrAmountPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the wallet's currency allows"})
+		} else if errors.Is(err, service.ErrQuoteMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Transfer does not match the quote"})
+		} else if errors.Is(err, service.ErrQuoteExpired) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Quote has expired, request a new one"})
+		} else if errors.Is(err, service.ErrQuoteUsed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Quote has already been used"})
+		} else if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		} else if errors.Is(err, repository.ErrQuoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quote not found"})
+		} else if errors.Is(err, repository.ErrInsufficientFunds) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient funds, balance cannot go below 0"})
+		} else if errors.Is(err, repository.ErrWalletFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Wallet is frozen"})
+		} else if errors.Is(err, service.ErrAccessDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error in transferring between wallets"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
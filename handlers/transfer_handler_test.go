@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockTransferService struct {
+	mock.Mock
+}
+
+func (m *MockTransferService) Transfer(ctx context.Context, fromWalletID, toWalletID uint64, amount decimal.Decimal, quoteID, userID uint64) error {
+	args := m.Called(fromWalletID, toWalletID, amount, quoteID, userID)
+	return args.Error(0)
+}
+
+func newTransferRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		user := &domain.User{
+			ID:       1,
+			Username: "user1",
+			Password: "password1",
+		}
+		c.Set("user", user)
+		c.Next()
+	})
+	r.POST("/transfers", handlers.Transfer)
+	return r
+}
+
+func TestTransfer(t *testing.T) {
+	mockTransferSvc := new(MockTransferService)
+	handlers.InitTransferHandlers(mockTransferSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("successful transfer", func(t *testing.T) {
+		mockTransferSvc.On("Transfer", uint64(1), uint64(2), decimal.NewFromInt(40), uint64(0), uint64(1)).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		reqBody := `{"from_wallet_id": 1, "to_wallet_id": 2, "amount": "40"}`
+		req, _ := http.NewRequest("POST", "/transfers", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		newTransferRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockTransferSvc.AssertExpectations(t)
+	})
+
+	t.Run("transfer between currencies with a quote", func(t *testing.T) {
+		mockTransferSvc.On("Transfer", uint64(1), uint64(3), decimal.NewFromInt(40), uint64(7), uint64(1)).Return(nil).Once()
+
+		w := httptest.NewRecorder()
+		reqBody := `{"from_wallet_id": 1, "to_wallet_id": 3, "amount": "40", "quote_id": 7}`
+		req, _ := http.NewRequest("POST", "/transfers", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		newTransferRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockTransferSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		reqBody := `{"from_wallet_id": 1, "to_wallet_id": 2, "amount": "-40"}`
+		req, _ := http.NewRequest("POST", "/transfers", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		newTransferRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	errorCases := []struct {
+		name    string
+		err     error
+		code    int
+		message string
+	}{
+		{"same wallet", service.ErrSameWallet, http.StatusBadRequest, "Cannot transfer to the same wallet"},
+		{"different currencies", service.ErrCurrencyMismatch, http.StatusBadRequest, "Wallets hold different currencies, a conversion is required"},
+		{"too many decimal places", service.ErrAmountPrecision, http.StatusBadRequest, "Amount has more decimal places than the wallet's currency allows"},
+		{"quote does not match", service.ErrQuoteMismatch, http.StatusBadRequest, "Transfer does not match the quote"},
+		{"quote expired", service.ErrQuoteExpired, http.StatusConflict, "Quote has expired, request a new one"},
+		{"quote used", service.ErrQuoteUsed, http.StatusConflict, "Quote has already been used"},
+		{"wallet not found", repository.ErrWalletNotFound, http.StatusNotFound, "Wallet not found"},
+		{"quote not found", repository.ErrQuoteNotFound, http.StatusNotFound, "Quote not found"},
+		{"insufficient funds", repository.ErrInsufficientFunds, http.StatusPaymentRequired, "Insufficient funds, balance cannot go below 0"},
+		{"wallet does not belong to the user", service.ErrAccessDenied, http.StatusForbidden, "Wallet does not belong to the user"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockTransferSvc.On("Transfer", uint64(1), uint64(2), decimal.NewFromInt(40), uint64(0), uint64(1)).Return(tc.err).Once()
+
+			w := httptest.NewRecorder()
+			reqBody := `{"from_wallet_id": 1, "to_wallet_id": 2, "amount": "40"}`
+			req, _ := http.NewRequest("POST", "/transfers", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			newTransferRouter().ServeHTTP(w, req)
+
+			var response map[string]string
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.code, w.Code)
+			assert.Equal(t, tc.message, response["error"])
+		})
+	}
+}
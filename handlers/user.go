@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mohammadrabetian/quick/domain"
-	"github.com/mohammadrabetian/quick/middleware"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/sirupsen/logrus"
 )
 
 var userSvc UserService
 
 type UserService interface {
-	GetUserByUsername(username string) (*domain.User, error)
-	UpdateUser(user *domain.User) error
+	Login(ctx context.Context, username, password, userAgent, ip string) (*service.AuthTokens, error)
+	Register(ctx context.Context, username, password string) (*domain.User, error)
+	RefreshSession(ctx context.Context, refreshToken string) (*service.AuthTokens, error)
 }
 
 func InitUserHandlers(userService UserService) {
@@ -25,7 +29,7 @@ type loginReqBody struct {
 }
 
 //	@Summary		Login API
-//	@Description	Login authenticates the user and returns a token
+//	@Description	Login authenticates the user and returns a token, or an access and refresh token in jwt auth mode
 
 //	@Tags		auth
 //	@Accept		json
@@ -35,6 +39,7 @@ type loginReqBody struct {
 //
 //	@Success	200	{object}	string
 //	@Failure	400	{string}	httputil.HTTPError
+//	@Failure	403	{string}	httputil.HTTPError
 //	@Router		/v1/auth/login [post]
 func Login(c *gin.Context) {
 	var req loginReqBody
@@ -44,27 +49,102 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	user, err := userSvc.GetUserByUsername(req.Username)
+	tokens, err := userSvc.Login(c.Request.Context(), req.Username, req.Password, c.Request.UserAgent(), c.ClientIP())
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+	if errors.Is(err, service.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		logrus.Errorf("error in logging in user %s, err: %s", req.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
 		return
 	}
-	if user == nil || user.Password != req.Password {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+type refreshReqBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+//	@Summary		Refresh API
+//	@Description	Exchange a refresh token for a new access token and refresh token (jwt auth mode only)
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_	body		refreshReqBody	false	"refresh token received on login or on the last refresh"
+//
+//	@Success		200	{object}	string
+//	@Failure		401	{string}	httputil.HTTPError
+//	@Router			/v1/auth/refresh [post]
+func Refresh(c *gin.Context) {
+	var req refreshReqBody
+
+	if err := c.BindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	token, err := middleware.GenerateSecureToken()
+	tokens, err := userSvc.RefreshSession(c.Request.Context(), req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create a token"})
+		if errors.Is(err, service.ErrRefreshNotSupported) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Refresh tokens are not enabled"})
+		} else if errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used, the session has been revoked"})
+		} else if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		} else {
+			logrus.Errorf("error in refreshing the session, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh the session"})
+		}
 		return
 	}
-	user.Token = token
-	err = userSvc.UpdateUser(user)
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+type registerReqBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+//	@Summary		Register API
+//	@Description	Register creates a new user
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_	body		registerReqBody	false	"username and password"
+//
+//	@Success		201	{object}	string
+//	@Failure		400	{string}	httputil.HTTPError
+//	@Failure		409	{string}	httputil.HTTPError
+//	@Router			/v1/auth/register [post]
+func Register(c *gin.Context) {
+	var req registerReqBody
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := userSvc.Register(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user token"})
+		if errors.Is(err, service.ErrInvalidUsername) || errors.Is(err, service.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, service.ErrUsernameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		} else {
+			logrus.Errorf("error in registering the user, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register the user"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusCreated, gin.H{"id": user.ID, "username": user.Username})
 }
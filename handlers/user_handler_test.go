@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,17 +21,22 @@ type MockUserService struct {
 	mock.Mock
 }
 
-func (m *MockUserService) GetUserByUsername(username string) (*domain.User, error) {
-	args := m.Called(username)
-	if args.Get(0) == nil {
-		return nil, args.Error(1)
-	}
-	return args.Get(0).(*domain.User), args.Error(1)
+func (m *MockUserService) Login(ctx context.Context, username, password, userAgent, ip string) (*service.AuthTokens, error) {
+	args := m.Called(username, password, userAgent, ip)
+	tokens, _ := args.Get(0).(*service.AuthTokens)
+	return tokens, args.Error(1)
+}
+
+func (m *MockUserService) Register(ctx context.Context, username, password string) (*domain.User, error) {
+	args := m.Called(username, password)
+	user, _ := args.Get(0).(*domain.User)
+	return user, args.Error(1)
 }
 
-func (m *MockUserService) UpdateUser(user *domain.User) error {
-	args := m.Called(user)
-	return args.Error(0)
+func (m *MockUserService) RefreshSession(ctx context.Context, refreshToken string) (*service.AuthTokens, error) {
+	args := m.Called(refreshToken)
+	tokens, _ := args.Get(0).(*service.AuthTokens)
+	return tokens, args.Error(1)
 }
 
 func TestLogin(t *testing.T) {
@@ -37,80 +44,138 @@ func TestLogin(t *testing.T) {
 	handlers.InitUserHandlers(mockUserSvc)
 	gin.SetMode(gin.TestMode)
 
-	t.Run("successful login", func(t *testing.T) {
-		user := &domain.User{
-			ID:       1,
-			Username: "user1",
-			Password: "password1",
-			Token:    "",
-		}
-		mockUserSvc.On("GetUserByUsername", "user1").Return(user, nil).Once()
-		mockUserSvc.On("UpdateUser", user).Return(nil).Once()
-
+	login := func(body string) *httptest.ResponseRecorder {
 		r := gin.Default()
 		r.POST("/login", handlers.Login)
 		w := httptest.NewRecorder()
-		reqBody := `{"username": "user1", "password": "password1"}`
-		req, _ := http.NewRequest("POST", "/login", strings.NewReader(reqBody))
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(body))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "quick-test")
 		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("successful login", func(t *testing.T) {
+		mockUserSvc.On("Login", "user1", "password1", "quick-test", mock.Anything).
+			Return(&service.AuthTokens{Token: "token", TokenType: "Bearer"}, nil).Once()
+
+		w := login(`{"username": "user1", "password": "password1"}`)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"token"`)
 		mockUserSvc.AssertExpectations(t)
 	})
 
 	t.Run("invalid username or password", func(t *testing.T) {
-		user := &domain.User{
-			ID:       1,
-			Username: "user1",
-			Password: "password1",
-			Token:    "",
-		}
-		mockUserSvc.On("GetUserByUsername", "user1").Return(user, nil).Once()
+		mockUserSvc.On("Login", "user1", "wrong_password", mock.Anything, mock.Anything).
+			Return(nil, service.ErrInvalidCredentials).Once()
 
-		r := gin.Default()
-		r.POST("/login", handlers.Login)
-		w := httptest.NewRecorder()
-		reqBody := `{"username": "user1", "password": "wrong_password"}`
-		req, _ := http.NewRequest("POST", "/login", strings.NewReader(reqBody))
-		req.Header.Set("Content-Type", "application/json")
-		r.ServeHTTP(w, req)
+		w := login(`{"username": "user1", "password": "wrong_password"}`)
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 
-	t.Run("failed to retrieve user", func(t *testing.T) {
-		mockUserSvc.On("GetUserByUsername", "user1").Return(nil, errors.New("database error")).Once()
+	t.Run("failed to log in", func(t *testing.T) {
+		mockUserSvc.On("Login", "user2", "password1", mock.Anything, mock.Anything).
+			Return(nil, errors.New("database error")).Once()
 
-		r := gin.Default()
-		r.POST("/login", handlers.Login)
-		w := httptest.NewRecorder()
-		reqBody := `{"username": "user1", "password": "password1"}`
-		req, _ := http.NewRequest("POST", "/login", strings.NewReader(reqBody))
-		req.Header.Set("Content-Type", "application/json")
-		r.ServeHTTP(w, req)
+		w := login(`{"username": "user2", "password": "password1"}`)
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
-	t.Run("failed to update user token", func(t *testing.T) {
-		user := &domain.User{
-			ID:       1,
-			Username: "user1",
-			Password: "password1",
-			Token:    "",
-		}
-		mockUserSvc.On("GetUserByUsername", "user1").Return(user, nil).Once()
-		mockUserSvc.On("UpdateUser", user).Return(errors.New("database error")).Once()
+	t.Run("disabled user", func(t *testing.T) {
+		mockUserSvc.On("Login", "user3", "password1", mock.Anything, mock.Anything).
+			Return(nil, service.ErrUserDisabled).Once()
 
-		r := gin.Default()
-		r.POST("/login", handlers.Login)
-		w := httptest.NewRecorder()
-		reqBody := `{"username": "user1", "password": "password1"}`
-		req, _ := http.NewRequest("POST", "/login", strings.NewReader(reqBody))
-		req.Header.Set("Content-Type", "application/json")
-		r.ServeHTTP(w, req)
+		w := login(`{"username": "user3", "password": "password1"}`)
 
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "User is disabled")
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		w := login(`{"username": `)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
+
+func TestRefresh(t *testing.T) {
+	mockUserSvc := new(MockUserService)
+	handlers.InitUserHandlers(mockUserSvc)
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"successful refresh", nil, http.StatusOK},
+		{"invalid refresh token", service.ErrInvalidRefreshToken, http.StatusUnauthorized},
+		{"reused refresh token", service.ErrRefreshTokenReused, http.StatusUnauthorized},
+		{"opaque auth mode", service.ErrRefreshNotSupported, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tokens *service.AuthTokens
+			if tc.err == nil {
+				tokens = &service.AuthTokens{AccessToken: "access", RefreshToken: "refresh-2", TokenType: "Bearer"}
+			}
+			mockUserSvc.On("RefreshSession", "refresh-1").Return(tokens, tc.err).Once()
+
+			r := gin.Default()
+			r.POST("/refresh", handlers.Refresh)
+			w := httptest.NewRecorder()
+			reqBody := `{"refresh_token": "refresh-1"}`
+			req, _ := http.NewRequest("POST", "/refresh", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.err == nil {
+				assert.Contains(t, w.Body.String(), `"refresh_token":"refresh-2"`)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	mockUserSvc := new(MockUserService)
+	handlers.InitUserHandlers(mockUserSvc)
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"successful registration", nil, http.StatusCreated},
+		{"invalid username", service.ErrInvalidUsername, http.StatusBadRequest},
+		{"weak password", service.ErrWeakPassword, http.StatusBadRequest},
+		{"username taken", service.ErrUsernameTaken, http.StatusConflict},
+		{"database error", errors.New("database error"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var user *domain.User
+			if tc.err == nil {
+				user = &domain.User{ID: 4, Username: "user4"}
+			}
+			mockUserSvc.On("Register", "user4", "Password-4444").Return(user, tc.err).Once()
+
+			r := gin.Default()
+			r.POST("/register", handlers.Register)
+			w := httptest.NewRecorder()
+			reqBody := `{"username": "user4", "password": "Password-4444"}`
+			req, _ := http.NewRequest("POST", "/register", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.err == nil {
+				assert.JSONEq(t, `{"id": 4, "username": "user4"}`, w.Body.String())
+			}
+		})
+	}
+}
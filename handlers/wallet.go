@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/currency"
 	"github.com/mohammadrabetian/quick/repository"
 	"github.com/mohammadrabetian/quick/service"
 	"github.com/shopspring/decimal"
@@ -16,17 +19,102 @@ import (
 var walletSvc WalletService
 
 type WalletService interface {
-	GetBalance(walletID uint64, username string) (*domain.Wallet, error)
-	CreditWallet(walletID uint64, amount decimal.Decimal, username string) error
-	DebitWallet(walletID uint64, amount decimal.Decimal, username string) error
+	CreateWallet(ctx context.Context, userID uint64, currencyCode string) (*domain.Wallet, error)
+	ListWallets(ctx context.Context, userID uint64) ([]domain.Wallet, error)
+	GetBalance(ctx context.Context, walletID, userID uint64) (*domain.Wallet, error)
+	CreditWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error
+	DebitWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error
 }
 
 func InitWalletHandlers(walletService WalletService) {
 	walletSvc = walletService
 }
 
+type walletResponse struct {
+	ID               uint64          `json:"id"`
+	Balance          decimal.Decimal `json:"balance"`
+	AvailableBalance decimal.Decimal `json:"available_balance"`
+	Currency         string          `json:"currency"`
+}
+
+func newWalletResponse(w *domain.Wallet) walletResponse {
+	return walletResponse{ID: w.ID, Balance: w.Balance, AvailableBalance: w.AvailableBalance(), Currency: w.Currency}
+}
+
+type createWalletReqBody struct {
+	Currency string `json:"currency"`
+}
+
+//	@Summary		Create Wallet API
+//	@Description	Open a new, empty wallet for the signed-in user. Without a currency the default one is used.
+//	@Tags			wallet
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_				body		createWalletReqBody	false	"ISO 4217 currency code of the wallet, e.g. EUR"
+//	@Param			Idempotency-Key	header		string				false	"unique key to safely retry the request"
+//
+//	@Success		201				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
+//	@Failure		401				{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets [post]
+//	@Security		ApiKeyAuth
+func CreateWallet(c *gin.Context) {
+	req := createWalletReqBody{}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	wallet, err := walletSvc.CreateWallet(c.Request.Context(), user.ID, req.Currency)
+	if err != nil {
+		logrus.Errorf("error in creating a wallet, err: %s", err)
+		if errors.Is(err, currency.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or unsupported currency"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create wallet"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, newWalletResponse(wallet))
+}
+
+//	@Summary		List Wallets API
+//	@Description	List the wallets of the signed-in user
+//	@Tags			wallet
+//	@Produce		json
+//
+//	@Success		200	{object}	string
+//	@Failure		401	{string}	httputil.HTTPError
+//	@Router			/api/v1/wallets [get]
+//	@Security		ApiKeyAuth
+func ListWallets(c *gin.Context) {
+	user := c.MustGet("user").(*domain.User)
+
+	wallets, err := walletSvc.ListWallets(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("error in listing the wallets, err: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list wallets"})
+		return
+	}
+
+	items := make([]walletResponse, 0, len(wallets))
+	for i := range wallets {
+		items = append(items, newWalletResponse(&wallets[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wallets": items})
+}
+
 //	@Summary		Get Balance API
-//	@Description	Get Wallet Balance
+//	@Description	Get Wallet Balance. The available balance excludes the amount reserved by holds.
 //	@Tags			wallet
 //	@Accept			json
 //	@Produce		json
@@ -46,7 +134,7 @@ func GetBalance(c *gin.Context) {
 	}
 	user := c.MustGet("user").(*domain.User)
 
-	wallet, err := walletSvc.GetBalance(walletID, user.Username)
+	wallet, err := walletSvc.GetBalance(c.Request.Context(), walletID, user.ID)
 	if err != nil {
 		logrus.Errorf("error in retrieving the wallet, err: %s", err)
 		if errors.Is(err, repository.ErrWalletNotFound) {
@@ -58,7 +146,11 @@ func GetBalance(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"balance": wallet.Balance})
+	c.JSON(http.StatusOK, gin.H{
+		"balance":           wallet.Balance,
+		"available_balance": wallet.AvailableBalance(),
+		"currency":          wallet.Currency,
+	})
 }
 
 type creditReqbody struct {
@@ -71,12 +163,13 @@ type creditReqbody struct {
 //	@Accept			json
 //	@Produce		json
 //
-//	@Param			wallet_id	path		string			true	"wallet id to credit the balance"
+//	@Param			wallet_id		path		string			true	"wallet id to credit the balance"
 //
-//	@Param			_			body		creditReqbody	false	"amount to credit the wallet"
+//	@Param			_				body		creditReqbody	false	"amount to credit the wallet"
+//	@Param			Idempotency-Key	header		string			false	"unique key to safely retry the request"
 //
-//	@Success		200			{object}	string
-//	@Failure		400			{string}	httputil.HTTPError
+//	@Success		200				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
 //	@Router			/api/v1/wallets/{wallet_id}/credit [post]
 //	@Security		ApiKeyAuth
 func CreditWallet(c *gin.Context) {
@@ -101,11 +194,15 @@ func CreditWallet(c *gin.Context) {
 
 	user := c.MustGet("user").(*domain.User)
 
-	err = walletSvc.CreditWallet(walletID, amount, user.Username)
+	err = walletSvc.CreditWallet(c.Request.Context(), walletID, amount, user.ID)
 	if err != nil {
 		logrus.Errorf("error in crediting the wallet, err: %s", err)
 		if errors.Is(err, repository.ErrWalletNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		} else if errors.Is(err, service.ErrAmountPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the wallet's currency allows"})
+		} else if errors.Is(err, repository.ErrWalletFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Wallet is frozen"})
 		} else if errors.Is(err, service.ErrAccessDenied) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
 		} else {
@@ -127,12 +224,13 @@ type debitReqbody struct {
 //	@Accept			json
 //	@Produce		json
 //
-//	@Param			wallet_id	path		string			true	"wallet id to debit the balance"
+//	@Param			wallet_id		path		string			true	"wallet id to debit the balance"
 //
-//	@Param			_			body		debitReqbody	false	"amount to debit from the wallet"
+//	@Param			_				body		debitReqbody	false	"amount to debit from the wallet"
+//	@Param			Idempotency-Key	header		string			false	"unique key to safely retry the request"
 //
-//	@Success		200			{object}	string
-//	@Failure		400			{string}	httputil.HTTPError
+//	@Success		200				{object}	string
+//	@Failure		400				{string}	httputil.HTTPError
 //	@Router			/api/v1/wallets/{wallet_id}/debit [post]
 //	@Security		ApiKeyAuth
 func DebitWallet(c *gin.Context) {
@@ -157,13 +255,17 @@ func DebitWallet(c *gin.Context) {
 
 	user := c.MustGet("user").(*domain.User)
 
-	err = walletSvc.DebitWallet(walletID, amount, user.Username)
+	err = walletSvc.DebitWallet(c.Request.Context(), walletID, amount, user.ID)
 	if err != nil {
 		logrus.Errorf("error in debiting the wallet, err: %s", err)
 		if errors.Is(err, repository.ErrWalletNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Wallet not found"})
+		} else if errors.Is(err, service.ErrAmountPrecision) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Amount has more decimal places than the wallet's currency allows"})
 		} else if errors.Is(err, repository.ErrInsufficientFunds) {
 			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Insufficient funds, balance cannot go below 0"})
+		} else if errors.Is(err, repository.ErrWalletFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Wallet is frozen"})
 		} else if errors.Is(err, service.ErrAccessDenied) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the user"})
 		} else {
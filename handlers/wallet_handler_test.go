@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mohammadrabetian/quick/domain"
 	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/pkg/currency"
 	"github.com/mohammadrabetian/quick/repository"
 	"github.com/mohammadrabetian/quick/service"
 	"github.com/shopspring/decimal"
@@ -22,30 +24,120 @@ type MockWalletService struct {
 	mock.Mock
 }
 
-func (m *MockWalletService) GetBalance(walletID uint64, username string) (*domain.Wallet, error) {
-	args := m.Called(walletID, username)
+func (m *MockWalletService) CreateWallet(ctx context.Context, userID uint64, currencyCode string) (*domain.Wallet, error) {
+	args := m.Called(userID, currencyCode)
 	wallet, _ := args.Get(0).(*domain.Wallet)
 	return wallet, args.Error(1)
 }
 
-func (m *MockWalletService) CreditWallet(walletID uint64, amount decimal.Decimal, username string) error {
-	args := m.Called(walletID, amount, username)
+func (m *MockWalletService) ListWallets(ctx context.Context, userID uint64) ([]domain.Wallet, error) {
+	args := m.Called(userID)
+	wallets, _ := args.Get(0).([]domain.Wallet)
+	return wallets, args.Error(1)
+}
+
+func (m *MockWalletService) GetBalance(ctx context.Context, walletID, userID uint64) (*domain.Wallet, error) {
+	args := m.Called(walletID, userID)
+	wallet, _ := args.Get(0).(*domain.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletService) CreditWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error {
+	args := m.Called(walletID, amount, userID)
 	return args.Error(0)
 }
 
-func (m *MockWalletService) DebitWallet(walletID uint64, amount decimal.Decimal, username string) error {
-	args := m.Called(walletID, amount, username)
+func (m *MockWalletService) DebitWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error {
+	args := m.Called(walletID, amount, userID)
 	return args.Error(0)
 }
 
+func TestCreateAndListWallets(t *testing.T) {
+	mockWalletSvc := new(MockWalletService)
+	handlers.InitWalletHandlers(mockWalletSvc)
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func() *gin.Engine {
+		r := gin.Default()
+		r.Use(func(c *gin.Context) {
+			c.Set("user", &domain.User{ID: 1, Username: "user1"})
+			c.Next()
+		})
+		r.POST("/wallets", handlers.CreateWallet)
+		r.GET("/wallets", handlers.ListWallets)
+		return r
+	}
+
+	t.Run("create wallet in the default currency", func(t *testing.T) {
+		mockWalletSvc.On("CreateWallet", uint64(1), "").Return(&domain.Wallet{ID: 9, Balance: decimal.Zero, Currency: "EUR"}, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets", nil)
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{"id": 9, "balance": "0", "available_balance": "0", "currency": "EUR"}`, w.Body.String())
+	})
+
+	t.Run("create wallet in a given currency", func(t *testing.T) {
+		mockWalletSvc.On("CreateWallet", uint64(1), "JPY").Return(&domain.Wallet{ID: 10, Balance: decimal.Zero, Currency: "JPY"}, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets", strings.NewReader(`{"currency": "JPY"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{"id": 10, "balance": "0", "available_balance": "0", "currency": "JPY"}`, w.Body.String())
+	})
+
+	t.Run("create wallet in an unknown currency", func(t *testing.T) {
+		mockWalletSvc.On("CreateWallet", uint64(1), "ABC").Return(nil, currency.ErrUnknownCurrency).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets", strings.NewReader(`{"currency": "ABC"}`))
+		req.Header.Set("Content-Type", "application/json")
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("list wallets", func(t *testing.T) {
+		wallets := []domain.Wallet{
+			{ID: 1, Balance: decimal.NewFromInt(100), HeldBalance: decimal.NewFromInt(30), Currency: "EUR"},
+			{ID: 9, Balance: decimal.Zero, Currency: "JPY"},
+		}
+		mockWalletSvc.On("ListWallets", uint64(1)).Return(wallets, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets", nil)
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"wallets": [{"id": 1, "balance": "100", "available_balance": "70", "currency": "EUR"}, {"id": 9, "balance": "0", "available_balance": "0", "currency": "JPY"}]}`, w.Body.String())
+	})
+
+	t.Run("list wallets fails", func(t *testing.T) {
+		mockWalletSvc.On("ListWallets", uint64(1)).Return(nil, errors.New("database error")).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/wallets", nil)
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	mockWalletSvc.AssertExpectations(t)
+}
+
 func TestGetBalance(t *testing.T) {
 	mockWalletSvc := new(MockWalletService)
 	handlers.InitWalletHandlers(mockWalletSvc)
 	gin.SetMode(gin.TestMode)
 
 	t.Run("happy case", func(t *testing.T) {
-		wallet := &domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100)}
-		mockWalletSvc.On("GetBalance", uint64(1), "user1").Return(wallet, nil)
+		wallet := &domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), HeldBalance: decimal.NewFromInt(25), Currency: "EUR"}
+		mockWalletSvc.On("GetBalance", uint64(1), uint64(1)).Return(wallet, nil)
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -70,6 +162,8 @@ func TestGetBalance(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Equal(t, "100", response["balance"])
+		assert.Equal(t, "75", response["available_balance"])
+		assert.Equal(t, "EUR", response["currency"])
 		mockWalletSvc.AssertExpectations(t)
 	})
 
@@ -101,7 +195,7 @@ func TestGetBalance(t *testing.T) {
 	})
 
 	t.Run("wallet not found", func(t *testing.T) {
-		mockWalletSvc.On("GetBalance", uint64(2), "user1").Return(nil, repository.ErrWalletNotFound)
+		mockWalletSvc.On("GetBalance", uint64(2), uint64(1)).Return(nil, repository.ErrWalletNotFound)
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -131,7 +225,7 @@ func TestGetBalance(t *testing.T) {
 	})
 
 	t.Run("wallet does not belong to user", func(t *testing.T) {
-		mockWalletSvc.On("GetBalance", uint64(3), "user1").Return(nil, service.ErrAccessDenied)
+		mockWalletSvc.On("GetBalance", uint64(3), uint64(1)).Return(nil, service.ErrAccessDenied)
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -160,7 +254,7 @@ func TestGetBalance(t *testing.T) {
 	})
 
 	t.Run("internal server error", func(t *testing.T) {
-		mockWalletSvc.On("GetBalance", uint64(4), "user1").Return(nil, errors.New("internal error"))
+		mockWalletSvc.On("GetBalance", uint64(4), uint64(1)).Return(nil, errors.New("internal error"))
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -196,7 +290,7 @@ func TestCreditWallet(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	t.Run("successfully credit wallet", func(t *testing.T) {
-		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), "user1").Return(nil).Once()
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), uint64(1)).Return(nil).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -245,7 +339,7 @@ func TestCreditWallet(t *testing.T) {
 	})
 
 	t.Run("invalid amount", func(t *testing.T) {
-		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(-100), "user1").Return(nil).Once()
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(-100), uint64(1)).Return(nil).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -269,7 +363,7 @@ func TestCreditWallet(t *testing.T) {
 	})
 
 	t.Run("wallet not found", func(t *testing.T) {
-		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), "user1").Return(repository.ErrWalletNotFound).Once()
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), uint64(1)).Return(repository.ErrWalletNotFound).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -293,7 +387,7 @@ func TestCreditWallet(t *testing.T) {
 	})
 
 	t.Run("wallet does not belong to the user", func(t *testing.T) {
-		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), "user1").Return(service.ErrAccessDenied).Once()
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), uint64(1)).Return(service.ErrAccessDenied).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -316,6 +410,52 @@ func TestCreditWallet(t *testing.T) {
 		assert.Equal(t, http.StatusForbidden, w.Code)
 	})
 
+	t.Run("too many decimal places for the currency", func(t *testing.T) {
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.RequireFromString("0.5"), uint64(1)).Return(service.ErrAmountPrecision).Once()
+
+		r := gin.Default()
+		r.Use(func(c *gin.Context) {
+			user := &domain.User{
+				ID:       1,
+				Username: "user1",
+				Password: "password1",
+			}
+			c.Set("user", user)
+			c.Next()
+		})
+		r.PUT("/wallets/:wallet_id/credit", handlers.CreditWallet)
+		w := httptest.NewRecorder()
+		reqBody := `{"amount": "0.5"}`
+		req, _ := http.NewRequest("PUT", "/wallets/1/credit", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("wallet is frozen", func(t *testing.T) {
+		mockWalletSvc.On("CreditWallet", uint64(1), decimal.NewFromInt(100), uint64(1)).Return(repository.ErrWalletFrozen).Once()
+
+		r := gin.Default()
+		r.Use(func(c *gin.Context) {
+			user := &domain.User{
+				ID:       1,
+				Username: "user1",
+				Password: "password1",
+			}
+			c.Set("user", user)
+			c.Next()
+		})
+		r.PUT("/wallets/:wallet_id/credit", handlers.CreditWallet)
+		w := httptest.NewRecorder()
+		reqBody := `{"amount": "100"}`
+		req, _ := http.NewRequest("PUT", "/wallets/1/credit", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
 }
 
 func TestDebitWallet(t *testing.T) {
@@ -325,7 +465,7 @@ func TestDebitWallet(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	t.Run("successfully debit wallet", func(t *testing.T) {
-		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(50), "user1").Return(nil).Once()
+		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(50), uint64(1)).Return(nil).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -375,7 +515,7 @@ func TestDebitWallet(t *testing.T) {
 	})
 
 	t.Run("invalid amount", func(t *testing.T) {
-		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(-100), "user1").Return(nil).Once()
+		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(-100), uint64(1)).Return(nil).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
@@ -400,7 +540,7 @@ func TestDebitWallet(t *testing.T) {
 	})
 
 	t.Run("insufficient funds", func(t *testing.T) {
-		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(100), "user1").Return(repository.ErrInsufficientFunds).Once()
+		mockWalletSvc.On("DebitWallet", uint64(1), decimal.NewFromInt(100), uint64(1)).Return(repository.ErrInsufficientFunds).Once()
 
 		r := gin.Default()
 		r.Use(func(c *gin.Context) {
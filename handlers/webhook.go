@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/sirupsen/logrus"
+)
+
+var webhookSvc WebhookService
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, userID uint64, url, secret string, eventTypes []string) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context, userID uint64) ([]domain.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, userID, id uint64) (*domain.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, userID, id uint64, update service.WebhookUpdate) (*domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, userID, id uint64) error
+	ListDeliveries(ctx context.Context, userID, subscriptionID uint64, page, pageSize int) ([]domain.WebhookDelivery, int64, error)
+	Redeliver(ctx context.Context, userID, subscriptionID, deliveryID uint64) (*domain.WebhookDelivery, error)
+}
+
+func InitWebhookHandlers(webhookService WebhookService) {
+	webhookSvc = webhookService
+}
+
+type createWebhookReqBody struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type updateWebhookReqBody struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+type webhookResponse struct {
+	ID         uint64   `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"`
+	// Secret is only returned when the webhook is created
+	Secret              string     `json:"secret,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+func newWebhookResponse(s *domain.WebhookSubscription) webhookResponse {
+	return webhookResponse{
+		ID:                  s.ID,
+		URL:                 s.URL,
+		EventTypes:          s.Events(),
+		Active:              s.Active,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		DisabledAt:          s.DisabledAt,
+		CreatedAt:           s.CreatedAt,
+	}
+}
+
+type deliveryResponse struct {
+	ID             uint64                       `json:"id"`
+	EventID        uint64                       `json:"event_id"`
+	EventType      string                       `json:"event_type"`
+	Status         domain.WebhookDeliveryStatus `json:"status"`
+	Attempts       int                          `json:"attempts"`
+	NextAttemptAt  *time.Time                   `json:"next_attempt_at,omitempty"`
+	LastStatusCode int                          `json:"last_status_code,omitempty"`
+	LastError      string                       `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time                   `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time                    `json:"created_at"`
+}
+
+func newDeliveryResponse(d *domain.WebhookDelivery) deliveryResponse {
+	resp := deliveryResponse{
+		ID:             d.ID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Status == domain.WebhookDeliveryPending {
+		resp.NextAttemptAt = &d.NextAttemptAt
+	}
+	return resp
+}
+
+//	@Summary		Create Webhook API
+//	@Description	Subscribe an endpoint to events of the user's wallets. Deliveries are signed with the secret, which is generated if left out and only returned here.
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			_	body		createWebhookReqBody	true	"url, optional secret and event types"
+//
+//	@Success		201	{object}	string
+//	@Failure		400	{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks [post]
+//	@Security		ApiKeyAuth
+func CreateWebhook(c *gin.Context) {
+	req := createWebhookReqBody{}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	subscription, err := webhookSvc.CreateSubscription(c.Request.Context(), user.ID, req.URL, req.Secret, req.EventTypes)
+	if err != nil {
+		logrus.Errorf("error in creating a webhook, err: %s", err)
+		respondWebhookError(c, err, "Error in creating the webhook")
+		return
+	}
+
+	resp := newWebhookResponse(subscription)
+	resp.Secret = subscription.Secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+//	@Summary		List Webhooks API
+//	@Description	List the user's webhooks
+//	@Tags			webhook
+//	@Produce		json
+//
+//	@Success		200	{object}	string
+//	@Router			/api/v1/webhooks [get]
+//	@Security		ApiKeyAuth
+func ListWebhooks(c *gin.Context) {
+	user := c.MustGet("user").(*domain.User)
+
+	subscriptions, err := webhookSvc.ListSubscriptions(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("error in listing the webhooks, err: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to list webhooks"})
+		return
+	}
+
+	items := make([]webhookResponse, 0, len(subscriptions))
+	for i := range subscriptions {
+		items = append(items, newWebhookResponse(&subscriptions[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": items})
+}
+
+//	@Summary		Get Webhook API
+//	@Description	Get one of the user's webhooks
+//	@Tags			webhook
+//	@Produce		json
+//
+//	@Param			id	path		string	true	"webhook id"
+//
+//	@Success		200	{object}	string
+//	@Failure		404	{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks/{id} [get]
+//	@Security		ApiKeyAuth
+func GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*domain.User)
+
+	subscription, err := webhookSvc.GetSubscription(c.Request.Context(), user.ID, id)
+	if err != nil {
+		logrus.Errorf("error in getting the webhook, err: %s", err)
+		respondWebhookError(c, err, "Unable to get the webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, newWebhookResponse(subscription))
+}
+
+//	@Summary		Update Webhook API
+//	@Description	Change the url, event types or state of a webhook. Setting active to true re-enables a webhook that was disabled after failing.
+//	@Tags			webhook
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			id	path		string					true	"webhook id"
+//	@Param			_	body		updateWebhookReqBody	true	"fields to change"
+//
+//	@Success		200	{object}	string
+//	@Failure		400	{string}	httputil.HTTPError
+//	@Failure		404	{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks/{id} [patch]
+//	@Security		ApiKeyAuth
+func UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	req := updateWebhookReqBody{}
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	subscription, err := webhookSvc.UpdateSubscription(c.Request.Context(), user.ID, id, service.WebhookUpdate{
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Active:     req.Active,
+	})
+	if err != nil {
+		logrus.Errorf("error in updating the webhook, err: %s", err)
+		respondWebhookError(c, err, "Error in updating the webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, newWebhookResponse(subscription))
+}
+
+//	@Summary		Delete Webhook API
+//	@Description	Delete a webhook, its pending deliveries are not sent
+//	@Tags			webhook
+//	@Produce		json
+//
+//	@Param			id	path		string	true	"webhook id"
+//
+//	@Success		200	{object}	string
+//	@Failure		404	{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks/{id} [delete]
+//	@Security		ApiKeyAuth
+func DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*domain.User)
+
+	if err := webhookSvc.DeleteSubscription(c.Request.Context(), user.ID, id); err != nil {
+		logrus.Errorf("error in deleting the webhook, err: %s", err)
+		respondWebhookError(c, err, "Failed to delete the webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+//	@Summary		List Webhook Deliveries API
+//	@Description	List the deliveries of a webhook and the outcome of their latest attempt, newest first
+//	@Tags			webhook
+//	@Produce		json
+//
+//	@Param			id			path		string	true	"webhook id"
+//	@Param			page		query		int		false	"page number, starting at 1"
+//	@Param			page_size	query		int		false	"number of deliveries per page, at most 100"
+//
+//	@Success		200			{object}	string
+//	@Failure		400			{string}	httputil.HTTPError
+//	@Failure		404			{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks/{id}/deliveries [get]
+//	@Security		ApiKeyAuth
+func ListWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	page, pageSize, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	deliveries, total, err := webhookSvc.ListDeliveries(c.Request.Context(), user.ID, id, page, pageSize)
+	if err != nil {
+		logrus.Errorf("error in listing the webhook deliveries, err: %s", err)
+		respondWebhookError(c, err, "Unable to list the deliveries")
+		return
+	}
+
+	items := make([]deliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		items = append(items, newDeliveryResponse(&deliveries[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": items,
+		"page":       page,
+		"page_size":  pageSize,
+		"total":      total,
+	})
+}
+
+//	@Summary		Redeliver Webhook API
+//	@Description	Send a delivery again right away and return the outcome
+//	@Tags			webhook
+//	@Produce		json
+//
+//	@Param			id			path		string	true	"webhook id"
+//	@Param			delivery_id	path		string	true	"delivery id to send again"
+//
+//	@Success		200			{object}	string
+//	@Failure		404			{string}	httputil.HTTPError
+//	@Failure		409			{string}	httputil.HTTPError
+//	@Router			/api/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+//	@Security		ApiKeyAuth
+func RedeliverWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	user := c.MustGet("user").(*domain.User)
+
+	delivery, err := webhookSvc.Redeliver(c.Request.Context(), user.ID, id, deliveryID)
+	if err != nil {
+		logrus.Errorf("error in redelivering the webhook, err: %s", err)
+		respondWebhookError(c, err, "Error in redelivering the webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, newDeliveryResponse(delivery))
+}
+
+func webhookID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWebhookError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	} else if errors.Is(err, repository.ErrDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+	} else if errors.Is(err, service.ErrInvalidWebhookURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must be an absolute http or https URL"})
+	} else if errors.Is(err, service.ErrInvalidEventTypes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event types must list at least one of wallet.credited, wallet.debited, transfer.completed and user.logged_in"})
+	} else if errors.Is(err, service.ErrWeakWebhookSecret) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook secret must be at least 16 characters long"})
+	} else if errors.Is(err, service.ErrDeliveryInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery is being sent"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
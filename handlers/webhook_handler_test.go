@@ -0,0 +1,294 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/handlers"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookService struct {
+	mock.Mock
+}
+
+func (m *MockWebhookService) CreateSubscription(ctx context.Context, userID uint64, url, secret string, eventTypes []string) (*domain.WebhookSubscription, error) {
+	args := m.Called(userID, url, secret, eventTypes)
+	subscription, _ := args.Get(0).(*domain.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookService) ListSubscriptions(ctx context.Context, userID uint64) ([]domain.WebhookSubscription, error) {
+	args := m.Called(userID)
+	subscriptions, _ := args.Get(0).([]domain.WebhookSubscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockWebhookService) GetSubscription(ctx context.Context, userID, id uint64) (*domain.WebhookSubscription, error) {
+	args := m.Called(userID, id)
+	subscription, _ := args.Get(0).(*domain.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookService) UpdateSubscription(ctx context.Context, userID, id uint64, update service.WebhookUpdate) (*domain.WebhookSubscription, error) {
+	args := m.Called(userID, id, update)
+	subscription, _ := args.Get(0).(*domain.WebhookSubscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockWebhookService) DeleteSubscription(ctx context.Context, userID, id uint64) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookService) ListDeliveries(ctx context.Context, userID, subscriptionID uint64, page, pageSize int) ([]domain.WebhookDelivery, int64, error) {
+	args := m.Called(userID, subscriptionID, page, pageSize)
+	deliveries, _ := args.Get(0).([]domain.WebhookDelivery)
+	return deliveries, args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockWebhookService) Redeliver(ctx context.Context, userID, subscriptionID, deliveryID uint64) (*domain.WebhookDelivery, error) {
+	args := m.Called(userID, subscriptionID, deliveryID)
+	delivery, _ := args.Get(0).(*domain.WebhookDelivery)
+	return delivery, args.Error(1)
+}
+
+func newWebhookRouter() *gin.Engine {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: "user1"})
+		c.Next()
+	})
+	r.POST("/webhooks", handlers.CreateWebhook)
+	r.GET("/webhooks", handlers.ListWebhooks)
+	r.GET("/webhooks/:id", handlers.GetWebhook)
+	r.PATCH("/webhooks/:id", handlers.UpdateWebhook)
+	r.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+	r.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+	r.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhook)
+	return r
+}
+
+func newTestWebhook() *domain.WebhookSubscription {
+	subscription := &domain.WebhookSubscription{
+		ID:         5,
+		UserID:     1,
+		URL:        "https://example.com/hook",
+		Secret:     "0123456789abcdef",
+		EventTypes: "wallet.credited,wallet.debited",
+		Active:     true,
+	}
+	subscription.CreatedAt = time.Date(2023, 4, 8, 12, 0, 0, 0, time.UTC)
+	return subscription
+}
+
+func TestCreateWebhook(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		mockWebhookSvc.On("CreateSubscription", uint64(1), "https://example.com/hook", "", []string{"wallet.credited", "wallet.debited"}).Return(newTestWebhook(), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"url": "https://example.com/hook", "event_types": ["wallet.credited", "wallet.debited"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{
+			"id": 5,
+			"url": "https://example.com/hook",
+			"event_types": ["wallet.credited", "wallet.debited"],
+			"active": true,
+			"secret": "0123456789abcdef",
+			"consecutive_failures": 0,
+			"created_at": "2023-04-08T12:00:00Z"
+		}`, w.Body.String())
+		mockWebhookSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		mockWebhookSvc.On("CreateSubscription", uint64(1), "example.com", "", []string{"wallet.credited"}).Return(nil, service.ErrInvalidWebhookURL).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"url": "example.com", "event_types": ["wallet.credited"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error": "Webhook URL must be an absolute http or https URL"}`, w.Body.String())
+	})
+}
+
+func TestGetWebhook(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("secret is not returned", func(t *testing.T) {
+		mockWebhookSvc.On("GetSubscription", uint64(1), uint64(5)).Return(newTestWebhook(), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/webhooks/5", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockWebhookSvc.On("GetSubscription", uint64(1), uint64(9)).Return(nil, repository.ErrWebhookNotFound).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/webhooks/9", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error": "Webhook not found"}`, w.Body.String())
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/webhooks/abc", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error": "Invalid webhook ID"}`, w.Body.String())
+	})
+}
+
+func TestUpdateWebhook(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	active := true
+	mockWebhookSvc.On("UpdateSubscription", uint64(1), uint64(5), service.WebhookUpdate{Active: &active}).Return(newTestWebhook(), nil).Once()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/webhooks/5", strings.NewReader(`{"active": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	newWebhookRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+	mockWebhookSvc.AssertExpectations(t)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	mockWebhookSvc.On("DeleteSubscription", uint64(1), uint64(5)).Return(nil).Once()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/webhooks/5", nil)
+	newWebhookRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockWebhookSvc.AssertExpectations(t)
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		delivery := domain.WebhookDelivery{
+			ID:             7,
+			EventID:        3,
+			EventType:      "wallet.credited",
+			Status:         domain.WebhookDeliveryPending,
+			Attempts:       1,
+			NextAttemptAt:  time.Date(2023, 4, 8, 12, 1, 0, 0, time.UTC),
+			LastStatusCode: 500,
+			LastError:      "endpoint responded with 500 Internal Server Error",
+		}
+		delivery.CreatedAt = time.Date(2023, 4, 8, 12, 0, 0, 0, time.UTC)
+		mockWebhookSvc.On("ListDeliveries", uint64(1), uint64(5), 2, 10).Return([]domain.WebhookDelivery{delivery}, int64(11), nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/webhooks/5/deliveries?page=2&page_size=10", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{
+			"deliveries": [{
+				"id": 7,
+				"event_id": 3,
+				"event_type": "wallet.credited",
+				"status": "pending",
+				"attempts": 1,
+				"next_attempt_at": "2023-04-08T12:01:00Z",
+				"last_status_code": 500,
+				"last_error": "endpoint responded with 500 Internal Server Error",
+				"created_at": "2023-04-08T12:00:00Z"
+			}],
+			"page": 2,
+			"page_size": 10,
+			"total": 11
+		}`, w.Body.String())
+		mockWebhookSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid page size", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/webhooks/5/deliveries?page_size=1000", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error": "Invalid page size"}`, w.Body.String())
+	})
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	mockWebhookSvc := new(MockWebhookService)
+	handlers.InitWebhookHandlers(mockWebhookSvc)
+	gin.SetMode(gin.TestMode)
+
+	t.Run("happy case", func(t *testing.T) {
+		deliveredAt := time.Date(2023, 4, 8, 12, 5, 0, 0, time.UTC)
+		delivery := &domain.WebhookDelivery{
+			ID:             7,
+			EventID:        3,
+			EventType:      "wallet.credited",
+			Status:         domain.WebhookDeliverySucceeded,
+			Attempts:       2,
+			LastStatusCode: 200,
+			DeliveredAt:    &deliveredAt,
+		}
+		mockWebhookSvc.On("Redeliver", uint64(1), uint64(5), uint64(7)).Return(delivery, nil).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhooks/5/deliveries/7/redeliver", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"succeeded"`)
+		assert.NotContains(t, w.Body.String(), "next_attempt_at")
+		mockWebhookSvc.AssertExpectations(t)
+	})
+
+	t.Run("delivery not found", func(t *testing.T) {
+		mockWebhookSvc.On("Redeliver", uint64(1), uint64(5), uint64(9)).Return(nil, repository.ErrDeliveryNotFound).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/webhooks/5/deliveries/9/redeliver", nil)
+		newWebhookRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error": "Delivery not found"}`, w.Body.String())
+	})
+}
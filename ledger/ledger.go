@@ -0,0 +1,404 @@
+// Package ledger keeps double-entry books of all money moving through the
+// wallets. Every movement is a journal entry whose postings debit and credit
+// accounts by the same amount, and wallet balances are a projection of the
+// postings on the wallet's account.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnbalanced = errors.New("journal entry is not balanced")
+var ErrInvalidPosting = errors.New("postings need a positive amount")
+
+// AccountRef names the account of a posting: either a wallet's account or a
+// system account of a kind and currency.
+type AccountRef struct {
+	WalletID uint64
+	Kind     Kind
+	Currency string
+}
+
+func WalletAccount(walletID uint64) AccountRef {
+	return AccountRef{WalletID: walletID, Kind: KindWallet}
+}
+
+func SystemAccount(kind Kind, currency string) AccountRef {
+	return AccountRef{Kind: kind, Currency: currency}
+}
+
+type line struct {
+	ref    AccountRef
+	side   Side
+	amount decimal.Decimal
+}
+
+// Entry is a journal entry that has not been posted yet.
+type Entry struct {
+	reference   string
+	description string
+	lines       []line
+	allowFrozen bool
+}
+
+func NewEntry(reference, description string) *Entry {
+	return &Entry{reference: reference, description: description}
+}
+
+func (e *Entry) Debit(ref AccountRef, amount decimal.Decimal) *Entry {
+	e.lines = append(e.lines, line{ref: ref, side: Debit, amount: amount})
+	return e
+}
+
+func (e *Entry) Credit(ref AccountRef, amount decimal.Decimal) *Entry {
+	e.lines = append(e.lines, line{ref: ref, side: Credit, amount: amount})
+	return e
+}
+
+// AllowFrozen lets the entry post to frozen wallets, which is reserved for
+// corrections made by operators.
+func (e *Entry) AllowFrozen() *Entry {
+	e.allowFrozen = true
+	return e
+}
+
+type Ledger struct {
+	wallets repository.WalletRepository
+}
+
+// New returns a Ledger which keeps the balances of wallets up to date
+// through the wallet repository.
+func New(wallets repository.WalletRepository) *Ledger {
+	return &Ledger{wallets: wallets}
+}
+
+// Post records the entry inside tx and applies it to the balances of the
+// wallets it touches, which are returned by ID. The wallets are locked in ID
+// order, so that two entries touching the same wallets cannot deadlock. A
+// wallet balance is never allowed to go below zero, and frozen wallets are
+// refused with repository.ErrWalletFrozen. The caller must
+// invalidate the cache of the wallets once tx is committed.
+func (l *Ledger) Post(tx *gorm.DB, e *Entry) (map[uint64]*domain.Wallet, error) {
+	if len(e.lines) < 2 {
+		return nil, ErrUnbalanced
+	}
+
+	var walletIDs []uint64
+	seen := map[uint64]bool{}
+	for _, ln := range e.lines {
+		if ln.amount.Sign() <= 0 {
+			return nil, ErrInvalidPosting
+		}
+		if ln.ref.Kind == KindWallet && !seen[ln.ref.WalletID] {
+			seen[ln.ref.WalletID] = true
+			walletIDs = append(walletIDs, ln.ref.WalletID)
+		}
+	}
+	sort.Slice(walletIDs, func(i, j int) bool { return walletIDs[i] < walletIDs[j] })
+
+	accounts := map[AccountRef]*Account{}
+	for _, id := range walletIDs {
+		wallet, err := l.wallets.GetWalletForUpdate(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if wallet.Frozen() && !e.allowFrozen {
+			return nil, repository.ErrWalletFrozen
+		}
+		account, err := l.walletAccount(tx, wallet)
+		if err != nil {
+			return nil, err
+		}
+		accounts[WalletAccount(id)] = account
+	}
+
+	entry := &JournalEntry{Reference: e.reference, Description: e.description}
+	deltas := map[uint64]decimal.Decimal{}
+	for _, ln := range e.lines {
+		account, ok := accounts[ln.ref]
+		if !ok {
+			var err error
+			account, err = l.systemAccount(tx, ln.ref.Kind, ln.ref.Currency)
+			if err != nil {
+				return nil, err
+			}
+			accounts[ln.ref] = account
+		}
+
+		entry.Postings = append(entry.Postings, Posting{
+			AccountID: account.ID,
+			Side:      ln.side,
+			Amount:    ln.amount,
+			Currency:  account.Currency,
+		})
+
+		if account.WalletID != nil {
+			deltas[*account.WalletID] = deltas[*account.WalletID].Add(signed(ln.side, ln.amount))
+		}
+	}
+
+	if err := checkBalanced(entry.Postings); err != nil {
+		return nil, err
+	}
+
+	wallets := make(map[uint64]*domain.Wallet, len(walletIDs))
+	for _, id := range walletIDs {
+		wallet, err := l.wallets.AdjustBalance(tx, id, deltas[id])
+		if err != nil {
+			return nil, err
+		}
+		wallets[id] = wallet
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+// WalletBalance sums the postings of the wallet's account. A wallet that has
+// not been posted to yet has no account, its balance is the one its account
+// will be opened with, like VerifyWalletBalances assumes.
+func (l *Ledger) WalletBalance(tx *gorm.DB, wallet *domain.Wallet) (decimal.Decimal, error) {
+	account := &Account{}
+	err := tx.Where("wallet_id = ?", wallet.ID).First(account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return wallet.Balance, nil
+		}
+		return decimal.Zero, err
+	}
+	return accountBalance(tx, account.ID)
+}
+
+// RebuildWalletBalances recomputes the balance of every wallet that has an
+// account from its postings and overwrites the stored balance where it
+// differs. It returns the IDs of the wallets that were corrected.
+func (l *Ledger) RebuildWalletBalances(db *gorm.DB) ([]uint64, error) {
+	var accounts []Account
+	if err := db.Where("kind = ?", KindWallet).Order("wallet_id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	var corrected []uint64
+	for _, account := range accounts {
+		walletID := *account.WalletID
+
+		fixed := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			wallet, err := l.wallets.GetWalletForUpdate(tx, walletID)
+			if err != nil {
+				return err
+			}
+			balance, err := accountBalance(tx, account.ID)
+			if err != nil {
+				return err
+			}
+			if balance.Equal(wallet.Balance) {
+				return nil
+			}
+			fixed = true
+			return l.wallets.UpdateWallet(tx, walletID, balance)
+		})
+		if err != nil {
+			return corrected, fmt.Errorf("rebuilding wallet %d: %w", walletID, err)
+		}
+
+		if fixed {
+			l.wallets.InvalidateCache(db.Statement.Context, walletID)
+			corrected = append(corrected, walletID)
+		}
+	}
+	return corrected, nil
+}
+
+// Mismatch is a wallet whose stored balance differs from its postings.
+type Mismatch struct {
+	WalletID      uint64
+	Balance       decimal.Decimal
+	LedgerBalance decimal.Decimal
+}
+
+// VerifyWalletBalances compares the stored balance of every wallet that has
+// an account with the sum of its postings, without changing anything.
+// RebuildWalletBalances fixes the mismatches it reports.
+func (l *Ledger) VerifyWalletBalances(db *gorm.DB) ([]Mismatch, error) {
+	var accounts []Account
+	if err := db.Where("kind = ?", KindWallet).Order("wallet_id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	for _, account := range accounts {
+		walletID := *account.WalletID
+
+		// Locked, so that an entry posted meanwhile is not reported
+		err := db.Transaction(func(tx *gorm.DB) error {
+			wallet, err := l.wallets.GetWalletForUpdate(tx, walletID)
+			if err != nil {
+				return err
+			}
+			balance, err := accountBalance(tx, account.ID)
+			if err != nil {
+				return err
+			}
+			if !balance.Equal(wallet.Balance) {
+				mismatches = append(mismatches, Mismatch{WalletID: walletID, Balance: wallet.Balance, LedgerBalance: balance})
+			}
+			return nil
+		})
+		if err != nil {
+			return mismatches, fmt.Errorf("verifying wallet %d: %w", walletID, err)
+		}
+	}
+	return mismatches, nil
+}
+
+// CheckInvariant makes sure that every journal entry debits and credits each
+// of its currencies by the same amount, which keeps the books as a whole
+// balanced.
+func CheckInvariant(db *gorm.DB) error {
+	var rows []struct {
+		EntryID  uint64
+		Currency string
+		Debits   decimal.Decimal
+		Credits  decimal.Decimal
+	}
+
+	err := db.Model(&Posting{}).
+		Select("entry_id, currency, "+
+			"SUM(CASE WHEN side = ? THEN amount ELSE 0 END) AS debits, "+
+			"SUM(CASE WHEN side = ? THEN amount ELSE 0 END) AS credits", Debit, Credit).
+		Group("entry_id, currency").
+		Having("SUM(CASE WHEN side = ? THEN amount ELSE -amount END) <> 0", Debit).
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	if len(rows) > 0 {
+		r := rows[0]
+		return fmt.Errorf("%w: %d entries, e.g. entry %d debits %s %s and credits %s %s",
+			ErrUnbalanced, len(rows), r.EntryID, r.Debits, r.Currency, r.Credits, r.Currency)
+	}
+	return nil
+}
+
+// walletAccount returns the wallet's account and opens it on first use. A
+// wallet that already has a balance at that point gets it booked against
+// suspense, so that its postings add up to its balance. The wallet must be
+// locked by tx.
+func (l *Ledger) walletAccount(tx *gorm.DB, wallet *domain.Wallet) (*Account, error) {
+	account := &Account{}
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("wallet_id = ?", wallet.ID).First(account).Error
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	walletID := wallet.ID
+	account = &Account{
+		Code:     fmt.Sprintf("%s:%d", KindWallet, wallet.ID),
+		Kind:     KindWallet,
+		Currency: wallet.Currency,
+		WalletID: &walletID,
+	}
+	if err := tx.Create(account).Error; err != nil {
+		return nil, err
+	}
+
+	if wallet.Balance.Sign() > 0 {
+		suspense, err := l.systemAccount(tx, KindSuspense, wallet.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		opening := &JournalEntry{
+			Reference:   fmt.Sprintf("opening_%d", wallet.ID),
+			Description: "opening balance",
+			Postings: []Posting{
+				{AccountID: suspense.ID, Side: Debit, Amount: wallet.Balance, Currency: wallet.Currency},
+				{AccountID: account.ID, Side: Credit, Amount: wallet.Balance, Currency: wallet.Currency},
+			},
+		}
+		if err := tx.Create(opening).Error; err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// systemAccount returns the system account of the kind and currency and
+// creates it on first use.
+func (l *Ledger) systemAccount(tx *gorm.DB, kind Kind, currency string) (*Account, error) {
+	code := fmt.Sprintf("%s:%s", kind, currency)
+
+	account := &Account{}
+	err := tx.Where("code = ?", code).First(account).Error
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Another transaction may be creating the same account right now
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Account{Code: code, Kind: kind, Currency: currency}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// A locking read sees the row even if it was committed after tx started
+	account = &Account{}
+	err = tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("code = ?", code).First(account).Error
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// accountBalance returns credits minus debits, which is the balance of the
+// wallet accounts.
+func accountBalance(tx *gorm.DB, accountID uint64) (decimal.Decimal, error) {
+	var balance decimal.NullDecimal
+	err := tx.Model(&Posting{}).
+		Select("SUM(CASE WHEN side = ? THEN amount ELSE -amount END)", Credit).
+		Where("account_id = ?", accountID).
+		Scan(&balance).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return balance.Decimal, nil
+}
+
+func checkBalanced(postings []Posting) error {
+	sums := map[string]decimal.Decimal{}
+	for _, p := range postings {
+		sums[p.Currency] = sums[p.Currency].Add(signed(p.Side, p.Amount))
+	}
+
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s is off by %s", ErrUnbalanced, currency, sum)
+		}
+	}
+	return nil
+}
+
+// signed returns amount as credits minus debits.
+func signed(side Side, amount decimal.Decimal) decimal.Decimal {
+	if side == Debit {
+		return amount.Neg()
+	}
+	return amount
+}
@@ -0,0 +1,200 @@
+package ledger_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestLedger(t *testing.T) (*ledger.Ledger, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&domain.User{}, &domain.Wallet{}))
+	require.NoError(t, db.AutoMigrate(ledger.Models()...))
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	require.NoError(t, db.Create(&domain.User{ID: 1, Username: "user1", Password: "hash"}).Error)
+	return ledger.New(repository.NewWalletMySQLRepository(db, cache)), db
+}
+
+func post(t *testing.T, db *gorm.DB, books *ledger.Ledger, entry *ledger.Entry) (map[uint64]*domain.Wallet, error) {
+	t.Helper()
+
+	tx := db.Begin()
+	wallets, err := books.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	require.NoError(t, tx.Commit().Error)
+	return wallets, nil
+}
+
+func TestPost(t *testing.T) {
+	books, db := newTestLedger(t)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	cash := ledger.SystemAccount(ledger.KindCash, "EUR")
+	wallets, err := post(t, db, books, ledger.NewEntry("credit_1", "credit").
+		Debit(cash, decimal.NewFromInt(50)).
+		Credit(ledger.WalletAccount(1), decimal.NewFromInt(50)))
+	require.NoError(t, err)
+	assert.True(t, wallets[1].Balance.Equal(decimal.NewFromInt(50)), "balance is %s", wallets[1].Balance)
+
+	wallets, err = post(t, db, books, ledger.NewEntry("transfer_1", "transfer").
+		Debit(ledger.WalletAccount(1), decimal.NewFromInt(20)).
+		Credit(ledger.WalletAccount(2), decimal.NewFromInt(20)))
+	require.NoError(t, err)
+	assert.True(t, wallets[1].Balance.Equal(decimal.NewFromInt(30)), "balance is %s", wallets[1].Balance)
+	assert.True(t, wallets[2].Balance.Equal(decimal.NewFromInt(20)), "balance is %s", wallets[2].Balance)
+
+	_, err = post(t, db, books, ledger.NewEntry("debit_1", "debit").
+		Debit(ledger.WalletAccount(1), decimal.NewFromInt(31)).
+		Credit(cash, decimal.NewFromInt(31)))
+	assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+	balance, err := books.WalletBalance(db, wallets[1])
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(30)), "ledger balance is %s", balance)
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestPostRejectsUnbalancedEntries(t *testing.T) {
+	books, db := newTestLedger(t)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	_, err := post(t, db, books, ledger.NewEntry("credit_1", "credit").
+		Debit(ledger.SystemAccount(ledger.KindCash, "EUR"), decimal.NewFromInt(50)).
+		Credit(ledger.WalletAccount(1), decimal.NewFromInt(40)))
+	assert.ErrorIs(t, err, ledger.ErrUnbalanced)
+
+	// Same amount, but not the same currency
+	_, err = post(t, db, books, ledger.NewEntry("credit_2", "credit").
+		Debit(ledger.SystemAccount(ledger.KindCash, "USD"), decimal.NewFromInt(50)).
+		Credit(ledger.WalletAccount(1), decimal.NewFromInt(50)))
+	assert.ErrorIs(t, err, ledger.ErrUnbalanced)
+
+	_, err = post(t, db, books, ledger.NewEntry("credit_3", "credit").
+		Credit(ledger.WalletAccount(1), decimal.NewFromInt(50)))
+	assert.ErrorIs(t, err, ledger.ErrUnbalanced)
+
+	_, err = post(t, db, books, ledger.NewEntry("credit_4", "credit").
+		Debit(ledger.SystemAccount(ledger.KindCash, "EUR"), decimal.Zero).
+		Credit(ledger.WalletAccount(1), decimal.Zero))
+	assert.ErrorIs(t, err, ledger.ErrInvalidPosting)
+
+	var count int64
+	require.NoError(t, db.Model(&ledger.Posting{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestOpeningBalanceAndRebuild(t *testing.T) {
+	books, db := newTestLedger(t)
+	// A wallet from before the ledger existed
+	wallet := &domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}
+	require.NoError(t, db.Create(wallet).Error)
+
+	// Its balance matches until the account is opened with it
+	balance, err := books.WalletBalance(db, wallet)
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(100)), "ledger balance is %s", balance)
+
+	wallets, err := post(t, db, books, ledger.NewEntry("credit_1", "credit").
+		Debit(ledger.SystemAccount(ledger.KindCash, "EUR"), decimal.NewFromInt(5)).
+		Credit(ledger.WalletAccount(1), decimal.NewFromInt(5)))
+	require.NoError(t, err)
+	assert.True(t, wallets[1].Balance.Equal(decimal.NewFromInt(105)), "balance is %s", wallets[1].Balance)
+
+	balance, err = books.WalletBalance(db, wallets[1])
+	require.NoError(t, err)
+	assert.True(t, balance.Equal(decimal.NewFromInt(105)), "ledger balance is %s", balance)
+
+	// The stored balance drifts from the books, e.g. by a manual update
+	require.NoError(t, db.Model(&domain.Wallet{}).Where("id = ?", 1).Update("balance", decimal.NewFromInt(7)).Error)
+
+	mismatches, err := books.VerifyWalletBalances(db)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, uint64(1), mismatches[0].WalletID)
+	assert.True(t, mismatches[0].Balance.Equal(decimal.NewFromInt(7)), "balance is %s", mismatches[0].Balance)
+	assert.True(t, mismatches[0].LedgerBalance.Equal(decimal.NewFromInt(105)), "ledger balance is %s", mismatches[0].LedgerBalance)
+
+	corrected, err := books.RebuildWalletBalances(db)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, corrected)
+
+	wallet = &domain.Wallet{}
+	require.NoError(t, db.First(wallet, 1).Error)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(105)), "rebuilt balance is %s", wallet.Balance)
+
+	corrected, err = books.RebuildWalletBalances(db)
+	require.NoError(t, err)
+	assert.Empty(t, corrected)
+
+	mismatches, err = books.VerifyWalletBalances(db)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestPostToFrozenWallet(t *testing.T) {
+	books, db := newTestLedger(t)
+	frozenAt := time.Now()
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1, FrozenAt: &frozenAt}).Error)
+
+	credit := func(reference string) *ledger.Entry {
+		return ledger.NewEntry(reference, "credit").
+			Debit(ledger.SystemAccount(ledger.KindCash, "EUR"), decimal.NewFromInt(5)).
+			Credit(ledger.WalletAccount(1), decimal.NewFromInt(5))
+	}
+
+	_, err := post(t, db, books, credit("credit_1"))
+	assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+
+	wallets, err := post(t, db, books, credit("adjustment_1").AllowFrozen())
+	require.NoError(t, err)
+	assert.True(t, wallets[1].Balance.Equal(decimal.NewFromInt(5)), "balance is %s", wallets[1].Balance)
+}
+
+func TestCheckInvariant(t *testing.T) {
+	_, db := newTestLedger(t)
+
+	account := &ledger.Account{Code: "cash:EUR", Kind: ledger.KindCash, Currency: "EUR"}
+	require.NoError(t, db.Create(account).Error)
+	require.NoError(t, db.Create(&ledger.JournalEntry{
+		Reference: "broken",
+		Postings: []ledger.Posting{
+			{AccountID: account.ID, Side: ledger.Debit, Amount: decimal.NewFromInt(10), Currency: "EUR"},
+			{AccountID: account.ID, Side: ledger.Credit, Amount: decimal.NewFromInt(9), Currency: "EUR"},
+		},
+	}).Error)
+
+	assert.ErrorIs(t, ledger.CheckInvariant(db), ledger.ErrUnbalanced)
+}
@@ -0,0 +1,82 @@
+package ledger
+
+import (
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Kind tells what an account is used for.
+type Kind string
+
+const (
+	// KindWallet is a user's wallet. What we owe the user, so credits raise it.
+	KindWallet Kind = "wallet"
+	// KindCash is the money that entered or left the system through credits and debits.
+	KindCash Kind = "cash"
+	// KindFees collects what we earn, e.g. the spread on conversions.
+	KindFees Kind = "fees"
+	// KindSuspense balances amounts of unknown origin, e.g. wallet balances
+	// that existed before the ledger did.
+	KindSuspense Kind = "suspense"
+	// KindFX is the position we take when converting between currencies.
+	KindFX Kind = "fx"
+	// KindAdjustment balances the corrections operators make to wallet
+	// balances by hand.
+	KindAdjustment Kind = "adjustment"
+)
+
+type Side string
+
+const (
+	Debit  Side = "debit"
+	Credit Side = "credit"
+)
+
+// Account holds postings of a single currency. There is one account per
+// wallet and one system account per kind and currency.
+type Account struct {
+	gorm.Model
+	ID       uint64  `gorm:"primaryKey"`
+	Code     string  `gorm:"type:varchar(64);uniqueIndex;not null"` // e.g. wallet:12 or cash:EUR
+	Kind     Kind    `gorm:"type:varchar(16);not null"`
+	Currency string  `gorm:"type:char(3);not null"`
+	WalletID *uint64 `gorm:"uniqueIndex"`
+}
+
+func (Account) TableName() string {
+	return "ledger_accounts"
+}
+
+// JournalEntry is a single movement of money. Per currency its debits always
+// equal its credits.
+type JournalEntry struct {
+	gorm.Model
+	ID          uint64    `gorm:"primaryKey"`
+	Reference   string    `gorm:"type:varchar(255);index"`
+	Description string    `gorm:"type:varchar(255)"`
+	Postings    []Posting `gorm:"foreignKey:EntryID"`
+}
+
+func (JournalEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// Posting debits or credits one account as part of a journal entry.
+type Posting struct {
+	gorm.Model
+	ID        uint64          `gorm:"primaryKey"`
+	EntryID   uint64          `gorm:"index;not null"`
+	AccountID uint64          `gorm:"index;not null"`
+	Side      Side            `gorm:"type:varchar(6);not null"`
+	Amount    decimal.Decimal `gorm:"type:decimal(64,8);not null"`
+	Currency  string          `gorm:"type:char(3);not null"`
+}
+
+func (Posting) TableName() string {
+	return "ledger_postings"
+}
+
+// Models are the tables of the ledger, in the order they can be migrated.
+func Models() []interface{} {
+	return []interface{}{&Account{}, &JournalEntry{}, &Posting{}}
+}
@@ -0,0 +1,107 @@
+// Package metrics holds the Prometheus metrics of the service and serves them
+// on /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+)
+
+const namespace = "quick"
+
+// Cache results
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	walletOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wallet",
+		Name:      "operations_total",
+		Help:      "Completed credits, debits and transfers by currency.",
+	}, []string{"operation", "currency"})
+
+	walletAmounts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wallet",
+		Name:      "operation_amount_total",
+		Help:      "Sum of the amounts of completed credits, debits and transfers by currency, transfers in the source currency.",
+	}, []string{"operation", "currency"})
+
+	walletFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "wallet",
+		Name:      "operation_failures_total",
+		Help:      "Failed credits, debits and transfers by the kind of error.",
+	}, []string{"operation", "reason"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by cache and result: hit, miss or error.",
+	}, []string{"cache", "result"})
+)
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func WalletOperationSucceeded(operation, currency string, amount decimal.Decimal) {
+	walletOperations.WithLabelValues(operation, currency).Inc()
+	walletAmounts.WithLabelValues(operation, currency).Add(amount.InexactFloat64())
+}
+
+func WalletOperationFailed(operation, reason string) {
+	walletFailures.WithLabelValues(operation, reason).Inc()
+}
+
+// CacheLookup counts a lookup in cache with result CacheHit, CacheMiss or
+// CacheError.
+func CacheLookup(cache, result string) {
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// RegisterDBStats exports the statistics of the connection pool as gauges and
+// counters labelled with name. Registering a pool again does nothing.
+func RegisterDBStats(db *sql.DB, name string) error {
+	err := prometheus.Register(collectors.NewDBStatsCollector(db, name))
+	if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+		return nil
+	}
+	return err
+}
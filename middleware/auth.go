@@ -1,23 +1,15 @@
 package middleware
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
 	"github.com/mohammadrabetian/quick/service"
+	"github.com/sirupsen/logrus"
 )
 
-func GenerateSecureToken() (string, error) {
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(tokenBytes), nil
-}
-
 func Auth(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -35,14 +27,54 @@ func Auth(userService *service.UserService) gin.HandlerFunc {
 		}
 
 		token := splitToken[1]
-		user, _ := userService.GetUserByToken(token)
-		if user == nil { // Check if the user is nil
+		user, sessionID, err := userService.AuthenticateToken(c.Request.Context(), token)
+		if err != nil {
+			logrus.Errorf("error in authenticating the token, err: %s", err)
+		}
+		if user == nil { // Unknown, revoked or expired token
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
 		c.Set("user", user)
+		c.Set("session_id", sessionID)
+		c.Next()
+	}
+}
+
+// Admin only lets the users named in usernames through, others get 403. It
+// must run after Auth.
+func Admin(usernames []string) gin.HandlerFunc {
+	admins := adminSet(usernames)
+
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*domain.User)
+		if !admins[domain.NormalizeUsername(user.Username)] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
+
+// MarkAdmin sets "admin" for the users named in usernames and lets everyone
+// through, for handlers which allow admins more. It must run after Auth.
+func MarkAdmin(usernames []string) gin.HandlerFunc {
+	admins := adminSet(usernames)
+
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*domain.User)
+		c.Set("admin", admins[domain.NormalizeUsername(user.Username)])
+		c.Next()
+	}
+}
+
+func adminSet(usernames []string) map[string]bool {
+	admins := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		admins[domain.NormalizeUsername(username)] = true
+	}
+	return admins
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/sirupsen/logrus"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder keeps a copy of everything written to the client.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the stored response for requests that repeat an
+// Idempotency-Key already used by the same user. It must run after Auth.
+// Requests without the header are passed through untouched.
+func Idempotency(store repository.IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		user := c.MustGet("user").(*domain.User)
+		ctx := c.Request.Context()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashRequest(c.Request.Method, c.Request.URL.Path, body)
+
+		record, err := store.GetRecord(ctx, user.ID, key)
+		if err != nil {
+			logrus.Errorf("error in retrieving the idempotency record, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to process the request"})
+			c.Abort()
+			return
+		}
+		if record != nil {
+			replay(c, record, requestHash)
+			return
+		}
+
+		owner, locked, err := store.Lock(ctx, user.ID, key)
+		if err != nil {
+			logrus.Errorf("error in locking the idempotency key, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to process the request"})
+			c.Abort()
+			return
+		}
+		if !locked {
+			c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is already in progress"})
+			c.Abort()
+			return
+		}
+		// Once the handler has run, its outcome is stored and the key released
+		// even if the client has gone away in the meantime
+		done := util.WithoutCancel(ctx)
+		defer store.Unlock(done, user.ID, key, owner)
+
+		// The first request might have finished between the lookup and the lock
+		record, err = store.GetRecord(ctx, user.ID, key)
+		if err != nil {
+			logrus.Errorf("error in retrieving the idempotency record, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to process the request"})
+			c.Abort()
+			return
+		}
+		if record != nil {
+			replay(c, record, requestHash)
+			return
+		}
+
+		// The record is created before the handler runs, so a request whose
+		// response cannot be stored afterwards is never executed again
+		record = &domain.IdempotencyRecord{
+			UserID:         user.ID,
+			IdempotencyKey: key,
+			RequestHash:    requestHash,
+		}
+		if err := store.CreateRecord(ctx, record); err != nil {
+			logrus.Errorf("error in creating the idempotency record, err: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to process the request"})
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not stored, so the client can retry them
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := store.DeleteRecord(done, user.ID, key); err != nil {
+				logrus.Errorf("error in deleting the idempotency record, err: %s", err)
+			}
+			return
+		}
+
+		record.StatusCode = status
+		record.ResponseBody = recorder.body.Bytes()
+		if err := store.CompleteRecord(done, record); err != nil {
+			logrus.Errorf("error in saving the idempotency record, retries of the key are rejected, err: %s", err)
+		}
+	}
+}
+
+func replay(c *gin.Context, record *domain.IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		c.Abort()
+		return
+	}
+
+	// The request is still running, or its response was lost
+	if record.StatusCode == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is in progress or its outcome is unknown"})
+		c.Abort()
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.StatusCode, "application/json; charset=utf-8", record.ResponseBody)
+	c.Abort()
+}
+
+func hashRequest(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,208 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+	locks   map[string]string
+	owners  int
+
+	// failLookup fails the lookups of this key after the first one
+	failLookup string
+	lookups    int
+	// failComplete fails storing the responses
+	failComplete bool
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{
+		records: map[string]*domain.IdempotencyRecord{},
+		locks:   map[string]string{},
+	}
+}
+
+func (s *memoryIdempotencyStore) GetRecord(_ context.Context, userID uint64, key string) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == s.failLookup {
+		s.lookups++
+		if s.lookups > 1 {
+			return nil, errors.New("connection reset")
+		}
+	}
+	record, ok := s.records[fmt.Sprintf("%d_%s", userID, key)]
+	if !ok {
+		return nil, nil
+	}
+	stored := *record
+	return &stored, nil
+}
+
+func (s *memoryIdempotencyStore) CreateRecord(_ context.Context, record *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *record
+	s.records[fmt.Sprintf("%d_%s", record.UserID, record.IdempotencyKey)] = &stored
+	return nil
+}
+
+func (s *memoryIdempotencyStore) CompleteRecord(_ context.Context, record *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failComplete {
+		return errors.New("connection reset")
+	}
+	stored := *record
+	s.records[fmt.Sprintf("%d_%s", record.UserID, record.IdempotencyKey)] = &stored
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteRecord(_ context.Context, userID uint64, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, fmt.Sprintf("%d_%s", userID, key))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Lock(_ context.Context, userID uint64, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lockKey := fmt.Sprintf("%d_%s", userID, key)
+	if _, locked := s.locks[lockKey]; locked {
+		return "", false, nil
+	}
+	s.owners++
+	owner := fmt.Sprint(s.owners)
+	s.locks[lockKey] = owner
+	return owner, true, nil
+}
+
+func (s *memoryIdempotencyStore) Unlock(_ context.Context, userID uint64, key, owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lockKey := fmt.Sprintf("%d_%s", userID, key)
+	if s.locks[lockKey] == owner {
+		delete(s.locks, lockKey)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := newMemoryIdempotencyStore()
+
+	calls := 0
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &domain.User{ID: 1, Username: "user1"})
+		c.Next()
+	})
+	r.POST("/wallets/:wallet_id/credit", middleware.Idempotency(store), func(c *gin.Context) {
+		calls++
+		if c.Param("wallet_id") == "500" {
+			c.JSON(http.StatusInternalServerError, gin.H{"call": calls})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+
+	sendTo := func(walletID, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/wallets/"+walletID+"/credit", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send := func(key, body string) *httptest.ResponseRecorder {
+		return sendTo("1", key, body)
+	}
+
+	t.Run("first request is executed", func(t *testing.T) {
+		w := send("key-1", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"call": 1}`, w.Body.String())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("retry replays the stored response", func(t *testing.T) {
+		w := send("key-1", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"call": 1}`, w.Body.String())
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("same key with a different body is rejected", func(t *testing.T) {
+		w := send("key-1", `{"amount": "200"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("request in progress is rejected", func(t *testing.T) {
+		owner, locked, _ := store.Lock(context.Background(), 1, "key-2")
+		assert.True(t, locked)
+		defer store.Unlock(context.Background(), 1, "key-2", owner)
+
+		w := send("key-2", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("requests without a key are always executed", func(t *testing.T) {
+		send("", `{"amount": "100"}`)
+		send("", `{"amount": "100"}`)
+
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("failed lookup after locking is not executed", func(t *testing.T) {
+		store.failLookup = "key-3"
+		defer func() { store.failLookup = "" }()
+
+		w := send("key-3", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("server errors can be retried", func(t *testing.T) {
+		sendTo("500", "key-4", `{"amount": "100"}`)
+		w := sendTo("500", "key-4", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("request whose response was lost is not executed again", func(t *testing.T) {
+		store.failComplete = true
+		w := send("key-5", `{"amount": "100"}`)
+		store.failComplete = false
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = send("key-5", `{"amount": "100"}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, 6, calls)
+	})
+}
@@ -0,0 +1,41 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mohammadrabetian/quick/metrics"
+	"github.com/mohammadrabetian/quick/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsUseTheRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Metrics())
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		if c.Param("id") == "0" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/0"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `quick_http_requests_total{method="GET",route="/metrics-test/:id",status="200"} 2`)
+	assert.Contains(t, string(body), `quick_http_requests_total{method="GET",route="/metrics-test/:id",status="404"} 1`)
+	assert.Contains(t, string(body), `quick_http_request_duration_seconds_count{method="GET",route="/metrics-test/:id",status="200"} 2`)
+	assert.NotContains(t, string(body), `route="/metrics-test/1"`)
+}
@@ -0,0 +1,223 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/mohammadrabetian/quick/pkg/password"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// legacyMigrations convert databases created by AutoMigrate before the
+// migrations were versioned. The baseline keeps their tables as they are, so
+// these steps bring them to the schema of the baseline. Each step checks what
+// it converts, which makes them no-ops on databases the baseline created.
+//
+// The conversions cannot be undone, the data they replaced is gone, so
+// reverting them does nothing.
+func legacyMigrations() []Migration {
+	return []Migration{
+		{Version: 2, Name: "user_id_references", UpFunc: migrateUserReferences, DownFunc: irreversible},
+		{Version: 3, Name: "drop_users_token", UpFunc: dropUsersToken, DownFunc: irreversible},
+		{Version: 4, Name: "legacy_columns", UpFunc: addLegacyColumns, DownFunc: irreversible},
+		{Version: 5, Name: "hash_plaintext_passwords", UpFunc: hashPlaintextPasswords, DownFunc: irreversible},
+	}
+}
+
+func irreversible(*gorm.DB, Settings) error {
+	return nil
+}
+
+// migrateUserReferences moves wallets and transactions from referencing users
+// by username (wallets.user_id, transactions.actor) to referencing users.id.
+func migrateUserReferences(db *gorm.DB, _ Settings) error {
+	if err := migrateUserReference(db, "wallets", "user_id", "owner_id"); err != nil {
+		return err
+	}
+	if err := migrateUserReference(db, "transactions", "actor", "actor_id"); err != nil {
+		return err
+	}
+
+	if isMySQL(db) && db.Migrator().HasTable("wallets") && !db.Migrator().HasConstraint("wallets", "fk_wallets_owner") {
+		return db.Exec("ALTER TABLE `wallets` ADD CONSTRAINT `fk_wallets_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE RESTRICT ON UPDATE CASCADE").Error
+	}
+	return nil
+}
+
+func migrateUserReference(db *gorm.DB, table, usernameColumn, idColumn string) error {
+	m := db.Migrator()
+	if !m.HasTable(table) || !m.HasColumn(table, usernameColumn) {
+		return nil
+	}
+
+	if !m.HasColumn(table, idColumn) {
+		if err := addColumn(db, table, idColumn, "bigint unsigned NULL"); err != nil {
+			return err
+		}
+	}
+
+	err := db.Exec(fmt.Sprintf(
+		"UPDATE `%[1]s` SET `%[3]s` = (SELECT `id` FROM `users` WHERE `users`.`username` = `%[1]s`.`%[2]s`) WHERE `%[3]s` IS NULL",
+		table, usernameColumn, idColumn,
+	)).Error
+	if err != nil {
+		return err
+	}
+
+	var orphans int64
+	if err := db.Table(table).Where("`" + idColumn + "` IS NULL").Count(&orphans).Error; err != nil {
+		return err
+	}
+	if orphans > 0 {
+		return fmt.Errorf("%d rows in %s reference unknown usernames in %s, fix them before migrating", orphans, table, usernameColumn)
+	}
+
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", table, usernameColumn)).Error; err != nil {
+		return err
+	}
+	if err := setNotNull(db, table, idColumn, "bigint unsigned"); err != nil {
+		return err
+	}
+	if err := addIndex(db, table, idColumn); err != nil {
+		return err
+	}
+	logrus.Infof("migrated %s.%s to %s.%s", table, usernameColumn, table, idColumn)
+	return nil
+}
+
+// dropUsersToken drops the tokens stored on users, which moved to the
+// sessions table.
+func dropUsersToken(db *gorm.DB, _ Settings) error {
+	if !db.Migrator().HasColumn("users", "token") {
+		return nil
+	}
+	return db.Exec("ALTER TABLE `users` DROP COLUMN `token`").Error
+}
+
+type legacyColumn struct {
+	table      string
+	name       string
+	definition string
+	indexed    bool
+}
+
+// columnsAddedLater are the columns of the baseline that AutoMigrate added
+// after the first releases. Columns that need a backfill are handled apart.
+var columnsAddedLater = []legacyColumn{
+	{table: "users", name: "disabled_at", definition: "datetime(3) NULL"},
+	{table: "wallets", name: "held_balance", definition: "decimal(64,8) NOT NULL DEFAULT '0'"},
+	{table: "wallets", name: "frozen_at", definition: "datetime(3) NULL"},
+	{table: "transactions", name: "quote_id", definition: "bigint unsigned NULL", indexed: true},
+	{table: "transactions", name: "reversal_of_id", definition: "bigint unsigned NULL", indexed: true},
+	{table: "transactions", name: "reversed_amount", definition: "decimal(64,8) NOT NULL DEFAULT '0'"},
+}
+
+// addLegacyColumns adds the columns that databases created before wallets had
+// currencies, holds, freezing and reversals lack. Wallets without a currency
+// get the default one.
+func addLegacyColumns(db *gorm.DB, settings Settings) error {
+	m := db.Migrator()
+	for _, column := range columnsAddedLater {
+		if !m.HasTable(column.table) || m.HasColumn(column.table, column.name) {
+			continue
+		}
+		if err := addColumn(db, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+		if column.indexed {
+			if err := addIndex(db, column.table, column.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !m.HasTable("wallets") {
+		return nil
+	}
+	added := !m.HasColumn("wallets", "currency")
+	if added {
+		if err := addColumn(db, "wallets", "currency", "char(3) NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	var missing int64
+	if err := db.Table("wallets").Where("currency = ''").Count(&missing).Error; err != nil {
+		return err
+	}
+	if missing > 0 {
+		if settings.DefaultCurrency == "" {
+			return fmt.Errorf("%d wallets have no currency and no default currency is configured", missing)
+		}
+		err := db.Exec("UPDATE `wallets` SET `currency` = ? WHERE `currency` = ''", settings.DefaultCurrency).Error
+		if err != nil {
+			return err
+		}
+		logrus.Infof("set the currency of %d wallets to %s", missing, settings.DefaultCurrency)
+	}
+	if !added {
+		return nil
+	}
+	// The baseline has no default, wallets are always opened in a currency
+	return setNotNull(db, "wallets", "currency", "char(3)")
+}
+
+// hashPlaintextPasswords replaces passwords stored before hashing was
+// introduced with their argon2id hash.
+func hashPlaintextPasswords(db *gorm.DB, _ Settings) error {
+	var users []struct {
+		ID       uint64
+		Password string
+	}
+	if err := db.Table("users").Select("id", "password").Find(&users).Error; err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, user := range users {
+		if password.IsHashed(user.Password) {
+			continue
+		}
+
+		hashed, err := password.Hash(user.Password)
+		if err != nil {
+			return fmt.Errorf("hashing the password of user %d: %w", user.ID, err)
+		}
+		err = db.Exec("UPDATE `users` SET `password` = ? WHERE `id` = ?", hashed, user.ID).Error
+		if err != nil {
+			return err
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		logrus.Infof("hashed %d plaintext passwords", migrated)
+	}
+	return nil
+}
+
+func isMySQL(db *gorm.DB) bool {
+	return db.Dialector.Name() == "mysql"
+}
+
+func addColumn(db *gorm.DB, table, column, definition string) error {
+	return db.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, column, definition)).Error
+}
+
+// addIndex creates the index AutoMigrate would have named idx_<table>_<column>.
+func addIndex(db *gorm.DB, table, column string) error {
+	name := fmt.Sprintf("idx_%s_%s", table, column)
+	if db.Migrator().HasIndex(table, name) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("CREATE INDEX `%s` ON `%s` (`%s`)", name, table, column)).Error
+}
+
+// setNotNull makes column NOT NULL without a default. SQLite, which the tests
+// use, cannot change columns, so its columns stay as they were added.
+func setNotNull(db *gorm.DB, table, column, columnType string) error {
+	if !isMySQL(db) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE `%s` MODIFY `%s` %s NOT NULL", table, column, columnType)).Error
+}
@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/mohammadrabetian/quick/pkg/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// legacySchema is what AutoMigrate created before the versioned migrations,
+// with usernames as references and plaintext passwords. SQLite cannot drop
+// indexed columns, so unlike on MySQL users.token has no unique index.
+const legacySchema = `
+CREATE TABLE users (id INTEGER PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime,
+	username varchar(255) NOT NULL UNIQUE, password varchar(255) NOT NULL, token varchar(255) NOT NULL);
+CREATE TABLE wallets (id INTEGER PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime,
+	balance decimal(64,8), user_id varchar(255));
+CREATE TABLE transactions (id INTEGER PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime,
+	wallet_id bigint NOT NULL, type varchar(16) NOT NULL, amount decimal(64,8) NOT NULL,
+	balance_after decimal(64,8) NOT NULL, actor varchar(255) NOT NULL, reference varchar(255));
+INSERT INTO users (id, username, password, token) VALUES (1, 'alice', 'plaintext-secret', 't1'), (2, 'bob', 'another-secret', 't2');
+INSERT INTO wallets (id, balance, user_id) VALUES (1, 10, 'alice'), (2, 20, 'bob');
+INSERT INTO transactions (id, wallet_id, type, amount, balance_after, actor) VALUES (1, 1, 'credit', 10, 10, 'alice');
+`
+
+func newLegacyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, statement := range splitStatements(legacySchema) {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	return db
+}
+
+func TestLegacyMigrationsConvertAutoMigratedDatabases(t *testing.T) {
+	db := newLegacyDB(t)
+	migrator := &Migrator{db: db, migrations: legacyMigrations(), settings: Settings{DefaultCurrency: "EUR"}}
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, applied, 4)
+
+	m := db.Migrator()
+	assert.False(t, m.HasColumn("users", "token"))
+	assert.False(t, m.HasColumn("wallets", "user_id"))
+	assert.False(t, m.HasColumn("transactions", "actor"))
+	for _, column := range columnsAddedLater {
+		assert.True(t, m.HasColumn(column.table, column.name), "%s.%s", column.table, column.name)
+	}
+	assert.True(t, m.HasIndex("wallets", "idx_wallets_owner_id"))
+	assert.True(t, m.HasIndex("transactions", "idx_transactions_actor_id"))
+
+	var wallets []struct {
+		ID       uint64
+		OwnerID  uint64
+		Currency string
+	}
+	require.NoError(t, db.Table("wallets").Order("id").Find(&wallets).Error)
+	require.Len(t, wallets, 2)
+	assert.Equal(t, uint64(1), wallets[0].OwnerID)
+	assert.Equal(t, uint64(2), wallets[1].OwnerID)
+	assert.Equal(t, "EUR", wallets[0].Currency)
+
+	var actorID uint64
+	require.NoError(t, db.Raw("SELECT actor_id FROM transactions WHERE id = 1").Scan(&actorID).Error)
+	assert.Equal(t, uint64(1), actorID)
+
+	var hashed string
+	require.NoError(t, db.Raw("SELECT password FROM users WHERE id = 1").Scan(&hashed).Error)
+	match, _, err := password.Verify("plaintext-secret", hashed)
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	// A database the baseline created needs no conversion
+	for _, migration := range legacyMigrations() {
+		assert.NoError(t, migration.UpFunc(db, migrator.settings), migration.Name)
+	}
+	var again string
+	require.NoError(t, db.Raw("SELECT password FROM users WHERE id = 1").Scan(&again).Error)
+	assert.Equal(t, hashed, again)
+}
+
+func TestLegacyMigrationsRejectUnknownUsernames(t *testing.T) {
+	db := newLegacyDB(t)
+	require.NoError(t, db.Exec("INSERT INTO wallets (id, balance, user_id) VALUES (3, 0, 'mallory')").Error)
+	migrator := &Migrator{db: db, migrations: legacyMigrations(), settings: Settings{DefaultCurrency: "EUR"}}
+
+	_, err := migrator.Up(context.Background())
+	assert.ErrorContains(t, err, "unknown usernames")
+	assert.ErrorIs(t, migrator.CheckCurrent(), ErrDirty)
+	assert.True(t, db.Migrator().HasColumn("wallets", "user_id"), "usernames must be kept")
+}
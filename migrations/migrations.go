@@ -0,0 +1,482 @@
+// Package migrations versions the database schema. Migrations are pairs of
+// SQL files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// embedded into the binary, and are applied in order of their version. Data
+// conversions SQL cannot express, such as hashing passwords, are written in Go
+// instead. The applied versions are recorded in the schema_migrations table.
+//
+// MySQL commits DDL statements implicitly, so a migration cannot be rolled
+// back when it fails halfway. It is then recorded as dirty and nothing is
+// migrated until the schema was repaired by hand and the version set with
+// Force.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+var ErrDirty = errors.New("a migration failed halfway, repair the schema and set the version with force")
+var ErrSchemaBehind = errors.New("database schema is behind")
+var ErrUnknownVersion = errors.New("unknown migration version")
+var ErrLocked = errors.New("another instance is migrating the database")
+
+const (
+	// lockName is the MySQL advisory lock held while migrating, so that of
+	// several replicas starting at once only one migrates
+	lockName    = "quick_schema_migrations"
+	lockTimeout = time.Minute
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+
+	// Migrations written in Go run these instead of Up and Down
+	UpFunc   func(db *gorm.DB, settings Settings) error
+	DownFunc func(db *gorm.DB, settings Settings) error
+}
+
+// Settings are the configuration values migrations depend on.
+type Settings struct {
+	// Currency of the wallets created before wallets had a currency
+	DefaultCurrency string
+}
+
+// Status is a migration and whether it has been applied. Migrations applied
+// by a newer release that this binary does not know have no Up or Down.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	Dirty     bool
+}
+
+type appliedMigration struct {
+	Version   uint64
+	Name      string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	settings   Settings
+}
+
+// New returns a Migrator for the migrations embedded into the binary and the
+// ones written in Go.
+func New(db *gorm.DB, settings Settings) (*Migrator, error) {
+	source, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewFromFS(db, source)
+	if err != nil {
+		return nil, err
+	}
+	m.settings = settings
+
+	for _, migration := range legacyMigrations() {
+		if _, ok := m.find(migration.Version); ok {
+			return nil, fmt.Errorf("migration %d (%s) exists in SQL and in Go", migration.Version, migration.Name)
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return m, nil
+}
+
+// NewFromFS returns a Migrator for the migrations in the root of source.
+func NewFromFS(db *gorm.DB, source fs.FS) (*Migrator, error) {
+	migrations, err := load(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var migrated []Migration
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(migration); err != nil {
+				return err
+			}
+			migrated = append(migrated, migration)
+		}
+		return nil
+	})
+	return migrated, err
+}
+
+// Down reverts the latest steps applied migrations and returns them, latest
+// first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+
+		versions := sortedVersions(applied)
+		for i := len(versions) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration, ok := m.find(versions[i])
+			if !ok {
+				return fmt.Errorf("%w %d, it was applied by a newer release", ErrUnknownVersion, versions[i])
+			}
+			if err := m.revert(migration); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records the schema as being at version without running any SQL:
+// migrations up to version count as applied, later ones as not applied and
+// dirty marks are cleared. It is meant for repairing a failed migration.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	if _, ok := m.find(version); !ok && version != 0 {
+		return fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func() error {
+		return m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM schema_migrations WHERE version > ? OR dirty = ?", version, true).Error; err != nil {
+				return err
+			}
+
+			var applied []uint64
+			if err := tx.Raw("SELECT version FROM schema_migrations").Scan(&applied).Error; err != nil {
+				return err
+			}
+			done := map[uint64]bool{}
+			for _, v := range applied {
+				done[v] = true
+			}
+
+			now := time.Now()
+			for _, migration := range m.migrations {
+				if migration.Version > version || done[migration.Version] {
+					continue
+				}
+				err := tx.Exec("INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)",
+					migration.Version, migration.Name, false, now).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Status lists the known migrations and those applied by newer releases, in
+// order of their version.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.createTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &a.AppliedAt
+			status.Dirty = a.Dirty
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, version := range sortedVersions(applied) {
+		a := applied[version]
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: a.Version, Name: a.Name},
+			AppliedAt: &a.AppliedAt,
+			Dirty:     a.Dirty,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// CheckCurrent returns ErrSchemaBehind when a known migration has not been
+// applied yet, and ErrDirty when one failed. A schema migrated further by a
+// newer release is fine, as long as its migrations keep the older schema
+// working, which is what allows rolling deployments.
+func (m *Migrator) CheckCurrent() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.Dirty {
+			return fmt.Errorf("%w: migration %d (%s)", ErrDirty, status.Version, status.Name)
+		}
+		if status.AppliedAt == nil {
+			pending = append(pending, strconv.FormatUint(status.Version, 10))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w, pending migrations: %s", ErrSchemaBehind, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+func (m *Migrator) apply(migration Migration) error {
+	logrus.Infof("applying migration %d (%s)", migration.Version, migration.Name)
+
+	err := m.db.Exec("INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)",
+		migration.Version, migration.Name, true, time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	if migration.UpFunc != nil {
+		err = migration.UpFunc(m.db, m.settings)
+	} else {
+		err = m.run(migration.Up)
+	}
+	if err != nil {
+		return fmt.Errorf("applying migration %d (%s): %w", migration.Version, migration.Name, err)
+	}
+
+	return m.db.Exec("UPDATE schema_migrations SET dirty = ?, applied_at = ? WHERE version = ?",
+		false, time.Now(), migration.Version).Error
+}
+
+func (m *Migrator) revert(migration Migration) error {
+	logrus.Infof("reverting migration %d (%s)", migration.Version, migration.Name)
+
+	err := m.db.Exec("UPDATE schema_migrations SET dirty = ? WHERE version = ?", true, migration.Version).Error
+	if err != nil {
+		return err
+	}
+
+	if migration.DownFunc != nil {
+		err = migration.DownFunc(m.db, m.settings)
+	} else {
+		err = m.run(migration.Down)
+	}
+	if err != nil {
+		return fmt.Errorf("reverting migration %d (%s): %w", migration.Version, migration.Name, err)
+	}
+
+	return m.db.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+}
+
+// run executes the statements of a migration one by one, the MySQL driver
+// does not accept several in one call.
+func (m *Migrator) run(script string) error {
+	for _, statement := range splitStatements(script) {
+		if err := m.db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) createTable() error {
+	return m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		dirty BOOLEAN NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`).Error
+}
+
+func (m *Migrator) applied() (map[uint64]appliedMigration, error) {
+	var rows []appliedMigration
+	err := m.db.Raw("SELECT version, name, dirty, applied_at FROM schema_migrations").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(version uint64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// withLock runs fn while holding the advisory lock on MySQL. Other databases,
+// e.g. SQLite in the tests, are not shared between processes and need none.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.createTable(); err != nil {
+		return err
+	}
+	if m.db.Dialector.Name() != "mysql" {
+		return fn()
+	}
+
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	// The lock belongs to the connection that took it
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return ErrLocked
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+			logrus.Errorf("error in releasing the migration lock, err: %s", err)
+		}
+	}()
+
+	return fn()
+}
+
+func checkClean(applied map[uint64]appliedMigration) error {
+	for _, version := range sortedVersions(applied) {
+		if a := applied[version]; a.Dirty {
+			return fmt.Errorf("%w: migration %d (%s)", ErrDirty, a.Version, a.Name)
+		}
+	}
+	return nil
+}
+
+func sortedVersions(applied map[uint64]appliedMigration) []uint64 {
+	versions := make([]uint64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// load reads the migrations of source. Every version needs both an up and a
+// down file.
+func load(source fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, file := range files {
+		match := fileNamePattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", file.Name())
+		}
+		content, err := fs.ReadFile(source, file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits a script at the semicolons ending a line and drops
+// comment lines. Statements must not contain such semicolons themselves.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,225 @@
+package migrations_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"github.com/mohammadrabetian/quick/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+var testMigrations = fstest.MapFS{
+	"000001_create_accounts.up.sql":   file("-- accounts\nCREATE TABLE accounts (id INTEGER PRIMARY KEY, name TEXT NOT NULL);\n"),
+	"000001_create_accounts.down.sql": file("DROP TABLE accounts;\n"),
+	"000002_add_owner.up.sql":         file("ALTER TABLE accounts ADD COLUMN owner TEXT;\nUPDATE accounts SET owner = 'nobody';\n"),
+	"000002_add_owner.down.sql":       file("ALTER TABLE accounts DROP COLUMN owner;\n"),
+	"README.md":                       file("not a migration"),
+}
+
+func TestUpDownAndStatus(t *testing.T) {
+	db := newTestDB(t)
+	migrator, err := migrations.NewFromFS(db, testMigrations)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, migrator.CheckCurrent(), migrations.ErrSchemaBehind)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.Equal(t, "create_accounts", applied[0].Name)
+	assert.Equal(t, uint64(2), applied[1].Version)
+	assert.True(t, db.Migrator().HasColumn("accounts", "owner"))
+	assert.NoError(t, migrator.CheckCurrent())
+
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, uint64(2), reverted[0].Version)
+	assert.False(t, db.Migrator().HasColumn("accounts", "owner"))
+	assert.ErrorIs(t, migrator.CheckCurrent(), migrations.ErrSchemaBehind)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+
+	reverted, err = migrator.Down(ctx, 5)
+	require.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable("accounts"))
+}
+
+func TestNewerSchemaIsCurrent(t *testing.T) {
+	db := newTestDB(t)
+	newer := fstest.MapFS{}
+	for name, f := range testMigrations {
+		newer[name] = f
+	}
+	newer["000003_create_audit.up.sql"] = file("CREATE TABLE audit (id INTEGER PRIMARY KEY);")
+	newer["000003_create_audit.down.sql"] = file("DROP TABLE audit;")
+
+	migrator, err := migrations.NewFromFS(db, newer)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	// An older release still running during a rolling deployment
+	older, err := migrations.NewFromFS(db, testMigrations)
+	require.NoError(t, err)
+	assert.NoError(t, older.CheckCurrent())
+
+	statuses, err := older.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "create_audit", statuses[2].Name)
+	assert.Empty(t, statuses[2].Up)
+
+	_, err = older.Down(context.Background(), 1)
+	assert.ErrorIs(t, err, migrations.ErrUnknownVersion)
+}
+
+func TestFailedMigrationIsDirty(t *testing.T) {
+	db := newTestDB(t)
+	broken := fstest.MapFS{
+		"000001_create_accounts.up.sql":   testMigrations["000001_create_accounts.up.sql"],
+		"000001_create_accounts.down.sql": testMigrations["000001_create_accounts.down.sql"],
+		"000002_broken.up.sql":            file("ALTER TABLE accounts ADD COLUMN owner TEXT;\nALTER TABLE missing ADD COLUMN x TEXT;\n"),
+		"000002_broken.down.sql":          file("ALTER TABLE accounts DROP COLUMN owner;\n"),
+	}
+	migrator, err := migrations.NewFromFS(db, broken)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+	assert.ErrorIs(t, migrator.CheckCurrent(), migrations.ErrDirty)
+
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, migrations.ErrDirty)
+	_, err = migrator.Down(ctx, 1)
+	assert.ErrorIs(t, err, migrations.ErrDirty)
+
+	// Repaired by hand: the half-applied column is dropped again
+	require.NoError(t, db.Exec("ALTER TABLE accounts DROP COLUMN owner").Error)
+	require.NoError(t, migrator.Force(ctx, 1))
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.False(t, statuses[1].Dirty)
+	assert.ErrorIs(t, migrator.CheckCurrent(), migrations.ErrSchemaBehind)
+
+	assert.ErrorIs(t, migrator.Force(ctx, 7), migrations.ErrUnknownVersion)
+}
+
+func TestForceMarksMigrationsApplied(t *testing.T) {
+	db := newTestDB(t)
+	migrator, err := migrations.NewFromFS(db, testMigrations)
+	require.NoError(t, err)
+
+	require.NoError(t, migrator.Force(context.Background(), 2))
+	assert.NoError(t, migrator.CheckCurrent())
+	assert.False(t, db.Migrator().HasTable("accounts"), "force must not run any SQL")
+
+	require.NoError(t, migrator.Force(context.Background(), 0))
+	assert.ErrorIs(t, migrator.CheckCurrent(), migrations.ErrSchemaBehind)
+}
+
+func TestLoadRejectsIncompleteMigrations(t *testing.T) {
+	db := newTestDB(t)
+
+	_, err := migrations.NewFromFS(db, fstest.MapFS{
+		"000001_create_accounts.up.sql": testMigrations["000001_create_accounts.up.sql"],
+	})
+	assert.Error(t, err)
+
+	_, err = migrations.NewFromFS(db, fstest.MapFS{
+		"000001_create_accounts.up.sql": testMigrations["000001_create_accounts.up.sql"],
+		"000001_accounts.down.sql":      testMigrations["000001_create_accounts.down.sql"],
+	})
+	assert.Error(t, err)
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := migrations.New(newTestDB(t), migrations.Settings{DefaultCurrency: "EUR"})
+	require.NoError(t, err)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	assert.Equal(t, "initial_schema", statuses[0].Name)
+	assert.Contains(t, statuses[0].Up, "CREATE TABLE IF NOT EXISTS `ledger_postings`")
+	assert.Contains(t, statuses[0].Down, "DROP TABLE IF EXISTS `users`")
+
+	// The conversions of databases from before the migrations are in Go
+	require.Greater(t, len(statuses), 4)
+	assert.Equal(t, "hash_plaintext_passwords", statuses[4].Name)
+	assert.NotNil(t, statuses[4].UpFunc)
+}
+
+func TestTransactionOriginsAreBackfilled(t *testing.T) {
+	embedded, err := migrations.New(newTestDB(t), migrations.Settings{})
+	require.NoError(t, err)
+	statuses, err := embedded.Status()
+	require.NoError(t, err)
+
+	var origins migrations.Status
+	for _, status := range statuses {
+		if status.Name == "transaction_origins" {
+			origins = status
+		}
+	}
+	require.NotEmpty(t, origins.Up)
+
+	db := newTestDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE transactions (id INTEGER PRIMARY KEY, reference varchar(255), reversal_of_id bigint)").Error)
+	require.NoError(t, db.Exec(`INSERT INTO transactions (id, reference, reversal_of_id) VALUES
+		(1, 'credit_a', NULL), (2, 'debit_b', NULL), (3, 'transfer_c', NULL), (4, 'adjustment_d', NULL),
+		(5, 'hold_e', NULL), (6, 'reversal_f', 2), (7, NULL, NULL)`).Error)
+
+	migrator, err := migrations.NewFromFS(db, fstest.MapFS{
+		"000007_transaction_origins.up.sql":   file(origins.Up),
+		"000007_transaction_origins.down.sql": file(origins.Down),
+	})
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	var backfilled []string
+	require.NoError(t, db.Raw("SELECT origin FROM transactions ORDER BY id").Scan(&backfilled).Error)
+	assert.Equal(t, []string{"credit", "debit", "transfer", "adjustment", "capture", "reversal", ""}, backfilled)
+}
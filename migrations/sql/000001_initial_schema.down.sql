@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS `ledger_postings`;
+DROP TABLE IF EXISTS `ledger_entries`;
+DROP TABLE IF EXISTS `ledger_accounts`;
+DROP TABLE IF EXISTS `audit_entries`;
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `webhook_subscriptions`;
+DROP TABLE IF EXISTS `outbox_events`;
+DROP TABLE IF EXISTS `holds`;
+DROP TABLE IF EXISTS `fx_quotes`;
+DROP TABLE IF EXISTS `refresh_tokens`;
+DROP TABLE IF EXISTS `sessions`;
+DROP TABLE IF EXISTS `idempotency_records`;
+DROP TABLE IF EXISTS `transactions`;
+DROP TABLE IF EXISTS `wallets`;
+DROP TABLE IF EXISTS `users`;
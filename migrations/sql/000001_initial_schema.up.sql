@@ -0,0 +1,261 @@
+-- Baseline: the schema AutoMigrate created before migrations were versioned.
+-- IF NOT EXISTS lets it run against those databases. Their tables are kept as
+-- they are, and the Go migrations 2 to 5 (migrations/legacy.go) convert them
+-- to this schema: user IDs instead of usernames, no users.token, the columns
+-- added later with wallet currencies backfilled, and hashed passwords.
+
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `username` varchar(255) NOT NULL,
+    `password` varchar(255) NOT NULL,
+    `disabled_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_users_deleted_at` (`deleted_at`),
+    CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
+
+CREATE TABLE IF NOT EXISTS `wallets` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `balance` decimal(64,8),
+    `held_balance` decimal(64,8) NOT NULL DEFAULT '0',
+    `currency` char(3) NOT NULL,
+    `owner_id` bigint unsigned NOT NULL,
+    `frozen_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_wallets_deleted_at` (`deleted_at`),
+    INDEX `idx_wallets_owner_id` (`owner_id`),
+    CONSTRAINT `fk_wallets_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `transactions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `wallet_id` bigint unsigned NOT NULL,
+    `type` varchar(16) NOT NULL,
+    `amount` decimal(64,8) NOT NULL,
+    `balance_after` decimal(64,8) NOT NULL,
+    `actor_id` bigint unsigned NOT NULL,
+    `reference` varchar(255),
+    `quote_id` bigint unsigned,
+    `reversal_of_id` bigint unsigned,
+    `reversed_amount` decimal(64,8) NOT NULL DEFAULT '0',
+    PRIMARY KEY (`id`),
+    INDEX `idx_transactions_actor_id` (`actor_id`),
+    INDEX `idx_transactions_reference` (`reference`),
+    INDEX `idx_transactions_quote_id` (`quote_id`),
+    INDEX `idx_transactions_reversal_of_id` (`reversal_of_id`),
+    INDEX `idx_transactions_deleted_at` (`deleted_at`),
+    INDEX `idx_transactions_wallet_id` (`wallet_id`),
+    INDEX `idx_transactions_type` (`type`)
+);
+
+CREATE TABLE IF NOT EXISTS `idempotency_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `idempotency_key` varchar(255) NOT NULL,
+    `request_hash` char(64) NOT NULL,
+    `status_code` bigint NOT NULL,
+    `response_body` blob,
+    PRIMARY KEY (`id`),
+    INDEX `idx_idempotency_records_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_idempotency_user_key` (`user_id`,`idempotency_key`)
+);
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `token_hash` char(64) NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `last_used_at` datetime(3) NULL,
+    `user_agent` varchar(512),
+    `ip` varchar(45),
+    PRIMARY KEY (`id`),
+    INDEX `idx_sessions_user_id` (`user_id`),
+    UNIQUE INDEX `idx_sessions_token_hash` (`token_hash`),
+    INDEX `idx_sessions_expires_at` (`expires_at`),
+    INDEX `idx_sessions_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `session_id` bigint unsigned NOT NULL,
+    `token_hash` char(64) NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `used_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_refresh_tokens_deleted_at` (`deleted_at`),
+    INDEX `idx_refresh_tokens_session_id` (`session_id`),
+    UNIQUE INDEX `idx_refresh_tokens_token_hash` (`token_hash`)
+);
+
+CREATE TABLE IF NOT EXISTS `fx_quotes` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `from_currency` char(3) NOT NULL,
+    `to_currency` char(3) NOT NULL,
+    `amount` decimal(64,8) NOT NULL,
+    `converted_amount` decimal(64,8) NOT NULL,
+    `rate` decimal(32,12) NOT NULL,
+    `spread` decimal(10,6) NOT NULL,
+    `applied_rate` decimal(32,12) NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `used_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_fx_quotes_deleted_at` (`deleted_at`),
+    INDEX `idx_fx_quotes_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `holds` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `wallet_id` bigint unsigned NOT NULL,
+    `amount` decimal(64,8) NOT NULL,
+    `captured_amount` decimal(64,8) NOT NULL DEFAULT '0',
+    `status` varchar(16) NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `actor_id` bigint unsigned NOT NULL,
+    `reference` varchar(255),
+    PRIMARY KEY (`id`),
+    INDEX `idx_holds_deleted_at` (`deleted_at`),
+    INDEX `idx_holds_wallet_id` (`wallet_id`),
+    INDEX `idx_holds_status_expires_at` (`status`,`expires_at`),
+    INDEX `idx_holds_reference` (`reference`)
+);
+
+CREATE TABLE IF NOT EXISTS `outbox_events` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `type` varchar(64) NOT NULL,
+    `partition_key` varchar(64) NOT NULL,
+    `payload` text NOT NULL,
+    `attempts` bigint NOT NULL DEFAULT 0,
+    `last_error` varchar(255),
+    `published_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_outbox_events_deleted_at` (`deleted_at`),
+    INDEX `idx_outbox_events_published_at` (`published_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_subscriptions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` bigint unsigned NOT NULL,
+    `url` varchar(2048) NOT NULL,
+    `secret` varchar(128) NOT NULL,
+    `event_types` varchar(255) NOT NULL,
+    `active` boolean NOT NULL DEFAULT true,
+    `consecutive_failures` bigint NOT NULL DEFAULT 0,
+    `disabled_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_webhook_subscriptions_deleted_at` (`deleted_at`),
+    INDEX `idx_webhook_subscriptions_user_id` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `subscription_id` bigint unsigned NOT NULL,
+    `event_id` bigint unsigned NOT NULL,
+    `event_type` varchar(64) NOT NULL,
+    `body` text NOT NULL,
+    `status` varchar(16) NOT NULL,
+    `attempts` bigint NOT NULL DEFAULT 0,
+    `next_attempt_at` datetime(3) NULL,
+    `last_status_code` bigint,
+    `last_error` varchar(255),
+    `delivered_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_webhook_delivery_event` (`subscription_id`,`event_id`),
+    INDEX `idx_webhook_delivery_due` (`status`,`next_attempt_at`),
+    INDEX `idx_webhook_deliveries_deleted_at` (`deleted_at`),
+    CONSTRAINT `fk_webhook_deliveries_subscription` FOREIGN KEY (`subscription_id`) REFERENCES `webhook_subscriptions`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `actor` varchar(64) NOT NULL,
+    `action` varchar(64) NOT NULL,
+    `target_type` varchar(32) NOT NULL,
+    `target_id` bigint unsigned NOT NULL,
+    `reason` varchar(255) NOT NULL,
+    `details` text,
+    PRIMARY KEY (`id`),
+    INDEX `idx_audit_entries_deleted_at` (`deleted_at`),
+    INDEX `idx_audit_entries_action` (`action`),
+    INDEX `idx_audit_target` (`target_type`,`target_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `ledger_accounts` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `code` varchar(64) NOT NULL,
+    `kind` varchar(16) NOT NULL,
+    `currency` char(3) NOT NULL,
+    `wallet_id` bigint unsigned,
+    PRIMARY KEY (`id`),
+    INDEX `idx_ledger_accounts_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_ledger_accounts_code` (`code`),
+    UNIQUE INDEX `idx_ledger_accounts_wallet_id` (`wallet_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `ledger_entries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `reference` varchar(255),
+    `description` varchar(255),
+    PRIMARY KEY (`id`),
+    INDEX `idx_ledger_entries_deleted_at` (`deleted_at`),
+    INDEX `idx_ledger_entries_reference` (`reference`)
+);
+
+CREATE TABLE IF NOT EXISTS `ledger_postings` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `entry_id` bigint unsigned NOT NULL,
+    `account_id` bigint unsigned NOT NULL,
+    `side` varchar(6) NOT NULL,
+    `amount` decimal(64,8) NOT NULL,
+    `currency` char(3) NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_ledger_postings_deleted_at` (`deleted_at`),
+    INDEX `idx_ledger_postings_entry_id` (`entry_id`),
+    INDEX `idx_ledger_postings_account_id` (`account_id`),
+    CONSTRAINT `fk_ledger_entries_postings` FOREIGN KEY (`entry_id`) REFERENCES `ledger_entries`(`id`)
+);
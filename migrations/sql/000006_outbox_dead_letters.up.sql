@@ -0,0 +1,3 @@
+-- Events that keep failing are dead-lettered, so that they stop holding back
+-- the later events of their partition key.
+ALTER TABLE `outbox_events` ADD COLUMN `dead_lettered_at` datetime(3) NULL;
@@ -0,0 +1,12 @@
+-- Records which operation booked a transaction, reversals check it instead of
+-- the prefix of the reference.
+ALTER TABLE `transactions` ADD COLUMN `origin` varchar(16) NOT NULL DEFAULT '';
+
+-- Transactions without a known reference keep an empty origin and cannot be
+-- reversed.
+UPDATE `transactions` SET `origin` = 'reversal' WHERE `reversal_of_id` IS NOT NULL;
+UPDATE `transactions` SET `origin` = 'transfer' WHERE `origin` = '' AND SUBSTR(`reference`, 1, 9) = 'transfer_';
+UPDATE `transactions` SET `origin` = 'adjustment' WHERE `origin` = '' AND SUBSTR(`reference`, 1, 11) = 'adjustment_';
+UPDATE `transactions` SET `origin` = 'capture' WHERE `origin` = '' AND SUBSTR(`reference`, 1, 5) = 'hold_';
+UPDATE `transactions` SET `origin` = 'credit' WHERE `origin` = '' AND SUBSTR(`reference`, 1, 7) = 'credit_';
+UPDATE `transactions` SET `origin` = 'debit' WHERE `origin` = '' AND SUBSTR(`reference`, 1, 6) = 'debit_';
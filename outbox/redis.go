@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+)
+
+// RedisStreamSink appends events to a single Redis stream, which keeps them
+// in the order they were published.
+type RedisStreamSink struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamSink returns a sink writing to stream, trimmed to about maxLen
+// entries. A maxLen of 0 never trims the stream.
+func NewRedisStreamSink(client *redis.Client, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{client: client, stream: stream, maxLen: maxLen}
+}
+
+func (s *RedisStreamSink) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]interface{}{
+			"id":          strconv.FormatUint(event.ID, 10),
+			"type":        event.Type,
+			"key":         event.PartitionKey,
+			"payload":     event.Payload,
+			"occurred_at": event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
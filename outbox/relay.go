@@ -0,0 +1,165 @@
+// Package outbox publishes the domain events that the services write to the
+// outbox table. Delivery is at least once: an event is marked as published
+// only after the sink accepted it, so consumers must tolerate duplicates and
+// can use the event ID to drop them.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultMaxAttempts = 10
+
+	// How long the lock outlives a relay that stopped renewing it, before
+	// another instance can take over
+	relayLockTTL = 30 * time.Second
+
+	// The lock is renewed once a third of its TTL has passed, and no publish
+	// may take longer than that, so it does not expire during a pass
+	relayLockRenewal = relayLockTTL / 3
+	publishTimeout   = relayLockTTL / 3
+)
+
+// Sink is where events are published to, e.g. Redis Streams. Kafka or NATS
+// can be plugged in by implementing it.
+type Sink interface {
+	Publish(ctx context.Context, event *domain.OutboxEvent) error
+}
+
+// Fanout publishes every event to all of its sinks. When one of them fails the
+// event is published to all of them again later, so each sees it at least
+// once.
+type Fanout []Sink
+
+func (f Fanout) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	for _, sink := range f {
+		if err := sink.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Relay struct {
+	repo        repository.OutboxRepository
+	sink        Sink
+	batchSize   int
+	maxAttempts int
+}
+
+// NewRelay returns a Relay which moves up to batchSize events per pass from
+// the outbox to sink, and dead-letters the events that failed maxAttempts
+// times. batchSize defaults to 100 and maxAttempts to 10.
+func NewRelay(repo repository.OutboxRepository, sink Sink, batchSize, maxAttempts int) *Relay {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return &Relay{repo: repo, sink: sink, batchSize: batchSize, maxAttempts: maxAttempts}
+}
+
+// RelayOnce publishes the oldest unpublished events in order and returns how
+// many were published. When an event fails, the later events of its partition
+// key are held back until the next pass, so that the events of a wallet never
+// overtake each other. An event that failed maxAttempts times is
+// dead-lettered and no longer holds them back. It does nothing while another
+// instance is relaying.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	owner, locked, err := r.repo.AcquireRelayLock(ctx, relayLockTTL)
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer func() {
+		// Released on shutdown too, so that another instance need not wait
+		// for the lock to expire
+		if err := r.repo.ReleaseRelayLock(util.WithoutCancel(ctx), owner); err != nil {
+			logrus.Errorf("error in releasing the outbox relay lock, err: %s", err)
+		}
+	}()
+
+	events, err := r.repo.ListUnpublished(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	renewed := time.Now()
+	blocked := map[string]bool{}
+	published := make([]uint64, 0, len(events))
+	for i := range events {
+		event := &events[i]
+		if blocked[event.PartitionKey] {
+			continue
+		}
+
+		if time.Since(renewed) >= relayLockRenewal {
+			held, err := r.repo.RenewRelayLock(ctx, owner, relayLockTTL)
+			if err != nil || !held {
+				// Another instance may be relaying the same events by now
+				logrus.Errorf("lost the outbox relay lock, stopping the pass, err: %v", err)
+				break
+			}
+			renewed = time.Now()
+		}
+
+		if err := r.publish(ctx, event); err != nil {
+			logrus.Errorf("error in publishing event %d of %s, err: %s", event.ID, event.PartitionKey, err)
+			deadLettered, err := r.repo.MarkFailed(ctx, event.ID, err.Error(), r.maxAttempts)
+			if err != nil {
+				logrus.Errorf("error in recording the failure of event %d, err: %s", event.ID, err)
+			}
+			if deadLettered {
+				logrus.Errorf("dead-lettered event %d of %s after %d attempts", event.ID, event.PartitionKey, r.maxAttempts)
+				continue
+			}
+			blocked[event.PartitionKey] = true
+			continue
+		}
+		published = append(published, event.ID)
+	}
+
+	// Should this fail, the events are published again on the next pass
+	if err := r.repo.MarkPublished(ctx, published, time.Now()); err != nil {
+		return 0, err
+	}
+	return len(published), nil
+}
+
+func (r *Relay) publish(ctx context.Context, event *domain.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	return r.sink.Publish(ctx, event)
+}
+
+// Run relays events every interval until ctx is done. A full batch is
+// followed by another pass right away.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				published, err := r.RelayOnce(ctx)
+				if err != nil {
+					logrus.Errorf("error in relaying outbox events, err: %s", err)
+				}
+				if published < r.batchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
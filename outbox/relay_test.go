@@ -0,0 +1,205 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/outbox"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestOutbox(t *testing.T) (repository.OutboxRepository, *gorm.DB, *redis.Client) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&domain.OutboxEvent{}))
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	return repository.NewOutboxMySQLRepository(db, cache), db, cache
+}
+
+func addEvents(t *testing.T, db *gorm.DB, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		require.NoError(t, db.Create(&domain.OutboxEvent{Type: domain.EventWalletCredited, PartitionKey: key, Payload: "{}"}).Error)
+	}
+}
+
+// flakySink fails every event of a key until it is healed, and the events in
+// failOnce the next time they are published.
+type flakySink struct {
+	failing   map[string]bool
+	failOnce  map[uint64]bool
+	published []uint64
+}
+
+func (s *flakySink) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	if s.failing[event.PartitionKey] {
+		return errors.New("sink unavailable")
+	}
+	if s.failOnce[event.ID] {
+		delete(s.failOnce, event.ID)
+		return errors.New("sink unavailable")
+	}
+	s.published = append(s.published, event.ID)
+	return nil
+}
+
+func TestRelayKeepsOrderPerKey(t *testing.T) {
+	repo, db, _ := newTestOutbox(t)
+	addEvents(t, db, "wallet:1", "wallet:2", "wallet:1", "wallet:2", "wallet:1")
+
+	sink := &flakySink{failing: map[string]bool{"wallet:1": true}}
+	relay := outbox.NewRelay(repo, sink, 10, 3)
+
+	published, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []uint64{2, 4}, sink.published)
+
+	failed := &domain.OutboxEvent{}
+	require.NoError(t, db.First(failed, 1).Error)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "sink unavailable", failed.LastError)
+	assert.Nil(t, failed.PublishedAt)
+
+	// Later events of wallet:1 were held back, not skipped
+	delete(sink.failing, "wallet:1")
+	published, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, published)
+	assert.Equal(t, []uint64{2, 4, 1, 3, 5}, sink.published)
+
+	published, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+func TestRelayWaitsForLock(t *testing.T) {
+	repo, db, _ := newTestOutbox(t)
+	addEvents(t, db, "wallet:1")
+
+	owner, locked, err := repo.AcquireRelayLock(context.Background(), time.Minute)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	sink := &flakySink{}
+	relay := outbox.NewRelay(repo, sink, 10, 3)
+
+	published, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	require.NoError(t, repo.ReleaseRelayLock(context.Background(), owner))
+	published, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+}
+
+func TestRelayLockIsOwned(t *testing.T) {
+	repo, _, cache := newTestOutbox(t)
+	ctx := context.Background()
+
+	stale, locked, err := repo.AcquireRelayLock(ctx, time.Minute)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	// The lock expired and another instance took it over
+	require.NoError(t, cache.Del(ctx, "outbox_relay_lock").Err())
+	owner, locked, err := repo.AcquireRelayLock(ctx, time.Minute)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	renewed, err := repo.RenewRelayLock(ctx, stale, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+	require.NoError(t, repo.ReleaseRelayLock(ctx, stale))
+
+	_, locked, err = repo.AcquireRelayLock(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, locked, "the stale owner released the lock of the new one")
+
+	renewed, err = repo.RenewRelayLock(ctx, owner, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	require.NoError(t, repo.ReleaseRelayLock(ctx, owner))
+
+	_, locked, err = repo.AcquireRelayLock(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestRelayDeadLettersEventsThatKeepFailing(t *testing.T) {
+	repo, db, _ := newTestOutbox(t)
+	addEvents(t, db, "wallet:1", "wallet:1")
+
+	sink := &flakySink{failing: map[string]bool{"wallet:1": true}}
+	relay := outbox.NewRelay(repo, sink, 10, 3)
+
+	for i := 0; i < 2; i++ {
+		published, err := relay.RelayOnce(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, published)
+	}
+
+	// The third failure dead-letters the first event, and the second one no
+	// longer waits for it
+	sink.failing = map[string]bool{}
+	sink.failOnce = map[uint64]bool{1: true}
+	published, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []uint64{2}, sink.published)
+
+	dead := &domain.OutboxEvent{}
+	require.NoError(t, db.First(dead, 1).Error)
+	assert.Equal(t, 3, dead.Attempts)
+	assert.NotNil(t, dead.DeadLetteredAt)
+	assert.Nil(t, dead.PublishedAt)
+
+	published, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published, "dead-lettered events are not retried")
+}
+
+func TestRedisStreamSink(t *testing.T) {
+	repo, db, cache := newTestOutbox(t)
+	addEvents(t, db, "wallet:1", "user:1")
+
+	relay := outbox.NewRelay(repo, outbox.NewRedisStreamSink(cache, "quick_events", 100), 10, 3)
+	published, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+
+	entries, err := cache.XRange(context.Background(), "quick_events", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "1", entries[0].Values["id"])
+	assert.Equal(t, "wallet.credited", entries[0].Values["type"])
+	assert.Equal(t, "wallet:1", entries[0].Values["key"])
+	assert.Equal(t, "{}", entries[0].Values["payload"])
+	assert.Equal(t, "user:1", entries[1].Values["key"])
+}
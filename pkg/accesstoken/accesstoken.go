@@ -0,0 +1,230 @@
+// Package accesstoken issues and verifies the short-lived JWT access tokens
+// used when the service runs with [auth] mode = "jwt".
+package accesstoken
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mohammadrabetian/quick/util"
+)
+
+const (
+	issuer = "quick"
+
+	defaultAccessTTL = 15 * time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Claims are carried by every access token. The subject is the user ID.
+type Claims struct {
+	Username  string `json:"username"`
+	SessionID uint64 `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// UserID parses the subject claim.
+func (c *Claims) UserID() (uint64, error) {
+	return strconv.ParseUint(c.Subject, 10, 64)
+}
+
+type key struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Manager signs tokens with the configured signing key and accepts tokens
+// signed by any configured key, which allows rotating keys via the kid header.
+type Manager struct {
+	keys         map[string]key
+	signingKeyID string
+	ttl          time.Duration
+}
+
+func NewManager(config util.JWTConfig) (*Manager, error) {
+	m := &Manager{
+		keys:         make(map[string]key, len(config.Keys)),
+		signingKeyID: config.SigningKeyID,
+		ttl:          config.AccessTTL,
+	}
+	if m.ttl <= 0 {
+		m.ttl = defaultAccessTTL
+	}
+
+	for _, kc := range config.Keys {
+		if kc.ID == "" {
+			return nil, errors.New("jwt key without id")
+		}
+		if _, ok := m.keys[kc.ID]; ok {
+			return nil, fmt.Errorf("duplicate jwt key id %q", kc.ID)
+		}
+
+		material, err := loadKeyMaterial(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		k, err := parseKey(material)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		m.keys[kc.ID] = k
+	}
+
+	signing, ok := m.keys[m.signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", m.signingKeyID)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", m.signingKeyID)
+	}
+
+	return m, nil
+}
+
+// loadKeyMaterial reads the secret and the private key of kc from the
+// environment or from their files, if set.
+func loadKeyMaterial(kc util.JWTKeyConfig) (util.JWTKeyConfig, error) {
+	var err error
+	kc.Secret, err = keyMaterial(kc.ID, "SECRET", kc.SecretFile, kc.Secret)
+	if err != nil {
+		return kc, err
+	}
+	kc.PrivateKey, err = keyMaterial(kc.ID, "PRIVATE_KEY", kc.PrivateKeyFile, kc.PrivateKey)
+	return kc, err
+}
+
+func keyMaterial(id, name, file, value string) (string, error) {
+	if v := os.Getenv(keyEnv(id, name)); v != "" {
+		return v, nil
+	}
+	if file == "" {
+		return value, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", strings.ToLower(name), err)
+	}
+	// Files usually end with a newline, which is not part of the key
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// keyEnv returns the name of the environment variable holding the material of
+// the key, e.g. QUICK_JWT_KEY_1_SECRET for the secret of "key-1".
+func keyEnv(id, name string) string {
+	id = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(id))
+	return "QUICK_JWT_" + id + "_" + name
+}
+
+func parseKey(kc util.JWTKeyConfig) (key, error) {
+	switch kc.Algorithm {
+	case "HS256":
+		if len(kc.Secret) < 32 {
+			return key{}, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		secret := []byte(kc.Secret)
+		return key{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+
+	case "EdDSA":
+		k := key{method: jwt.SigningMethodEdDSA}
+		if kc.PrivateKey != "" {
+			raw, err := base64.StdEncoding.DecodeString(kc.PrivateKey)
+			if err != nil {
+				return key{}, fmt.Errorf("decoding private key: %w", err)
+			}
+			var private ed25519.PrivateKey
+			switch len(raw) {
+			case ed25519.SeedSize:
+				private = ed25519.NewKeyFromSeed(raw)
+			case ed25519.PrivateKeySize:
+				private = ed25519.PrivateKey(raw)
+			default:
+				return key{}, errors.New("private key must be an ed25519 seed or private key")
+			}
+			k.signKey = private
+			k.verifyKey = private.Public()
+		}
+		if kc.PublicKey != "" {
+			raw, err := base64.StdEncoding.DecodeString(kc.PublicKey)
+			if err != nil {
+				return key{}, fmt.Errorf("decoding public key: %w", err)
+			}
+			if len(raw) != ed25519.PublicKeySize {
+				return key{}, errors.New("public key must be an ed25519 public key")
+			}
+			k.verifyKey = ed25519.PublicKey(raw)
+		}
+		if k.verifyKey == nil {
+			return key{}, errors.New("EdDSA key needs a private or public key")
+		}
+		return k, nil
+
+	default:
+		return key{}, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+}
+
+// Issue returns a signed access token for the user's session.
+func (m *Manager) Issue(userID uint64, username string, sessionID uint64) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := Claims{
+		Username:  username,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatUint(userID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signing := m.keys[m.signingKeyID]
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = m.signingKeyID
+
+	signed, err := token.SignedString(signing.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Parse verifies the token's signature and lifetime and returns its claims.
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// Never let the token pick the algorithm for a key
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return k.verifyKey, nil
+	}, jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
@@ -0,0 +1,188 @@
+package accesstoken_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mohammadrabetian/quick/pkg/accesstoken"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func hsKey(id string) util.JWTKeyConfig {
+	return util.JWTKeyConfig{ID: id, Algorithm: "HS256", Secret: testSecret + id}
+}
+
+func TestIssueAndParse(t *testing.T) {
+	m, err := accesstoken.NewManager(util.JWTConfig{
+		AccessTTL:    time.Minute,
+		SigningKeyID: "a",
+		Keys:         []util.JWTKeyConfig{hsKey("a")},
+	})
+	require.NoError(t, err)
+
+	token, expiresAt, err := m.Issue(7, "user7", 42)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 5*time.Second)
+
+	claims, err := m.Parse(token)
+	require.NoError(t, err)
+	userID, _ := claims.UserID()
+	assert.Equal(t, uint64(7), userID)
+	assert.Equal(t, "user7", claims.Username)
+	assert.Equal(t, uint64(42), claims.SessionID)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "a",
+		Keys:         []util.JWTKeyConfig{hsKey("a")},
+	})
+	require.NoError(t, err)
+	oldToken, _, err := old.Issue(1, "user1", 1)
+	require.NoError(t, err)
+
+	// "b" signs new tokens, tokens signed with "a" stay valid
+	rotated, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "b",
+		Keys:         []util.JWTKeyConfig{hsKey("a"), hsKey("b")},
+	})
+	require.NoError(t, err)
+	_, err = rotated.Parse(oldToken)
+	assert.NoError(t, err)
+
+	// once "a" is removed, its tokens are rejected
+	retired, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "b",
+		Keys:         []util.JWTKeyConfig{hsKey("b")},
+	})
+	require.NoError(t, err)
+	_, err = retired.Parse(oldToken)
+	assert.ErrorIs(t, err, accesstoken.ErrInvalidToken)
+}
+
+func TestEdDSA(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "ed",
+		Keys: []util.JWTKeyConfig{{
+			ID:         "ed",
+			Algorithm:  "EdDSA",
+			PrivateKey: base64.StdEncoding.EncodeToString(private.Seed()),
+		}},
+	})
+	require.NoError(t, err)
+	token, _, err := signer.Issue(1, "user1", 1)
+	require.NoError(t, err)
+
+	// a verifier only needs the public key, but cannot sign with it
+	verifierConfig := util.JWTConfig{
+		SigningKeyID: "ed",
+		Keys: []util.JWTKeyConfig{{
+			ID:        "ed",
+			Algorithm: "EdDSA",
+			PublicKey: base64.StdEncoding.EncodeToString(public),
+		}},
+	}
+	_, err = accesstoken.NewManager(verifierConfig)
+	assert.Error(t, err)
+
+	verifierConfig.Keys = append(verifierConfig.Keys, hsKey("hs"))
+	verifierConfig.SigningKeyID = "hs"
+	verifier, err := accesstoken.NewManager(verifierConfig)
+	require.NoError(t, err)
+	_, err = verifier.Parse(token)
+	assert.NoError(t, err)
+}
+
+func TestKeyMaterialFromFileAndEnvironment(t *testing.T) {
+	inline, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "key-1",
+		Keys:         []util.JWTKeyConfig{{ID: "key-1", Algorithm: "HS256", Secret: testSecret}},
+	})
+	require.NoError(t, err)
+	token, _, err := inline.Issue(1, "user1", 1)
+	require.NoError(t, err)
+
+	secretFile := filepath.Join(t.TempDir(), "jwt_secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte(testSecret+"\n"), 0o600))
+	fromFile, err := accesstoken.NewManager(util.JWTConfig{
+		SigningKeyID: "key-1",
+		Keys:         []util.JWTKeyConfig{{ID: "key-1", Algorithm: "HS256", SecretFile: secretFile}},
+	})
+	require.NoError(t, err)
+	_, err = fromFile.Parse(token)
+	assert.NoError(t, err)
+
+	missing := util.JWTConfig{
+		SigningKeyID: "key-1",
+		Keys:         []util.JWTKeyConfig{{ID: "key-1", Algorithm: "HS256", SecretFile: filepath.Join(t.TempDir(), "missing")}},
+	}
+	_, err = accesstoken.NewManager(missing)
+	assert.Error(t, err)
+
+	// The environment takes precedence over the file
+	t.Setenv("QUICK_JWT_KEY_1_SECRET", testSecret)
+	fromEnv, err := accesstoken.NewManager(missing)
+	require.NoError(t, err)
+	_, err = fromEnv.Parse(token)
+	assert.NoError(t, err)
+}
+
+func TestParseRejectsBadTokens(t *testing.T) {
+	m, err := accesstoken.NewManager(util.JWTConfig{
+		AccessTTL:    time.Minute,
+		SigningKeyID: "a",
+		Keys:         []util.JWTKeyConfig{hsKey("a")},
+	})
+	require.NoError(t, err)
+
+	t.Run("expired", func(t *testing.T) {
+		claims := accesstoken.Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "quick",
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		}}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "a"
+		signed, err := token.SignedString([]byte(testSecret + "a"))
+		require.NoError(t, err)
+
+		_, err = m.Parse(signed)
+		assert.ErrorIs(t, err, accesstoken.ErrInvalidToken)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		claims := accesstoken.Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "quick",
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+		token.Header["kid"] = "a"
+		signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+
+		_, err = m.Parse(signed)
+		assert.ErrorIs(t, err, accesstoken.ErrInvalidToken)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		token, _, err := m.Issue(1, "user1", 1)
+		require.NoError(t, err)
+
+		_, err = m.Parse(token[:len(token)-2] + "xx")
+		assert.ErrorIs(t, err, accesstoken.ErrInvalidToken)
+	})
+}
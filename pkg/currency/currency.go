@@ -0,0 +1,57 @@
+// Package currency knows the ISO 4217 currencies wallets can hold and how many
+// minor units (decimal places) each of them has.
+package currency
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrUnknownCurrency = errors.New("unknown or unsupported currency")
+
+// Currency is an ISO 4217 currency, e.g. EUR with 2 minor units or JPY with none.
+type Currency struct {
+	Code       string
+	MinorUnits int32
+}
+
+// minorUnits of the supported currencies, taken from the ISO 4217 list.
+var minorUnits = map[string]int32{
+	// No minor units
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+
+	// Three minor units
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+
+	// Two minor units
+	"AED": 2, "ARS": 2, "AUD": 2, "BGN": 2, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2,
+	"COP": 2, "CZK": 2, "DKK": 2, "EGP": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "MAD": 2, "MXN": 2, "MYR": 2, "NGN": 2, "NOK": 2,
+	"NZD": 2, "PEN": 2, "PHP": 2, "PKR": 2, "PLN": 2, "QAR": 2, "RON": 2, "RSD": 2,
+	"SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TRY": 2, "TWD": 2, "UAH": 2, "USD": 2,
+	"ZAR": 2,
+}
+
+// Lookup returns the currency for an ISO 4217 code. The code is case-insensitive.
+func Lookup(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	units, ok := minorUnits[code]
+	if !ok {
+		return Currency{}, ErrUnknownCurrency
+	}
+	return Currency{Code: code, MinorUnits: units}, nil
+}
+
+// Fits reports whether amount can be expressed in the currency's minor units,
+// e.g. 10.5 fits EUR, while it does not fit JPY.
+func (c Currency) Fits(amount decimal.Decimal) bool {
+	return amount.Equal(amount.Truncate(c.MinorUnits))
+}
+
+// Round rounds amount to the currency's minor units, half away from zero.
+func (c Currency) Round(amount decimal.Decimal) decimal.Decimal {
+	return amount.Round(c.MinorUnits)
+}
@@ -0,0 +1,52 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	eur, err := Lookup(" eur ")
+	require.NoError(t, err)
+	assert.Equal(t, Currency{Code: "EUR", MinorUnits: 2}, eur)
+
+	jpy, err := Lookup("JPY")
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), jpy.MinorUnits)
+
+	_, err = Lookup("XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = Lookup("")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
+
+func TestFits(t *testing.T) {
+	testCases := []struct {
+		code   string
+		amount string
+		fits   bool
+	}{
+		{"EUR", "10", true},
+		{"EUR", "10.5", true},
+		{"EUR", "10.55", true},
+		{"EUR", "10.555", false},
+		{"EUR", "10.550", true},
+		{"JPY", "1000", true},
+		{"JPY", "1000.5", false},
+		{"JPY", "1000.00", true},
+		{"KWD", "1.125", true},
+		{"KWD", "1.1255", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code+" "+tc.amount, func(t *testing.T) {
+			c, err := Lookup(tc.code)
+			require.NoError(t, err)
+			assert.Equal(t, tc.fits, c.Fits(decimal.RequireFromString(tc.amount)))
+		})
+	}
+}
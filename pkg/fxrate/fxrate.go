@@ -0,0 +1,110 @@
+// Package fxrate provides exchange rates, either from a fixed table in the
+// config file or from an HTTP rates API.
+package fxrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/shopspring/decimal"
+)
+
+const defaultHTTPTimeout = 5 * time.Second
+
+var ErrRateUnavailable = errors.New("no exchange rate available for the currency pair")
+
+// Static serves the rates configured under [[fx.rates]]. A pair that is only
+// configured the other way round is served with the inverse rate.
+type Static struct {
+	rates map[string]decimal.Decimal
+}
+
+func NewStatic(config []util.FXRateConfig) (*Static, error) {
+	s := &Static{rates: make(map[string]decimal.Decimal, len(config))}
+
+	for _, rc := range config {
+		rate, err := decimal.NewFromString(rc.Rate)
+		if err != nil || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s/%s", rc.Rate, rc.From, rc.To)
+		}
+		s.rates[pair(rc.From, rc.To)] = rate
+	}
+	return s, nil
+}
+
+func (s *Static) Rate(_ context.Context, from, to string) (decimal.Decimal, error) {
+	if rate, ok := s.rates[pair(from, to)]; ok {
+		return rate, nil
+	}
+	if rate, ok := s.rates[pair(to, from)]; ok {
+		return decimal.NewFromInt(1).DivRound(rate, 12), nil
+	}
+	return decimal.Zero, ErrRateUnavailable
+}
+
+// HTTP asks a Frankfurter compatible API for rates, i.e. it requests
+// GET <url>?from=EUR&to=USD and expects {"base": "EUR", "rates": {"USD": 1.085}}.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTP(config util.FXHTTPConfig) (*HTTP, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid rates url %q: %w", config.URL, err)
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &HTTP{url: config.URL, client: &http.Client{Timeout: timeout}}, nil
+}
+
+type ratesResponse struct {
+	Base  string                     `json:"base"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+func (h *HTTP) Rate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	query := url.Values{"from": {from}, "to": {to}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("requesting rate %s/%s: %w", from, to, err)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("requesting rate %s/%s: %w", from, to, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity {
+		return decimal.Zero, ErrRateUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decimal.Zero, fmt.Errorf("requesting rate %s/%s: unexpected status %d", from, to, resp.StatusCode)
+	}
+
+	body := ratesResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return decimal.Zero, fmt.Errorf("decoding rate %s/%s: %w", from, to, err)
+	}
+
+	rate, ok := body.Rates[to]
+	if !ok || !strings.EqualFold(body.Base, from) || rate.Sign() <= 0 {
+		return decimal.Zero, ErrRateUnavailable
+	}
+	return rate, nil
+}
+
+func pair(from, to string) string {
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
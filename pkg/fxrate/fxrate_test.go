@@ -0,0 +1,72 @@
+package fxrate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatic(t *testing.T) {
+	provider, err := NewStatic([]util.FXRateConfig{{From: "EUR", To: "USD", Rate: "1.25"}})
+	require.NoError(t, err)
+
+	rate, err := provider.Rate(context.Background(), "EUR", "USD")
+	require.NoError(t, err)
+	assert.True(t, rate.Equal(decimal.RequireFromString("1.25")), "rate is %s", rate)
+
+	rate, err = provider.Rate(context.Background(), "USD", "EUR")
+	require.NoError(t, err)
+	assert.True(t, rate.Equal(decimal.RequireFromString("0.8")), "inverse rate is %s", rate)
+
+	_, err = provider.Rate(context.Background(), "EUR", "JPY")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+
+	_, err = NewStatic([]util.FXRateConfig{{From: "EUR", To: "USD", Rate: "-1"}})
+	assert.Error(t, err)
+}
+
+func TestHTTP(t *testing.T) {
+	// A local fake of the rates API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("from") != "EUR" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"amount": 1.0, "base": "EUR", "date": "2024-01-02", "rates": {"USD": 1.0956}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewHTTP(util.FXHTTPConfig{URL: server.URL})
+	require.NoError(t, err)
+
+	rate, err := provider.Rate(context.Background(), "EUR", "USD")
+	require.NoError(t, err)
+	assert.True(t, rate.Equal(decimal.RequireFromString("1.0956")), "rate is %s", rate)
+
+	_, err = provider.Rate(context.Background(), "EUR", "JPY")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+
+	_, err = provider.Rate(context.Background(), "GBP", "USD")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+}
+
+func TestHTTPServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	provider, err := NewHTTP(util.FXHTTPConfig{URL: server.URL})
+	require.NoError(t, err)
+
+	_, err = provider.Rate(context.Background(), "EUR", "USD")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRateUnavailable)
+}
@@ -0,0 +1,93 @@
+// Package health checks the dependencies of the service, each with its own
+// deadline, and reports their status and latency.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check returns an error when the dependency cannot be used.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report holds the result of each check by name. Healthy is true when every
+// check is up.
+type Report struct {
+	Healthy bool              `json:"-"`
+	Checks  map[string]Result `json:"checks"`
+}
+
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecker returns a checker that gives each check timeout to answer.
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &Checker{timeout: timeout, checks: map[string]Check{}}
+}
+
+// Add registers check under name, replacing an earlier one of that name.
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+		sort.Strings(c.names)
+	}
+	c.checks[name] = check
+}
+
+// Run runs all checks concurrently and waits for them.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Healthy: true, Checks: make(map[string]Result, len(c.names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range c.names {
+		name, check := name, c.checks[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Healthy = false
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		return Result{Status: StatusDown, LatencyMS: latency, Error: err.Error()}
+	}
+	return Result{Status: StatusUp, LatencyMS: latency}
+}
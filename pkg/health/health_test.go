@@ -0,0 +1,48 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("mysql", func(ctx context.Context) error { return nil })
+	checker.Add("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Run(context.Background())
+	assert.False(t, report.Healthy)
+	assert.Equal(t, StatusUp, report.Checks["mysql"].Status)
+	assert.Empty(t, report.Checks["mysql"].Error)
+	assert.Equal(t, StatusDown, report.Checks["redis"].Status)
+	assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+}
+
+func TestRunTimesOutSlowChecks(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checker.Add("fast", func(ctx context.Context) error { return nil })
+
+	start := time.Now()
+	report := checker.Run(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+
+	assert.False(t, report.Healthy)
+	assert.Equal(t, StatusDown, report.Checks["slow"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.GreaterOrEqual(t, report.Checks["slow"].LatencyMS, float64(50))
+	assert.Equal(t, StatusUp, report.Checks["fast"].Status)
+}
+
+func TestRunWithoutChecksIsHealthy(t *testing.T) {
+	report := NewChecker(0).Run(context.Background())
+	assert.True(t, report.Healthy)
+	assert.Empty(t, report.Checks)
+}
@@ -1,7 +1,9 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/mohammadrabetian/quick/util"
 	"github.com/sirupsen/logrus"
@@ -13,6 +15,8 @@ type SQLDatabase struct {
 	*gorm.DB
 }
 
+// NewDatabase opens the connection pool without connecting, so the service
+// can start while MySQL is down. Connect waits until it is reachable.
 func NewDatabase(config util.Config) SQLDatabase {
 
 	username := config.MySQL.User
@@ -23,15 +27,59 @@ func NewDatabase(config util.Config) SQLDatabase {
 
 	url := fmt.Sprintf("%s:%s@tcp(%s:%v)/%s?charset=utf8&parseTime=True&loc=Local", username, password, host, port, dbname)
 
-	db, err := gorm.Open(mysql.Open(url), &gorm.Config{})
-
+	// Asking for the server version would connect, the schema is managed by
+	// the migrations so gorm does not need it
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: url, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+	})
 	if err != nil {
-		panic("failed to connect to mysql database")
+		logrus.Fatalf("invalid mysql configuration: %v", err)
 	}
 
-	logrus.Info("SQLDatabase connection established")
-
 	return SQLDatabase{
 		DB: db,
 	}
 }
+
+// Connect pings the database until it answers or ctx is done. The delay
+// between attempts starts at backoff_base and doubles up to backoff_max.
+func Connect(ctx context.Context, db *gorm.DB, config util.MySQLConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	backoff := config.BackoffBase
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	maxBackoff := config.BackoffMax
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := sqlDB.PingContext(ctx)
+		if err == nil {
+			logrus.Info("SQLDatabase connection established")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("cannot connect to mysql: %w", err)
+		}
+
+		logrus.WithError(err).WithField("attempt", attempt).Warnf("cannot connect to mysql, retrying in %s", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("cannot connect to mysql: %w", err)
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
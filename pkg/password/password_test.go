@@ -0,0 +1,63 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, IsHashed(hash))
+
+	match, needsRehash, err := Verify("correct horse battery staple", hash)
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.False(t, needsRehash)
+
+	match, _, err = Verify("wrong password", hash)
+	assert.NoError(t, err)
+	assert.False(t, match)
+
+	other, err := Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+}
+
+func TestVerifyOutdatedParams(t *testing.T) {
+	old := DefaultParams
+	old.Iterations = 1
+	hash, err := hashWithParams("password1", old)
+	require.NoError(t, err)
+
+	match, needsRehash, err := Verify("password1", hash)
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, needsRehash)
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	require.NoError(t, err)
+	assert.True(t, IsHashed(string(hash)))
+
+	match, needsRehash, err := Verify("password1", string(hash))
+	assert.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, needsRehash)
+
+	match, needsRehash, err = Verify("password2", string(hash))
+	assert.NoError(t, err)
+	assert.False(t, match)
+	assert.False(t, needsRehash)
+}
+
+func TestVerifyPlaintext(t *testing.T) {
+	assert.False(t, IsHashed("password1"))
+
+	_, _, err := Verify("password1", "password1")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+}
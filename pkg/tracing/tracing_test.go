@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type record struct {
+	ID   uint64 `gorm:"primaryKey"`
+	Name string
+}
+
+// recordSpans installs a tracer provider that keeps the ended spans.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(util.TracingConfig{Exporter: "none", SampleRatio: 1}, "testing")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup(util.TracingConfig{Exporter: "stdout"}, "testing")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(util.TracingConfig{Exporter: "zipkin"}, "testing")
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+}
+
+func TestGormPlugin(t *testing.T) {
+	recorder := recordSpans(t)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&record{}))
+	require.NoError(t, db.Use(GormPlugin{DBSystem: semconv.DBSystemMySQL}))
+
+	// Outside of a trace nothing is recorded
+	require.NoError(t, db.Create(&record{Name: "untraced"}).Error)
+	assert.Empty(t, recorder.Ended())
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	require.NoError(t, db.WithContext(ctx).Create(&record{Name: "traced"}).Error)
+	var found record
+	require.NoError(t, db.WithContext(ctx).Where("name = ?", "traced").First(&found).Error)
+	assert.Error(t, db.WithContext(ctx).Exec("SELECT * FROM missing").Error)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	for _, span := range spans[:3] {
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+
+	assert.Equal(t, "gorm.create", spans[0].Name())
+	assert.Equal(t, "records", attributes(spans[0])[semconv.DBSQLTableKey].AsString())
+	assert.Equal(t, "mysql", attributes(spans[0])[semconv.DBSystemKey].AsString())
+
+	assert.Equal(t, "gorm.query", spans[1].Name())
+	statement := attributes(spans[1])[semconv.DBStatementKey].AsString()
+	assert.Contains(t, statement, "name = ?")
+	assert.NotContains(t, statement, "traced")
+
+	assert.Equal(t, "gorm.raw", spans[2].Name())
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestRedisHook(t *testing.T) {
+	recorder := recordSpans(t)
+
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+	rdb.AddHook(RedisHook{})
+
+	require.NoError(t, rdb.Set(context.Background(), "untraced", 1, 0).Err())
+	assert.Empty(t, recorder.Ended())
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	require.NoError(t, rdb.Set(ctx, "wallet_1", "secret", 0).Err())
+	// A miss is not an error
+	assert.ErrorIs(t, rdb.Get(ctx, "wallet_2").Err(), redis.Nil)
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, "wallet_1")
+		pipe.Del(ctx, "wallet_2")
+		return nil
+	})
+	require.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	assert.Equal(t, "redis.set", spans[0].Name())
+	assert.Equal(t, "redis.get", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	assert.Equal(t, "redis.pipeline", spans[2].Name())
+	assert.Equal(t, int64(2), attributes(spans[2])["db.redis.num_cmd"].AsInt64())
+	assert.Equal(t, "request", spans[3].Name())
+
+	for _, span := range spans[:3] {
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		for _, kv := range span.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), "secret")
+		}
+	}
+}
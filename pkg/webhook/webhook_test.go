@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	timestamp := time.Unix(1680955200, 0)
+	body := []byte(`{"id":1}`)
+
+	signature := Sign("0123456789abcdef", timestamp, body)
+	assert.Equal(t, "sha256=", signature[:7])
+	assert.True(t, Verify("0123456789abcdef", timestamp, body, signature))
+
+	assert.False(t, Verify("another secret!!", timestamp, body, signature))
+	assert.False(t, Verify("0123456789abcdef", timestamp.Add(time.Second), body, signature))
+	assert.False(t, Verify("0123456789abcdef", timestamp, []byte(`{"id":2}`), signature))
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second, false).Post(server.URL, "application/json", nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), "err is %s", err)
+
+	resp, err := NewClient(time.Second, true).Post(server.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(time.Second, true).Post(server.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
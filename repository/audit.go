@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+type auditMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditMySQLRepository(db *gorm.DB) AuditRepository {
+	return &auditMySQLRepository{db: db}
+}
+
+// CreateEntry writes the entry inside tx, so that it is only kept together
+// with the change it describes.
+func (r *auditMySQLRepository) CreateEntry(tx *gorm.DB, entry *domain.AuditEntry) error {
+	return tx.Create(entry).Error
+}
+
+// ListEntries returns the latest entries about the target, newest first.
+func (r *auditMySQLRepository) ListEntries(ctx context.Context, targetType string, targetID uint64, limit int) ([]domain.AuditEntry, error) {
+	var entries []domain.AuditEntry
+	err := r.db.WithContext(ctx).Where("target_type = ? AND target_id = ?", targetType, targetID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	CreateEntry(tx *gorm.DB, entry *domain.AuditEntry) error
+	ListEntries(ctx context.Context, targetType string, targetID uint64, limit int) ([]domain.AuditEntry, error)
+}
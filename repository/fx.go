@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrQuoteNotFound = errors.New("quote not found")
+
+type fxMySQLRepository struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewFXMySQLRepository(db *gorm.DB, cache *redis.Client) FXRepository {
+	return &fxMySQLRepository{db: db, cache: cache}
+}
+
+func (r *fxMySQLRepository) GetCachedRate(ctx context.Context, from, to string) (decimal.Decimal, bool) {
+	rateString, err := r.cache.Get(ctx, fxRateCacheKey(from, to)).Result()
+	if err != nil {
+		return decimal.Zero, false
+	}
+
+	rate, err := decimal.NewFromString(rateString)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	return rate, true
+}
+
+func (r *fxMySQLRepository) CacheRate(ctx context.Context, from, to string, rate decimal.Decimal, ttl time.Duration) {
+	r.cache.Set(ctx, fxRateCacheKey(from, to), rate.String(), ttl)
+}
+
+func (r *fxMySQLRepository) CreateQuote(ctx context.Context, quote *domain.FXQuote) error {
+	return r.db.WithContext(ctx).Create(quote).Error
+}
+
+// GetQuoteForUpdate reads the quote inside tx and locks its row until the
+// transaction ends, so that it cannot be used by two transfers.
+func (r *fxMySQLRepository) GetQuoteForUpdate(tx *gorm.DB, id uint64) (*domain.FXQuote, error) {
+	quote := &domain.FXQuote{}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(quote, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQuoteNotFound
+		}
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+func (r *fxMySQLRepository) MarkQuoteUsed(tx *gorm.DB, id uint64, usedAt time.Time) error {
+	return tx.Model(&domain.FXQuote{}).Where("id = ?", id).Update("used_at", usedAt).Error
+}
+
+func fxRateCacheKey(from, to string) string {
+	return fmt.Sprintf("fx_rate_%s_%s", from, to)
+}
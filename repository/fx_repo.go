@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type FXRepository interface {
+	GetCachedRate(ctx context.Context, from, to string) (decimal.Decimal, bool)
+	CacheRate(ctx context.Context, from, to string, rate decimal.Decimal, ttl time.Duration)
+	CreateQuote(ctx context.Context, quote *domain.FXQuote) error
+	GetQuoteForUpdate(tx *gorm.DB, id uint64) (*domain.FXQuote, error)
+	MarkQuoteUsed(tx *gorm.DB, id uint64, usedAt time.Time) error
+}
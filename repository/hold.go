@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrHoldNotFound = errors.New("hold not found")
+
+type holdMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewHoldMySQLRepository(db *gorm.DB) HoldRepository {
+	return &holdMySQLRepository{db: db}
+}
+
+func (r *holdMySQLRepository) GetDB() *gorm.DB {
+	return r.db
+}
+
+func (r *holdMySQLRepository) CreateHold(tx *gorm.DB, hold *domain.Hold) error {
+	return tx.Create(hold).Error
+}
+
+// GetHoldForUpdate reads the hold inside tx and locks its row until the
+// transaction ends.
+func (r *holdMySQLRepository) GetHoldForUpdate(tx *gorm.DB, id uint64) (*domain.Hold, error) {
+	hold := &domain.Hold{}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(hold, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (r *holdMySQLRepository) UpdateHold(tx *gorm.DB, hold *domain.Hold) error {
+	return tx.Model(&domain.Hold{}).Where("id = ?", hold.ID).Updates(map[string]interface{}{
+		"status":          hold.Status,
+		"captured_amount": hold.CapturedAmount,
+	}).Error
+}
+
+// ListExpiredHolds returns up to limit active holds that expired before now,
+// with an ID above afterID, in order of their ID.
+func (r *holdMySQLRepository) ListExpiredHolds(ctx context.Context, now time.Time, afterID uint64, limit int) ([]domain.Hold, error) {
+	var holds []domain.Hold
+	err := r.db.WithContext(ctx).Where("status = ? AND expires_at <= ? AND id > ?", domain.HoldStatusActive, now, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&holds).Error
+	return holds, err
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+type HoldRepository interface {
+	CreateHold(tx *gorm.DB, hold *domain.Hold) error
+	GetHoldForUpdate(tx *gorm.DB, id uint64) (*domain.Hold, error)
+	UpdateHold(tx *gorm.DB, hold *domain.Hold) error
+	ListExpiredHolds(ctx context.Context, now time.Time, afterID uint64, limit int) ([]domain.Hold, error)
+	GetDB() *gorm.DB
+}
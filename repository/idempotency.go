@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	idempotencyLockTTL    = 30 * time.Second
+)
+
+type idempotencyMySQLRepository struct {
+	db    *gorm.DB
+	cache *redis.Client
+	ttl   time.Duration
+}
+
+// NewIdempotencyMySQLRepository stores records durably in MySQL and keeps a
+// copy in Redis for ttl, which defaults to 24 hours.
+func NewIdempotencyMySQLRepository(db *gorm.DB, cache *redis.Client, ttl time.Duration) IdempotencyRepository {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyMySQLRepository{db: db, cache: cache, ttl: ttl}
+}
+
+func (r *idempotencyMySQLRepository) GetRecord(ctx context.Context, userID uint64, key string) (*domain.IdempotencyRecord, error) {
+	cacheKey := idempotencyCacheKey(userID, key)
+
+	recordJSON, err := r.cache.Get(ctx, cacheKey).Result()
+	if err == nil {
+		record := &domain.IdempotencyRecord{}
+		if err := json.Unmarshal([]byte(recordJSON), record); err == nil {
+			return record, nil
+		}
+	}
+
+	record := &domain.IdempotencyRecord{}
+	err = r.db.WithContext(ctx).Where("user_id = ? AND idempotency_key = ?", userID, key).First(record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Records without a response yet are not cached, they may still change
+	if record.StatusCode != 0 {
+		r.cacheRecord(ctx, record)
+	}
+	return record, nil
+}
+
+// CreateRecord stores the record of a request about to run, without its
+// response.
+func (r *idempotencyMySQLRepository) CreateRecord(ctx context.Context, record *domain.IdempotencyRecord) error {
+	return r.db.WithContext(ctx).Create(record).Error
+}
+
+// CompleteRecord stores the response of the request of record.
+func (r *idempotencyMySQLRepository) CompleteRecord(ctx context.Context, record *domain.IdempotencyRecord) error {
+	result := r.db.WithContext(ctx).Model(&domain.IdempotencyRecord{}).
+		Where("user_id = ? AND idempotency_key = ?", record.UserID, record.IdempotencyKey).
+		Updates(map[string]interface{}{"status_code": record.StatusCode, "response_body": record.ResponseBody})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	r.cacheRecord(ctx, record)
+	return nil
+}
+
+// DeleteRecord frees the key for a retry. The row is deleted for good, a soft
+// deleted one would still hold the unique key.
+func (r *idempotencyMySQLRepository) DeleteRecord(ctx context.Context, userID uint64, key string) error {
+	return r.db.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND idempotency_key = ?", userID, key).
+		Delete(&domain.IdempotencyRecord{}).Error
+}
+
+// Lock marks the key as being processed, so that a retry arriving while the
+// first request is still running is not executed a second time. It returns
+// the owner token Unlock needs.
+func (r *idempotencyMySQLRepository) Lock(ctx context.Context, userID uint64, key string) (string, bool, error) {
+	return acquireLock(ctx, r.cache, idempotencyLockKey(userID, key), idempotencyLockTTL)
+}
+
+// Unlock releases the key unless its lock expired and was taken by a retry.
+func (r *idempotencyMySQLRepository) Unlock(ctx context.Context, userID uint64, key, owner string) {
+	releaseLock(ctx, r.cache, idempotencyLockKey(userID, key), owner)
+}
+
+func (r *idempotencyMySQLRepository) cacheRecord(ctx context.Context, record *domain.IdempotencyRecord) {
+	recordBytes, err := json.Marshal(record)
+	if err == nil {
+		r.cache.Set(ctx, idempotencyCacheKey(record.UserID, record.IdempotencyKey), string(recordBytes), r.ttl)
+	}
+}
+
+func idempotencyCacheKey(userID uint64, key string) string {
+	return fmt.Sprintf("idempotency_%d_%s", userID, key)
+}
+
+func idempotencyLockKey(userID uint64, key string) string {
+	return idempotencyCacheKey(userID, key) + "_lock"
+}
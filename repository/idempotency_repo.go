@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mohammadrabetian/quick/domain"
+)
+
+type IdempotencyRepository interface {
+	GetRecord(ctx context.Context, userID uint64, key string) (*domain.IdempotencyRecord, error)
+	CreateRecord(ctx context.Context, record *domain.IdempotencyRecord) error
+	CompleteRecord(ctx context.Context, record *domain.IdempotencyRecord) error
+	DeleteRecord(ctx context.Context, userID uint64, key string) error
+	Lock(ctx context.Context, userID uint64, key string) (string, bool, error)
+	Unlock(ctx context.Context, userID uint64, key, owner string)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The locks kept in Redis hold a random token of their owner, so that an
+// instance whose lock expired and was taken over by another one cannot renew
+// or release the lock of the new owner.
+
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// acquireLock takes the lock for ttl and returns its owner token, or false if
+// it is held by someone else.
+func acquireLock(ctx context.Context, cache *redis.Client, key string, ttl time.Duration) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(b)
+
+	locked, err := cache.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !locked {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// renewLock extends the lock to ttl and reports whether token still owns it.
+func renewLock(ctx context.Context, cache *redis.Client, key, token string, ttl time.Duration) (bool, error) {
+	renewed, err := renewLockScript.Run(ctx, cache, []string{key}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return renewed == 1, nil
+}
+
+// releaseLock deletes the lock if token still owns it.
+func releaseLock(ctx context.Context, cache *redis.Client, key, token string) error {
+	return releaseLockScript.Run(ctx, cache, []string{key}, token).Err()
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+const outboxRelayLockKey = "outbox_relay_lock"
+
+// maxErrorLength is the size of the last_error column
+const maxErrorLength = 255
+
+type outboxMySQLRepository struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewOutboxMySQLRepository(db *gorm.DB, cache *redis.Client) OutboxRepository {
+	return &outboxMySQLRepository{db: db, cache: cache}
+}
+
+func (r *outboxMySQLRepository) CreateEvent(tx *gorm.DB, event *domain.OutboxEvent) error {
+	return tx.Create(event).Error
+}
+
+// ListUnpublished returns up to limit events which are neither published nor
+// dead-lettered, oldest first.
+func (r *outboxMySQLRepository) ListUnpublished(ctx context.Context, limit int) ([]domain.OutboxEvent, error) {
+	var events []domain.OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("published_at IS NULL AND dead_lettered_at IS NULL").
+		Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *outboxMySQLRepository) MarkPublished(ctx context.Context, ids []uint64, publishedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&domain.OutboxEvent{}).Where("id IN ?", ids).Update("published_at", publishedAt).Error
+}
+
+func (r *outboxMySQLRepository) MarkFailed(ctx context.Context, id uint64, reason string, maxAttempts int) (bool, error) {
+	if len(reason) > maxErrorLength {
+		reason = reason[:maxErrorLength]
+	}
+
+	deadLettered := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&domain.OutboxEvent{}).
+			Where("id = ? AND attempts >= ? AND dead_lettered_at IS NULL", id, maxAttempts).
+			Update("dead_lettered_at", time.Now())
+		deadLettered = result.RowsAffected > 0
+		return result.Error
+	})
+	return deadLettered, err
+}
+
+func (r *outboxMySQLRepository) AcquireRelayLock(ctx context.Context, ttl time.Duration) (string, bool, error) {
+	return acquireLock(ctx, r.cache, outboxRelayLockKey, ttl)
+}
+
+func (r *outboxMySQLRepository) RenewRelayLock(ctx context.Context, owner string, ttl time.Duration) (bool, error) {
+	return renewLock(ctx, r.cache, outboxRelayLockKey, owner, ttl)
+}
+
+func (r *outboxMySQLRepository) ReleaseRelayLock(ctx context.Context, owner string) error {
+	return releaseLock(ctx, r.cache, outboxRelayLockKey, owner)
+}
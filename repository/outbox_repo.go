@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+type OutboxRepository interface {
+	CreateEvent(tx *gorm.DB, event *domain.OutboxEvent) error
+	ListUnpublished(ctx context.Context, limit int) ([]domain.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []uint64, publishedAt time.Time) error
+	// MarkFailed records a failed attempt and dead-letters the event once it
+	// failed maxAttempts times. It reports whether the event was dead-lettered.
+	MarkFailed(ctx context.Context, id uint64, reason string, maxAttempts int) (bool, error)
+	// AcquireRelayLock makes sure only one relay publishes at a time, which
+	// keeps the events of a key in order across instances. It returns the
+	// owner token needed to renew and release the lock.
+	AcquireRelayLock(ctx context.Context, ttl time.Duration) (string, bool, error)
+	// RenewRelayLock reports whether owner still held the lock.
+	RenewRelayLock(ctx context.Context, owner string, ttl time.Duration) (bool, error)
+	ReleaseRelayLock(ctx context.Context, owner string) error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+type refreshTokenMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenMySQLRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenMySQLRepository{db: db}
+}
+
+func (r *refreshTokenMySQLRepository) CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *refreshTokenMySQLRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// MarkRefreshTokenUsed reports false if the token had already been used,
+// which also covers two concurrent refreshes with the same token.
+func (r *refreshTokenMySQLRepository) MarkRefreshTokenUsed(ctx context.Context, id uint64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *refreshTokenMySQLRepository) DeleteRefreshTokensBySession(ctx context.Context, sessionID uint64) error {
+	return r.db.WithContext(ctx).Where("session_id = ?", sessionID).Delete(&domain.RefreshToken{}).Error
+}
+
+func (r *refreshTokenMySQLRepository) PurgeRefreshTokens(ctx context.Context, now time.Time, limit int) (int64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Unscoped().Model(&domain.RefreshToken{}).
+		Where("expires_at <= ? OR deleted_at IS NOT NULL OR session_id NOT IN (SELECT id FROM sessions)", now).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := r.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Delete(&domain.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
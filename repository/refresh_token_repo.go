@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *domain.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id uint64) (bool, error)
+	DeleteRefreshTokensBySession(ctx context.Context, sessionID uint64) error
+	// PurgeRefreshTokens deletes up to limit refresh tokens that expired
+	// before now, were revoked or whose session is gone for good, and returns
+	// how many it deleted.
+	PurgeRefreshTokens(ctx context.Context, now time.Time, limit int) (int64, error)
+}
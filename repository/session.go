@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type sessionMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionMySQLRepository(db *gorm.DB) SessionRepository {
+	return &sessionMySQLRepository{db: db}
+}
+
+func (r *sessionMySQLRepository) GetDB() *gorm.DB {
+	return r.db
+}
+
+func (r *sessionMySQLRepository) CreateSession(tx *gorm.DB, session *domain.Session) error {
+	return tx.Create(session).Error
+}
+
+func (r *sessionMySQLRepository) GetSessionByID(ctx context.Context, id uint64) (*domain.Session, error) {
+	session := &domain.Session{}
+	err := r.db.WithContext(ctx).First(session, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (r *sessionMySQLRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*domain.Session, error) {
+	session := &domain.Session{}
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ListSessionsByUser returns the user's sessions that have not expired yet,
+// most recently created first.
+func (r *sessionMySQLRepository) ListSessionsByUser(ctx context.Context, userID uint64) ([]domain.Session, error) {
+	var sessions []domain.Session
+	err := r.db.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionMySQLRepository) TouchSession(ctx context.Context, id uint64, lastUsedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&domain.Session{}).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+func (r *sessionMySQLRepository) ExtendSession(ctx context.Context, id uint64, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&domain.Session{}).Where("id = ?", id).Update("expires_at", expiresAt).Error
+}
+
+// DeleteSession revokes one session, as long as it belongs to the user.
+func (r *sessionMySQLRepository) DeleteSession(ctx context.Context, userID, id uint64) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&domain.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *sessionMySQLRepository) DeleteSessionsByUser(ctx context.Context, userID uint64) (int64, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.Session{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *sessionMySQLRepository) PurgeSessions(ctx context.Context, now time.Time, limit int) (int64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Unscoped().Model(&domain.Session{}).
+		Where("expires_at <= ? OR deleted_at IS NOT NULL", now).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	result := r.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Delete(&domain.Session{})
+	return result.RowsAffected, result.Error
+}
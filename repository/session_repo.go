@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+)
+
+// SessionRepository reads and writes sessions. CreateSession uses the context
+// of tx.
+type SessionRepository interface {
+	GetDB() *gorm.DB
+	CreateSession(tx *gorm.DB, session *domain.Session) error
+	GetSessionByID(ctx context.Context, id uint64) (*domain.Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (*domain.Session, error)
+	ListSessionsByUser(ctx context.Context, userID uint64) ([]domain.Session, error)
+	TouchSession(ctx context.Context, id uint64, lastUsedAt time.Time) error
+	ExtendSession(ctx context.Context, id uint64, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, userID, id uint64) error
+	DeleteSessionsByUser(ctx context.Context, userID uint64) (int64, error)
+	// PurgeSessions deletes up to limit sessions that expired before now or
+	// were revoked for good, and returns how many it deleted.
+	PurgeSessions(ctx context.Context, now time.Time, limit int) (int64, error)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+type transactionMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewTransactionMySQLRepository(db *gorm.DB) TransactionRepository {
+	return &transactionMySQLRepository{db: db}
+}
+
+func (r *transactionMySQLRepository) CreateTransaction(tx *gorm.DB, transaction *domain.Transaction) error {
+	return tx.Create(transaction).Error
+}
+
+// GetTransactionForUpdate reads the transaction inside tx and locks its row
+// until the transaction ends.
+func (r *transactionMySQLRepository) GetTransactionForUpdate(tx *gorm.DB, id uint64) (*domain.Transaction, error) {
+	transaction := &domain.Transaction{}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(transaction, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (r *transactionMySQLRepository) UpdateReversedAmount(tx *gorm.DB, id uint64, reversed decimal.Decimal) error {
+	return tx.Model(&domain.Transaction{}).Where("id = ?", id).Update("reversed_amount", reversed).Error
+}
+
+func (r *transactionMySQLRepository) ListTransactions(ctx context.Context, walletID uint64, filter TransactionFilter) ([]domain.Transaction, int64, error) {
+	query := r.db.WithContext(ctx).Model(&domain.Transaction{}).Where("wallet_id = ?", walletID)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var transactions []domain.Transaction
+	err := query.Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&transactions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return transactions, total, nil
+}
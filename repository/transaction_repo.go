@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// TransactionFilter narrows down and paginates a wallet's transactions.
+// Zero values mean no restriction.
+type TransactionFilter struct {
+	Type     domain.TransactionType
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+type TransactionRepository interface {
+	CreateTransaction(tx *gorm.DB, transaction *domain.Transaction) error
+	GetTransactionForUpdate(tx *gorm.DB, id uint64) (*domain.Transaction, error)
+	UpdateReversedAmount(tx *gorm.DB, id uint64, reversed decimal.Decimal) error
+	ListTransactions(ctx context.Context, walletID uint64, filter TransactionFilter) ([]domain.Transaction, int64, error)
+}
@@ -1,12 +1,16 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/mohammadrabetian/quick/domain"
 	"gorm.io/gorm"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type userMySQLRepository struct {
 	db *gorm.DB
 }
@@ -15,9 +19,13 @@ func NewUserMySQLRepository(db *gorm.DB) UserRepository {
 	return &userMySQLRepository{db: db}
 }
 
-func (r *userMySQLRepository) GetUserByUsername(username string) (*domain.User, error) {
+func (r *userMySQLRepository) GetDB() *gorm.DB {
+	return r.db
+}
+
+func (r *userMySQLRepository) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
 	user := &domain.User{}
-	err := r.db.Where("username = ?", username).First(user).Error
+	err := r.db.WithContext(ctx).Where("username = ?", username).First(user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -28,9 +36,9 @@ func (r *userMySQLRepository) GetUserByUsername(username string) (*domain.User,
 	return user, nil
 }
 
-func (r *userMySQLRepository) GetUserByToken(token string) (*domain.User, error) {
+func (r *userMySQLRepository) GetUserByID(ctx context.Context, id uint64) (*domain.User, error) {
 	user := &domain.User{}
-	err := r.db.Where("token = ?", token).First(user).Error
+	err := r.db.WithContext(ctx).First(user, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -41,6 +49,25 @@ func (r *userMySQLRepository) GetUserByToken(token string) (*domain.User, error)
 	return user, nil
 }
 
-func (r *userMySQLRepository) UpdateUser(user *domain.User) error {
-	return r.db.Save(user).Error
+func (r *userMySQLRepository) CreateUser(tx *gorm.DB, user *domain.User) error {
+	return tx.Create(user).Error
+}
+
+func (r *userMySQLRepository) UpdateUser(ctx context.Context, user *domain.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
+
+func (r *userMySQLRepository) ListUsers(ctx context.Context) ([]domain.User, error) {
+	var users []domain.User
+	err := r.db.WithContext(ctx).Order("id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetDisabled disables the user inside tx, or enables them when disabledAt is
+// nil.
+func (r *userMySQLRepository) SetDisabled(tx *gorm.DB, id uint64, disabledAt *time.Time) error {
+	return tx.Model(&domain.User{}).Where("id = ?", id).Update("disabled_at", disabledAt).Error
 }
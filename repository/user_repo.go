@@ -1,11 +1,21 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
 )
 
+// UserRepository reads and writes users. CreateUser and SetDisabled use the
+// context of tx.
 type UserRepository interface {
-	GetUserByUsername(username string) (*domain.User, error)
-	GetUserByToken(token string) (*domain.User, error)
-	UpdateUser(user *domain.User) error
+	GetUserByID(ctx context.Context, id uint64) (*domain.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	CreateUser(tx *gorm.DB, user *domain.User) error
+	UpdateUser(ctx context.Context, user *domain.User) error
+	ListUsers(ctx context.Context) ([]domain.User, error)
+	SetDisabled(tx *gorm.DB, id uint64, disabledAt *time.Time) error
+	GetDB() *gorm.DB
 }
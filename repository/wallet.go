@@ -5,15 +5,30 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/metrics"
+	"github.com/mohammadrabetian/quick/util"
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var ErrWalletNotFound = errors.New("wallet not found")
 var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrWalletFrozen = errors.New("wallet is frozen")
+
+const (
+	// walletCacheTTL bounds how long a wallet whose invalidation failed can be
+	// served stale
+	walletCacheTTL = 5 * time.Minute
+	// invalidationTimeout is the deadline of dropping cached wallets, which
+	// does not depend on the request that changed them
+	invalidationTimeout = time.Second
+)
 
 type walletMySQLRepository struct {
 	db    *gorm.DB
@@ -27,22 +42,28 @@ func NewWalletMySQLRepository(db *gorm.DB, cache *redis.Client) WalletRepository
 	return &walletMySQLRepository{db: db, cache: cache}
 }
 
-func (r *walletMySQLRepository) GetWallet(id uint64) (*domain.Wallet, error) {
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("wallet_%d", id)
+func (r *walletMySQLRepository) GetWallet(ctx context.Context, id uint64) (*domain.Wallet, error) {
+	cacheKey := walletCacheKey(id)
 
 	// Get the wallet object from cache
 	walletJSON, err := r.cache.Get(ctx, cacheKey).Result()
-	if err == nil {
+	switch {
+	case err == nil:
 		wallet := &domain.Wallet{}
 		if err := json.Unmarshal([]byte(walletJSON), wallet); err == nil {
+			metrics.CacheLookup("wallet", metrics.CacheHit)
 			return wallet, nil
 		}
+		metrics.CacheLookup("wallet", metrics.CacheError)
+	case errors.Is(err, redis.Nil):
+		metrics.CacheLookup("wallet", metrics.CacheMiss)
+	default:
+		metrics.CacheLookup("wallet", metrics.CacheError)
 	}
 
 	wallet := &domain.Wallet{}
 
-	err = r.db.First(wallet, id).Error
+	err = r.db.WithContext(ctx).First(wallet, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrWalletNotFound
@@ -53,23 +74,120 @@ func (r *walletMySQLRepository) GetWallet(id uint64) (*domain.Wallet, error) {
 	// Cache the wallet object
 	walletBytes, err := json.Marshal(wallet)
 	if err == nil {
-		r.cache.Set(ctx, cacheKey, string(walletBytes), 0)
+		r.cache.Set(ctx, cacheKey, string(walletBytes), walletCacheTTL)
+	}
+
+	return wallet, nil
+}
+
+func (r *walletMySQLRepository) CreateWallet(ctx context.Context, wallet *domain.Wallet) error {
+	return r.db.WithContext(ctx).Create(wallet).Error
+}
+
+func (r *walletMySQLRepository) ListWalletsByOwner(ctx context.Context, ownerID uint64) ([]domain.Wallet, error) {
+	var wallets []domain.Wallet
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("id").Find(&wallets).Error
+	return wallets, err
+}
+
+// GetWalletForUpdate reads the wallet straight from the database inside tx and
+// locks its row until the transaction ends.
+func (r *walletMySQLRepository) GetWalletForUpdate(tx *gorm.DB, id uint64) (*domain.Wallet, error) {
+	wallet := &domain.Wallet{}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(wallet, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWalletNotFound
+		}
+		return nil, err
 	}
 
 	return wallet, nil
 }
 
 func (r *walletMySQLRepository) UpdateWallet(tx *gorm.DB, id uint64, balance decimal.Decimal) error {
-	ctx := context.Background()
-	cacheKey := fmt.Sprintf("wallet_%d", id)
+	return tx.Model(&domain.Wallet{}).Where("id = ?", id).Update("balance", balance).Error
+}
 
-	err := tx.Model(&domain.Wallet{}).Where("id = ?", id).Update("balance", balance).Error
+// SetFrozen freezes the wallet inside tx, or unfreezes it when frozenAt is nil.
+func (r *walletMySQLRepository) SetFrozen(tx *gorm.DB, id uint64, frozenAt *time.Time) error {
+	return tx.Model(&domain.Wallet{}).Where("id = ?", id).Update("frozen_at", frozenAt).Error
+}
+
+// AdjustBalance adds delta (which may be negative) to the wallet's balance as a
+// single locked read-modify-write inside tx, and returns the updated wallet.
+// The balance is never allowed to go below the amount held by active holds,
+// and so never below zero.
+func (r *walletMySQLRepository) AdjustBalance(tx *gorm.DB, id uint64, delta decimal.Decimal) (*domain.Wallet, error) {
+	wallet, err := r.GetWalletForUpdate(tx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Invalidate the cache entry
-	r.cache.Del(ctx, cacheKey)
+	newBalance := wallet.Balance.Add(delta)
+	if newBalance.IsNegative() || newBalance.LessThan(wallet.HeldBalance) {
+		return nil, ErrInsufficientFunds
+	}
+
+	if err := r.UpdateWallet(tx, id, newBalance); err != nil {
+		return nil, err
+	}
+	wallet.Balance = newBalance
+
+	return wallet, nil
+}
+
+// AdjustHeldBalance adds delta (which may be negative) to the amount held on
+// the wallet under a row lock inside tx. More than the balance can never be
+// held, and nothing more can be held on a frozen wallet.
+func (r *walletMySQLRepository) AdjustHeldBalance(tx *gorm.DB, id uint64, delta decimal.Decimal) (*domain.Wallet, error) {
+	wallet, err := r.GetWalletForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if delta.IsPositive() && wallet.Frozen() {
+		return nil, ErrWalletFrozen
+	}
+
+	newHeld := wallet.HeldBalance.Add(delta)
+	if newHeld.IsNegative() {
+		return nil, fmt.Errorf("held balance of wallet %d would become %s", id, newHeld)
+	}
+	if newHeld.GreaterThan(wallet.Balance) {
+		return nil, ErrInsufficientFunds
+	}
+
+	err = tx.Model(&domain.Wallet{}).Where("id = ?", id).Update("held_balance", newHeld).Error
+	if err != nil {
+		return nil, err
+	}
+	wallet.HeldBalance = newHeld
+
+	return wallet, nil
+}
+
+// InvalidateCache drops the cached wallet objects. It must be called once the
+// transaction that changed the wallets has been committed, which is why it
+// still runs when ctx has been canceled or its deadline has passed.
+func (r *walletMySQLRepository) InvalidateCache(ctx context.Context, ids ...uint64) {
+	if len(ids) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(util.WithoutCancel(ctx), invalidationTimeout)
+	defer cancel()
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, walletCacheKey(id))
+	}
+	if err := r.cache.Del(ctx, keys...).Err(); err != nil {
+		logrus.Errorf("error in invalidating the cached wallets %v, err: %s", ids, err)
+	}
+}
 
-	return nil
+// walletCacheKey versions the key, so that wallets cached before a change of
+// domain.Wallet's fields are never decoded into the new struct.
+func walletCacheKey(id uint64) string {
+	return fmt.Sprintf("wallet_v5_%d", id)
 }
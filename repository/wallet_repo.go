@@ -1,13 +1,25 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/mohammadrabetian/quick/domain"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// WalletRepository reads and writes wallets. Methods taking a tx use its
+// context, which is set by starting it with GetDB().WithContext(ctx).
 type WalletRepository interface {
-	GetWallet(id uint64) (*domain.Wallet, error)
+	GetWallet(ctx context.Context, id uint64) (*domain.Wallet, error)
+	CreateWallet(ctx context.Context, wallet *domain.Wallet) error
+	ListWalletsByOwner(ctx context.Context, ownerID uint64) ([]domain.Wallet, error)
+	GetWalletForUpdate(tx *gorm.DB, id uint64) (*domain.Wallet, error)
 	UpdateWallet(tx *gorm.DB, id uint64, balance decimal.Decimal) error
+	SetFrozen(tx *gorm.DB, id uint64, frozenAt *time.Time) error
+	AdjustBalance(tx *gorm.DB, id uint64, delta decimal.Decimal) (*domain.Wallet, error)
+	AdjustHeldBalance(tx *gorm.DB, id uint64, delta decimal.Decimal) (*domain.Wallet, error)
+	InvalidateCache(ctx context.Context, ids ...uint64)
 	GetDB() *gorm.DB
 }
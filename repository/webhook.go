@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+type webhookMySQLRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookMySQLRepository(db *gorm.DB) WebhookRepository {
+	return &webhookMySQLRepository{db: db}
+}
+
+func (r *webhookMySQLRepository) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	return r.db.WithContext(ctx).Create(subscription).Error
+}
+
+// GetSubscription returns ErrWebhookNotFound for other users' subscriptions.
+func (r *webhookMySQLRepository) GetSubscription(ctx context.Context, userID, id uint64) (*domain.WebhookSubscription, error) {
+	subscription := &domain.WebhookSubscription{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(subscription, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (r *webhookMySQLRepository) ListSubscriptions(ctx context.Context, userID uint64) ([]domain.WebhookSubscription, error) {
+	var subscriptions []domain.WebhookSubscription
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (r *webhookMySQLRepository) ListActiveSubscriptions(ctx context.Context, userIDs []uint64) ([]domain.WebhookSubscription, error) {
+	var subscriptions []domain.WebhookSubscription
+	err := r.db.WithContext(ctx).Where("user_id IN ? AND active = ?", userIDs, true).Order("id").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (r *webhookMySQLRepository) UpdateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	return r.db.WithContext(ctx).Model(&domain.WebhookSubscription{}).Where("id = ?", subscription.ID).Updates(map[string]interface{}{
+		"url":                  subscription.URL,
+		"event_types":          subscription.EventTypes,
+		"active":               subscription.Active,
+		"consecutive_failures": subscription.ConsecutiveFailures,
+		"disabled_at":          subscription.DisabledAt,
+	}).Error
+}
+
+func (r *webhookMySQLRepository) DeleteSubscription(ctx context.Context, userID, id uint64) error {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.WebhookSubscription{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *webhookMySQLRepository) RecordAttempt(ctx context.Context, id uint64, succeeded bool, disableAfter int, now time.Time) (*domain.WebhookSubscription, error) {
+	subscription := &domain.WebhookSubscription{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(subscription, id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWebhookNotFound
+			}
+			return err
+		}
+
+		if succeeded {
+			subscription.ConsecutiveFailures = 0
+		} else {
+			subscription.ConsecutiveFailures++
+			if subscription.Active && disableAfter > 0 && subscription.ConsecutiveFailures >= disableAfter {
+				subscription.Active = false
+				subscription.DisabledAt = &now
+			}
+		}
+
+		return tx.Model(subscription).Updates(map[string]interface{}{
+			"consecutive_failures": subscription.ConsecutiveFailures,
+			"active":               subscription.Active,
+			"disabled_at":          subscription.DisabledAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (r *webhookMySQLRepository) CreateDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// ListDueDeliveries returns up to limit pending deliveries of active
+// subscriptions whose next attempt is due, oldest first, together with their
+// subscription.
+func (r *webhookMySQLRepository) ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	var deliveries []domain.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Preload("Subscription").
+		Joins("JOIN webhook_subscriptions ON webhook_subscriptions.id = webhook_deliveries.subscription_id").
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", domain.WebhookDeliveryPending, now).
+		Where("webhook_subscriptions.active = ? AND webhook_subscriptions.deleted_at IS NULL", true).
+		Order("webhook_deliveries.id").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *webhookMySQLRepository) ClaimDelivery(ctx context.Context, id uint64, status domain.WebhookDeliveryStatus, nextAttemptAt, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&domain.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", id, status, nextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *webhookMySQLRepository) GetDelivery(ctx context.Context, subscriptionID, id uint64) (*domain.WebhookDelivery, error) {
+	delivery := &domain.WebhookDelivery{}
+	err := r.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).First(delivery, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ListDeliveries returns one page of the subscription's deliveries, newest
+// first, and their total number.
+func (r *webhookMySQLRepository) ListDeliveries(ctx context.Context, subscriptionID uint64, page, pageSize int) ([]domain.WebhookDelivery, int64, error) {
+	query := r.db.WithContext(ctx).Model(&domain.WebhookDelivery{}).Where("subscription_id = ?", subscriptionID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []domain.WebhookDelivery
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (r *webhookMySQLRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Model(&domain.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":           delivery.Status,
+		"attempts":         delivery.Attempts,
+		"next_attempt_at":  delivery.NextAttemptAt,
+		"last_status_code": delivery.LastStatusCode,
+		"last_error":       delivery.LastError,
+		"delivered_at":     delivery.DeliveredAt,
+	}).Error
+}
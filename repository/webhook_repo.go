@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error
+	GetSubscription(ctx context.Context, userID, id uint64) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context, userID uint64) ([]domain.WebhookSubscription, error)
+	ListActiveSubscriptions(ctx context.Context, userIDs []uint64) ([]domain.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, userID, id uint64) error
+	// RecordAttempt resets the failure count of the subscription on success.
+	// On failure it counts up and disables the subscription once disableAfter
+	// attempts in a row have failed.
+	RecordAttempt(ctx context.Context, id uint64, succeeded bool, disableAfter int, now time.Time) (*domain.WebhookSubscription, error)
+
+	// CreateDeliveries skips deliveries of an event that already exist, so
+	// that an event published twice is delivered once.
+	CreateDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error
+	ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error)
+	// ClaimDelivery moves the next attempt of a delivery in status to
+	// leaseUntil. Only one worker can claim it for the same nextAttemptAt.
+	ClaimDelivery(ctx context.Context, id uint64, status domain.WebhookDeliveryStatus, nextAttemptAt, leaseUntil time.Time) (bool, error)
+	GetDelivery(ctx context.Context, subscriptionID, id uint64) (*domain.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID uint64, page, pageSize int) ([]domain.WebhookDelivery, int64, error)
+	UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+}
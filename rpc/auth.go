@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/mohammadrabetian/quick/domain"
+	quickv1 "github.com/mohammadrabetian/quick/proto/quick/v1"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// publicMethods can be called without a token
+var publicMethods = map[string]bool{
+	quickv1.AuthService_Login_FullMethodName: true,
+}
+
+type userKey struct{}
+
+// StartedInterceptor fails the calls with Unavailable until started reports
+// true, so none runs before the schema was checked.
+func StartedInterceptor(started func() bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !started() {
+			return nil, status.Error(codes.Unavailable, "server is starting")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthInterceptor authenticates the bearer token in the "authorization"
+// metadata, like middleware.Auth does for HTTP, and puts the user into the
+// context of the handler.
+func AuthInterceptor(userService UserService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata required")
+		}
+
+		token := strings.TrimPrefix(values[0], "Bearer ")
+		if token == values[0] || token == "" {
+			return nil, status.Error(codes.Unauthenticated, "invalid token format")
+		}
+
+		user, _, err := userService.AuthenticateToken(ctx, token)
+		if err != nil {
+			logrus.Errorf("error in authenticating the token, err: %s", err)
+		}
+		if user == nil { // Unknown, revoked or expired token
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return handler(context.WithValue(ctx, userKey{}, user), req)
+	}
+}
+
+// userFromContext returns the user AuthInterceptor authenticated.
+func userFromContext(ctx context.Context) *domain.User {
+	return ctx.Value(userKey{}).(*domain.User)
+}
+
+type authServer struct {
+	quickv1.UnimplementedAuthServiceServer
+	userSvc UserService
+}
+
+func (s *authServer) Login(ctx context.Context, req *quickv1.LoginRequest) (*quickv1.LoginResponse, error) {
+	userAgent, ip := clientInfo(ctx)
+	tokens, err := s.userSvc.Login(ctx, req.Username, req.Password, userAgent, ip)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+	if errors.Is(err, service.ErrUserDisabled) {
+		return nil, status.Error(codes.PermissionDenied, "user is disabled")
+	}
+	if err != nil {
+		logrus.Errorf("error in logging in user %s, err: %s", req.Username, err)
+		return nil, status.Error(codes.Internal, "failed to log in")
+	}
+
+	return &quickv1.LoginResponse{
+		Token:        tokens.Token,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    tokens.TokenType,
+		ExpiresAt:    timestamppb.New(tokens.ExpiresAt),
+	}, nil
+}
+
+// clientInfo returns the user agent and IP address of the caller, which are
+// stored with the session.
+func clientInfo(ctx context.Context) (string, string) {
+	var userAgent, ip string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	return userAgent, ip
+}
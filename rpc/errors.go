@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps the errors of the services to the gRPC status the HTTP
+// handlers would answer with. Unknown errors become Internal with fallback as
+// message, so that no details leak.
+func toStatus(err error, fallback string) error {
+	if errors.Is(err, repository.ErrWalletNotFound) {
+		return status.Error(codes.NotFound, "wallet not found")
+	} else if errors.Is(err, repository.ErrQuoteNotFound) {
+		return status.Error(codes.NotFound, "quote not found")
+	} else if errors.Is(err, service.ErrAccessDenied) {
+		return status.Error(codes.PermissionDenied, "wallet does not belong to the user")
+	} else if errors.Is(err, repository.ErrInsufficientFunds) {
+		return status.Error(codes.FailedPrecondition, "insufficient funds, balance cannot go below 0")
+	} else if errors.Is(err, repository.ErrWalletFrozen) {
+		return status.Error(codes.FailedPrecondition, "wallet is frozen")
+	} else if errors.Is(err, service.ErrSameWallet) {
+		return status.Error(codes.InvalidArgument, "cannot transfer to the same wallet")
+	} else if errors.Is(err, service.ErrCurrencyMismatch) {
+		return status.Error(codes.InvalidArgument, "wallets hold different currencies, a conversion is required")
+	} else if errors.Is(err, service.ErrAmountPrecision) {
+		return status.Error(codes.InvalidArgument, "amount has more decimal places than the wallet's currency allows")
+	} else if errors.Is(err, service.ErrQuoteMismatch) {
+		return status.Error(codes.InvalidArgument, "transfer does not match the quote")
+	} else if errors.Is(err, service.ErrQuoteExpired) {
+		return status.Error(codes.FailedPrecondition, "quote has expired, request a new one")
+	} else if errors.Is(err, service.ErrQuoteUsed) {
+		return status.Error(codes.FailedPrecondition, "quote has already been used")
+	}
+	return status.Error(codes.Internal, fallback)
+}
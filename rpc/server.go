@@ -0,0 +1,42 @@
+// Package rpc serves the gRPC API defined in proto/quick/v1. It calls the same
+// services as the HTTP handlers, so both APIs behave alike.
+package rpc
+
+import (
+	"context"
+
+	"github.com/mohammadrabetian/quick/domain"
+	quickv1 "github.com/mohammadrabetian/quick/proto/quick/v1"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+type WalletService interface {
+	GetBalance(ctx context.Context, walletID, userID uint64) (*domain.Wallet, error)
+	CreditWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error
+	DebitWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error
+	Transfer(ctx context.Context, fromWalletID, toWalletID uint64, amount decimal.Decimal, quoteID, userID uint64) error
+	ListTransactions(ctx context.Context, walletID uint64, filter repository.TransactionFilter, userID uint64) ([]domain.Transaction, int64, error)
+}
+
+type UserService interface {
+	Login(ctx context.Context, username, password, userAgent, ip string) (*service.AuthTokens, error)
+	AuthenticateToken(ctx context.Context, token string) (*domain.User, uint64, error)
+}
+
+// NewServer returns a gRPC server with the wallet and auth services
+// registered. Calls fail with Unavailable until started reports true. With
+// withReflection set clients such as grpcurl can list the services without the
+// proto files.
+func NewServer(walletService WalletService, userService UserService, started func() bool, withReflection bool) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(StartedInterceptor(started), AuthInterceptor(userService)))
+	quickv1.RegisterWalletServiceServer(server, &walletServer{walletSvc: walletService})
+	quickv1.RegisterAuthServiceServer(server, &authServer{userSvc: userService})
+	if withReflection {
+		reflection.Register(server)
+	}
+	return server
+}
@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/mohammadrabetian/quick/domain"
+	quickv1 "github.com/mohammadrabetian/quick/proto/quick/v1"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type walletServer struct {
+	quickv1.UnimplementedWalletServiceServer
+	walletSvc WalletService
+}
+
+func (s *walletServer) GetBalance(ctx context.Context, req *quickv1.GetBalanceRequest) (*quickv1.GetBalanceResponse, error) {
+	user := userFromContext(ctx)
+
+	wallet, err := s.walletSvc.GetBalance(ctx, req.WalletId, user.ID)
+	if err != nil {
+		logrus.Errorf("error in retrieving the wallet, err: %s", err)
+		return nil, toStatus(err, "unable to retrieve wallet balance")
+	}
+
+	return &quickv1.GetBalanceResponse{
+		WalletId:         wallet.ID,
+		Balance:          wallet.Balance.String(),
+		AvailableBalance: wallet.AvailableBalance().String(),
+		Currency:         wallet.Currency,
+	}, nil
+}
+
+func (s *walletServer) Credit(ctx context.Context, req *quickv1.CreditRequest) (*quickv1.CreditResponse, error) {
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	user := userFromContext(ctx)
+
+	if err := s.walletSvc.CreditWallet(ctx, req.WalletId, amount, user.ID); err != nil {
+		logrus.Errorf("error in crediting the wallet, err: %s", err)
+		return nil, toStatus(err, "error in crediting the wallet")
+	}
+	return &quickv1.CreditResponse{}, nil
+}
+
+func (s *walletServer) Debit(ctx context.Context, req *quickv1.DebitRequest) (*quickv1.DebitResponse, error) {
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	user := userFromContext(ctx)
+
+	if err := s.walletSvc.DebitWallet(ctx, req.WalletId, amount, user.ID); err != nil {
+		logrus.Errorf("error in debiting the wallet, err: %s", err)
+		return nil, toStatus(err, "error in debiting the wallet")
+	}
+	return &quickv1.DebitResponse{}, nil
+}
+
+func (s *walletServer) Transfer(ctx context.Context, req *quickv1.TransferRequest) (*quickv1.TransferResponse, error) {
+	if req.FromWalletId == 0 || req.ToWalletId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid wallet id")
+	}
+
+	amount, err := parseAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	user := userFromContext(ctx)
+
+	if err := s.walletSvc.Transfer(ctx, req.FromWalletId, req.ToWalletId, amount, req.QuoteId, user.ID); err != nil {
+		logrus.Errorf("error in transferring between wallets, err: %s", err)
+		return nil, toStatus(err, "error in transferring between wallets")
+	}
+	return &quickv1.TransferResponse{}, nil
+}
+
+func (s *walletServer) ListTransactions(ctx context.Context, req *quickv1.ListTransactionsRequest) (*quickv1.ListTransactionsResponse, error) {
+	filter, err := transactionFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	user := userFromContext(ctx)
+
+	transactions, total, err := s.walletSvc.ListTransactions(ctx, req.WalletId, filter, user.ID)
+	if err != nil {
+		logrus.Errorf("error in listing the transactions, err: %s", err)
+		return nil, toStatus(err, "unable to list transactions")
+	}
+
+	resp := &quickv1.ListTransactionsResponse{
+		Transactions: make([]*quickv1.Transaction, 0, len(transactions)),
+		Page:         int32(filter.Page),
+		PageSize:     int32(filter.PageSize),
+		Total:        total,
+	}
+	for i := range transactions {
+		resp.Transactions = append(resp.Transactions, newTransaction(&transactions[i]))
+	}
+	return resp, nil
+}
+
+func newTransaction(t *domain.Transaction) *quickv1.Transaction {
+	return &quickv1.Transaction{
+		Id:             t.ID,
+		WalletId:       t.WalletID,
+		Type:           string(t.Type),
+		Amount:         t.Amount.String(),
+		BalanceAfter:   t.BalanceAfter.String(),
+		ActorId:        t.ActorID,
+		Reference:      t.Reference,
+		QuoteId:        t.QuoteID,
+		ReversalOf:     t.ReversalOfID,
+		ReversedAmount: t.ReversedAmount.String(),
+		CreatedAt:      timestamppb.New(t.CreatedAt),
+	}
+}
+
+func parseAmount(value string) (decimal.Decimal, error) {
+	amount, err := decimal.NewFromString(value)
+	if err != nil || amount.Sign() <= 0 {
+		return decimal.Zero, status.Error(codes.InvalidArgument, "invalid or non-positive amount")
+	}
+	return amount, nil
+}
+
+func transactionFilter(req *quickv1.ListTransactionsRequest) (repository.TransactionFilter, error) {
+	filter := repository.TransactionFilter{Page: 1, PageSize: defaultPageSize}
+
+	if req.Page < 0 {
+		return filter, status.Error(codes.InvalidArgument, "invalid page")
+	}
+	if req.Page > 0 {
+		filter.Page = int(req.Page)
+	}
+
+	if req.PageSize < 0 || req.PageSize > maxPageSize {
+		return filter, status.Error(codes.InvalidArgument, "invalid page size")
+	}
+	if req.PageSize > 0 {
+		filter.PageSize = int(req.PageSize)
+	}
+
+	switch t := domain.TransactionType(req.Type); t {
+	case "", domain.TransactionTypeCredit, domain.TransactionTypeDebit:
+		filter.Type = t
+	default:
+		return filter, status.Error(codes.InvalidArgument, "invalid transaction type")
+	}
+
+	if req.From != nil {
+		filter.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		filter.To = req.To.AsTime()
+	}
+	return filter, nil
+}
@@ -0,0 +1,363 @@
+// Package seed loads fixtures, the users and wallets described in YAML or JSON
+// files, into the database. Loading is idempotent: users are matched by
+// username and wallets by owner and currency, so running it again only adds
+// what is missing.
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/pkg/password"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidFixture = errors.New("invalid fixture")
+
+// batchSize limits the rows inserted per statement for generated data
+const batchSize = 500
+
+type User struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// Wallet is the wallet of Owner in Currency, which defaults to the default
+// currency. Balance is only used when the wallet is created.
+type Wallet struct {
+	Owner    string `yaml:"owner" json:"owner"`
+	Currency string `yaml:"currency" json:"currency"`
+	Balance  string `yaml:"balance" json:"balance"`
+}
+
+// Generate creates Users users named <UsernamePrefix>_<n> for load tests, all
+// with Password, each with a wallet per currency holding a random balance
+// between MinBalance and MaxBalance.
+type Generate struct {
+	Users          int      `yaml:"users" json:"users"`
+	UsernamePrefix string   `yaml:"username_prefix" json:"username_prefix"`
+	Password       string   `yaml:"password" json:"password"`
+	Currencies     []string `yaml:"currencies" json:"currencies"`
+	MinBalance     string   `yaml:"min_balance" json:"min_balance"`
+	MaxBalance     string   `yaml:"max_balance" json:"max_balance"`
+}
+
+type Fixtures struct {
+	Users    []User    `yaml:"users" json:"users"`
+	Wallets  []Wallet  `yaml:"wallets" json:"wallets"`
+	Generate *Generate `yaml:"generate" json:"generate"`
+}
+
+// Result counts the rows a Seeder changed.
+type Result struct {
+	UsersCreated   int
+	UsersUpdated   int
+	WalletsCreated int
+}
+
+// Allowed reports whether fixtures may be loaded: only in the development and
+// testing environments, unless enabled explicitly.
+func Allowed(environment string, enabled bool) bool {
+	switch environment {
+	case "development", "testing", "test":
+		return true
+	default:
+		return enabled
+	}
+}
+
+// LoadFile reads a fixture file, JSON when its extension is .json and YAML
+// otherwise.
+func LoadFile(path string) (*Fixtures, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := &Fixtures{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(content, fixtures)
+	} else {
+		err = yaml.Unmarshal(content, fixtures)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %s", ErrInvalidFixture, path, err)
+	}
+	return fixtures, nil
+}
+
+type Seeder struct {
+	db              *gorm.DB
+	defaultCurrency string
+	rand            *rand.Rand
+}
+
+func NewSeeder(db *gorm.DB, defaultCurrency string) *Seeder {
+	return &Seeder{
+		db:              db,
+		defaultCurrency: defaultCurrency,
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Apply loads the fixtures in a single transaction. Users whose password
+// differs from the fixture get it updated, existing wallets keep their
+// balance, which only the ledger may change.
+func (s *Seeder) Apply(fixtures *Fixtures) (Result, error) {
+	result := Result{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		owners := map[string]uint64{}
+		for _, user := range fixtures.Users {
+			id, err := s.upsertUser(tx, user, &result)
+			if err != nil {
+				return err
+			}
+			owners[domain.NormalizeUsername(user.Username)] = id
+		}
+
+		for _, wallet := range fixtures.Wallets {
+			if err := s.upsertWallet(tx, wallet, owners, &result); err != nil {
+				return err
+			}
+		}
+
+		if fixtures.Generate != nil && fixtures.Generate.Users > 0 {
+			return s.generate(tx, fixtures.Generate, &result)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *Seeder) upsertUser(tx *gorm.DB, fixture User, result *Result) (uint64, error) {
+	username := domain.NormalizeUsername(fixture.Username)
+	if username == "" || fixture.Password == "" {
+		return 0, fmt.Errorf("%w: users need a username and a password", ErrInvalidFixture)
+	}
+
+	var user domain.User
+	err := tx.Where("username = ?", username).Limit(1).Find(&user).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if user.ID != 0 {
+		if match, _, _ := password.Verify(fixture.Password, user.Password); match {
+			return user.ID, nil
+		}
+	}
+
+	hashed, err := password.Hash(fixture.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	if user.ID != 0 {
+		result.UsersUpdated++
+		return user.ID, tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("password", hashed).Error
+	}
+
+	user = domain.User{Username: username, Password: hashed}
+	if err := tx.Create(&user).Error; err != nil {
+		return 0, err
+	}
+	result.UsersCreated++
+	return user.ID, nil
+}
+
+func (s *Seeder) upsertWallet(tx *gorm.DB, fixture Wallet, owners map[string]uint64, result *Result) error {
+	owner := domain.NormalizeUsername(fixture.Owner)
+	ownerID, ok := owners[owner]
+	if !ok {
+		var user domain.User
+		if err := tx.Where("username = ?", owner).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+		if user.ID == 0 {
+			return fmt.Errorf("%w: wallet owner %q is unknown", ErrInvalidFixture, fixture.Owner)
+		}
+		ownerID = user.ID
+	}
+
+	cur, err := s.currency(fixture.Currency)
+	if err != nil {
+		return err
+	}
+	balance, err := parseBalance(fixture.Balance, cur)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = tx.Model(&domain.Wallet{}).Where("owner_id = ? AND currency = ?", ownerID, cur.Code).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	if err := tx.Create(&domain.Wallet{OwnerID: ownerID, Currency: cur.Code, Balance: balance}).Error; err != nil {
+		return err
+	}
+	result.WalletsCreated++
+	return nil
+}
+
+// generate creates the missing load test users and wallets in batches. The
+// password is hashed once for all of them, existing ones are left as they are.
+func (s *Seeder) generate(tx *gorm.DB, g *Generate, result *Result) error {
+	prefix := strings.ToLower(strings.TrimSpace(g.UsernamePrefix))
+	if prefix == "" || g.Password == "" {
+		return fmt.Errorf("%w: generated users need a username_prefix and a password", ErrInvalidFixture)
+	}
+
+	currencies := g.Currencies
+	if len(currencies) == 0 {
+		currencies = []string{s.defaultCurrency}
+	}
+	var curs []currency.Currency
+	for _, code := range currencies {
+		cur, err := s.currency(code)
+		if err != nil {
+			return err
+		}
+		curs = append(curs, cur)
+	}
+
+	minBalance, err := parseBalance(g.MinBalance, currency.Currency{MinorUnits: 8})
+	if err != nil {
+		return err
+	}
+	maxBalance, err := parseBalance(g.MaxBalance, currency.Currency{MinorUnits: 8})
+	if err != nil {
+		return err
+	}
+	if maxBalance.LessThan(minBalance) {
+		return fmt.Errorf("%w: max_balance is below min_balance", ErrInvalidFixture)
+	}
+
+	usernames := make([]string, g.Users)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("%s_%d", prefix, i+1)
+	}
+
+	ids := make(map[string]uint64, len(usernames))
+	for start := 0; start < len(usernames); start += batchSize {
+		var existing []domain.User
+		err := tx.Select("id", "username").Where("username IN ?", usernames[start:min(start+batchSize, len(usernames))]).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		for _, user := range existing {
+			ids[user.Username] = user.ID
+		}
+	}
+
+	var missing []domain.User
+	for _, username := range usernames {
+		if _, ok := ids[username]; !ok {
+			missing = append(missing, domain.User{Username: username})
+		}
+	}
+	if len(missing) > 0 {
+		hashed, err := password.Hash(g.Password)
+		if err != nil {
+			return err
+		}
+		for i := range missing {
+			missing[i].Password = hashed
+		}
+		if err := tx.CreateInBatches(&missing, batchSize).Error; err != nil {
+			return err
+		}
+		for _, user := range missing {
+			ids[user.Username] = user.ID
+		}
+		result.UsersCreated += len(missing)
+	}
+
+	ownerIDs := make([]uint64, 0, len(usernames))
+	for _, username := range usernames {
+		ownerIDs = append(ownerIDs, ids[username])
+	}
+
+	var wallets []domain.Wallet
+	for start := 0; start < len(ownerIDs); start += batchSize {
+		end := min(start+batchSize, len(ownerIDs))
+		var held []domain.Wallet
+		err := tx.Select("owner_id", "currency").Where("owner_id IN ?", ownerIDs[start:end]).Find(&held).Error
+		if err != nil {
+			return err
+		}
+		has := map[string]bool{}
+		for _, w := range held {
+			has[fmt.Sprintf("%d:%s", w.OwnerID, w.Currency)] = true
+		}
+
+		for _, ownerID := range ownerIDs[start:end] {
+			for _, cur := range curs {
+				if has[fmt.Sprintf("%d:%s", ownerID, cur.Code)] {
+					continue
+				}
+				wallets = append(wallets, domain.Wallet{
+					OwnerID:  ownerID,
+					Currency: cur.Code,
+					Balance:  s.randomBalance(minBalance, maxBalance, cur),
+				})
+			}
+		}
+	}
+	if len(wallets) > 0 {
+		if err := tx.CreateInBatches(&wallets, batchSize).Error; err != nil {
+			return err
+		}
+		result.WalletsCreated += len(wallets)
+	}
+	return nil
+}
+
+func (s *Seeder) currency(code string) (currency.Currency, error) {
+	if strings.TrimSpace(code) == "" {
+		code = s.defaultCurrency
+	}
+	cur, err := currency.Lookup(code)
+	if err != nil {
+		return currency.Currency{}, fmt.Errorf("%w: currency %q: %s", ErrInvalidFixture, code, err)
+	}
+	return cur, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// randomBalance returns a balance between min and max in the currency's
+// minor units.
+func (s *Seeder) randomBalance(lower, upper decimal.Decimal, cur currency.Currency) decimal.Decimal {
+	spread := upper.Sub(lower)
+	return lower.Add(spread.Mul(decimal.NewFromFloat(s.rand.Float64()))).Truncate(cur.MinorUnits)
+}
+
+// parseBalance parses a non-negative balance that fits the currency, an
+// empty one is zero.
+func parseBalance(value string, cur currency.Currency) (decimal.Decimal, error) {
+	if strings.TrimSpace(value) == "" {
+		return decimal.Zero, nil
+	}
+	balance, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil || balance.IsNegative() || !cur.Fits(balance) {
+		return decimal.Zero, fmt.Errorf("%w: balance %q", ErrInvalidFixture, value)
+	}
+	return balance, nil
+}
@@ -0,0 +1,144 @@
+package seed_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/password"
+	"github.com/mohammadrabetian/quick/seed"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&domain.User{}, &domain.Wallet{}))
+	return db
+}
+
+func TestAllowed(t *testing.T) {
+	assert.True(t, seed.Allowed("development", false))
+	assert.True(t, seed.Allowed("testing", false))
+	assert.False(t, seed.Allowed("production", false))
+	assert.True(t, seed.Allowed("production", true))
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	db := newTestDB(t)
+	seeder := seed.NewSeeder(db, "EUR")
+
+	fixtures, err := seed.LoadFile("../fixtures/development.yaml")
+	require.NoError(t, err)
+
+	result, err := seeder.Apply(fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{UsersCreated: 3, WalletsCreated: 4}, result)
+
+	var user domain.User
+	require.NoError(t, db.Where("username = ?", "user1").First(&user).Error)
+	match, _, err := password.Verify("password1", user.Password)
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	var wallet domain.Wallet
+	require.NoError(t, db.Where("owner_id = ? AND currency = ?", user.ID, "EUR").First(&wallet).Error)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)), "balance is %s", wallet.Balance)
+
+	// Balances are only set on creation, later changes are kept
+	require.NoError(t, db.Model(&wallet).Update("balance", decimal.NewFromInt(42)).Error)
+	result, err = seeder.Apply(fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{}, result)
+	require.NoError(t, db.First(&wallet, wallet.ID).Error)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(42)), "balance is %s", wallet.Balance)
+
+	fixtures.Users[0].Password = "changed-password"
+	result, err = seeder.Apply(fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{UsersUpdated: 1}, result)
+
+	var count int64
+	require.NoError(t, db.Model(&domain.User{}).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestApplyRejectsInvalidFixtures(t *testing.T) {
+	db := newTestDB(t)
+	seeder := seed.NewSeeder(db, "EUR")
+
+	_, err := seeder.Apply(&seed.Fixtures{Wallets: []seed.Wallet{{Owner: "nobody"}}})
+	assert.ErrorIs(t, err, seed.ErrInvalidFixture)
+
+	_, err = seeder.Apply(&seed.Fixtures{
+		Users:   []seed.User{{Username: "user1", Password: "password1"}},
+		Wallets: []seed.Wallet{{Owner: "user1", Currency: "JPY", Balance: "10.5"}},
+	})
+	assert.ErrorIs(t, err, seed.ErrInvalidFixture)
+
+	// Nothing of a failed fixture is kept
+	var count int64
+	require.NoError(t, db.Model(&domain.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestGenerate(t *testing.T) {
+	db := newTestDB(t)
+	seeder := seed.NewSeeder(db, "EUR")
+
+	path := filepath.Join(t.TempDir(), "loadtest.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"generate": {
+		"users": 3, "username_prefix": "load", "password": "load-test-password",
+		"currencies": ["EUR", "JPY"], "min_balance": "10", "max_balance": "20"
+	}}`), 0o600))
+	fixtures, err := seed.LoadFile(path)
+	require.NoError(t, err)
+
+	result, err := seeder.Apply(fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{UsersCreated: 3, WalletsCreated: 6}, result)
+
+	var wallets []domain.Wallet
+	require.NoError(t, db.Find(&wallets).Error)
+	for _, wallet := range wallets {
+		assert.False(t, wallet.Balance.LessThan(decimal.NewFromInt(10)), "balance is %s", wallet.Balance)
+		assert.False(t, wallet.Balance.GreaterThan(decimal.NewFromInt(20)), "balance is %s", wallet.Balance)
+		if wallet.Currency == "JPY" {
+			assert.True(t, wallet.Balance.Equal(wallet.Balance.Truncate(0)), "balance is %s", wallet.Balance)
+		}
+	}
+
+	var user domain.User
+	require.NoError(t, db.Where("username = ?", "load_3").First(&user).Error)
+	match, _, err := password.Verify("load-test-password", user.Password)
+	require.NoError(t, err)
+	assert.True(t, match)
+
+	fixtures.Generate.Users = 5
+	result, err = seeder.Apply(fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{UsersCreated: 2, WalletsCreated: 4}, result)
+}
+
+func TestRepositoryFixturesLoad(t *testing.T) {
+	for _, path := range []string{"../fixtures/development.yaml", "../fixtures/loadtest.yaml"} {
+		_, err := seed.LoadFile(path)
+		assert.NoError(t, err, path)
+	}
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrActorRequired = errors.New("the operator making the change must be named")
+var ErrReasonRequired = errors.New("a reason is required")
+var ErrInvalidAdjustment = errors.New("adjustment amount must not be zero")
+
+// maxReasonLength is the size of the audit log's reason column
+const maxReasonLength = 255
+
+// WalletDetails is what operators see of a wallet.
+type WalletDetails struct {
+	Wallet        *domain.Wallet
+	LedgerBalance decimal.Decimal
+	Transactions  []domain.Transaction
+	AuditEntries  []domain.AuditEntry
+}
+
+// AdminService makes the changes operators need outside of the API. Every
+// change is written to the audit log in the same database transaction, with
+// the operator and their reason.
+type AdminService struct {
+	users           *UserService
+	userRepo        repository.UserRepository
+	walletRepo      repository.WalletRepository
+	transactionRepo repository.TransactionRepository
+	auditRepo       repository.AuditRepository
+	outboxRepo      repository.OutboxRepository
+	ledger          *ledger.Ledger
+	timeouts        Timeouts
+}
+
+func NewAdminService(
+	users *UserService,
+	userRepo repository.UserRepository,
+	walletRepo repository.WalletRepository,
+	transactionRepo repository.TransactionRepository,
+	auditRepo repository.AuditRepository,
+	outboxRepo repository.OutboxRepository,
+	books *ledger.Ledger,
+	timeouts Timeouts,
+) *AdminService {
+	return &AdminService{
+		users:           users,
+		userRepo:        userRepo,
+		walletRepo:      walletRepo,
+		transactionRepo: transactionRepo,
+		auditRepo:       auditRepo,
+		outboxRepo:      outboxRepo,
+		ledger:          books,
+		timeouts:        timeouts,
+	}
+}
+
+func (s *AdminService) ListUsers(ctx context.Context) ([]domain.User, error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+
+	return s.userRepo.ListUsers(ctx)
+}
+
+// CreateUser registers a user with the same rules as the API.
+func (s *AdminService) CreateUser(ctx context.Context, actor, username, plaintext string) (*domain.User, error) {
+	if err := checkActor(actor); err != nil {
+		return nil, err
+	}
+
+	return s.users.register(ctx, username, plaintext, func(tx *gorm.DB, user *domain.User) error {
+		return s.audit(tx, actor, domain.AuditUserCreated, domain.AuditTargetUser, user.ID, "created with the cli", nil)
+	})
+}
+
+// DisableUser stops the user from signing in and revokes their sessions. In
+// jwt mode access tokens that were already issued stay valid until they
+// expire.
+func (s *AdminService) DisableUser(ctx context.Context, actor string, userID uint64, reason string) (*domain.User, error) {
+	now := time.Now()
+	user, err := s.setUserDisabled(ctx, actor, userID, reason, &now)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.users.RevokeAllSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AdminService) EnableUser(ctx context.Context, actor string, userID uint64, reason string) (*domain.User, error) {
+	return s.setUserDisabled(ctx, actor, userID, reason, nil)
+}
+
+func (s *AdminService) setUserDisabled(ctx context.Context, actor string, userID uint64, reason string, disabledAt *time.Time) (*domain.User, error) {
+	if err := checkChange(actor, reason); err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	action := domain.AuditUserEnabled
+	if disabledAt != nil {
+		action = domain.AuditUserDisabled
+	}
+
+	tx := s.userRepo.GetDB().WithContext(ctx).Begin()
+	if err := s.userRepo.SetDisabled(tx, userID, disabledAt); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.audit(tx, actor, action, domain.AuditTargetUser, userID, reason, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	user.DisabledAt = disabledAt
+	return user, nil
+}
+
+// GetWallet returns the wallet with its balance according to the ledger, its
+// latest transactions and the latest changes operators made to it.
+func (s *AdminService) GetWallet(ctx context.Context, walletID uint64, limit int) (*WalletDetails, error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+
+	db := s.walletRepo.GetDB().WithContext(ctx)
+	wallet := &domain.Wallet{}
+	if err := db.First(wallet, walletID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrWalletNotFound
+		}
+		return nil, err
+	}
+
+	ledgerBalance, err := s.ledger.WalletBalance(db, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, _, err := s.transactionRepo.ListTransactions(ctx, walletID, repository.TransactionFilter{Page: 1, PageSize: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.auditRepo.ListEntries(ctx, domain.AuditTargetWallet, walletID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WalletDetails{Wallet: wallet, LedgerBalance: ledgerBalance, Transactions: transactions, AuditEntries: entries}, nil
+}
+
+// AdjustBalance corrects the wallet's balance by amount, which is negative to
+// take money out. It is booked against the adjustment account of the wallet's
+// currency like any other movement, so the books stay balanced, and works on
+// frozen wallets too. The balance still cannot go below what is held.
+func (s *AdminService) AdjustBalance(ctx context.Context, actor string, walletID uint64, amount decimal.Decimal, reason string) (*domain.Transaction, error) {
+	if err := checkChange(actor, reason); err != nil {
+		return nil, err
+	}
+	if amount.IsZero() {
+		return nil, ErrInvalidAdjustment
+	}
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	wallet, err := s.walletRepo.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPrecision(wallet, amount.Abs()); err != nil {
+		return nil, err
+	}
+
+	reference, err := newReference("adjustment")
+	if err != nil {
+		return nil, err
+	}
+
+	adjustments := ledger.SystemAccount(ledger.KindAdjustment, wallet.Currency)
+	entry := ledger.NewEntry(reference, "adjustment: "+reason).AllowFrozen()
+	transactionType := domain.TransactionTypeCredit
+	if amount.IsPositive() {
+		entry.Debit(adjustments, amount).Credit(ledger.WalletAccount(walletID), amount)
+	} else {
+		transactionType = domain.TransactionTypeDebit
+		entry.Debit(ledger.WalletAccount(walletID), amount.Abs()).Credit(adjustments, amount.Abs())
+	}
+
+	tx := s.walletRepo.GetDB().WithContext(ctx).Begin()
+	wallets, err := s.ledger.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	transaction := &domain.Transaction{
+		WalletID:     walletID,
+		Type:         transactionType,
+		Origin:       domain.TransactionOriginAdjustment,
+		Amount:       amount.Abs(),
+		BalanceAfter: wallets[walletID].Balance,
+		Reference:    reference,
+	}
+	if err := s.transactionRepo.CreateTransaction(tx, transaction); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordWalletEvent(s.outboxRepo, tx, transaction, wallet.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = s.audit(tx, actor, domain.AuditWalletAdjusted, domain.AuditTargetWallet, walletID, reason, map[string]interface{}{
+		"amount":         amount,
+		"currency":       wallet.Currency,
+		"transaction_id": transaction.ID,
+		"reference":      reference,
+		"balance_after":  transaction.BalanceAfter,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.walletRepo.InvalidateCache(ctx, walletID)
+	return transaction, nil
+}
+
+// FreezeWallet stops all money movements of the wallet, while its owner can
+// still see it.
+func (s *AdminService) FreezeWallet(ctx context.Context, actor string, walletID uint64, reason string) (*domain.Wallet, error) {
+	now := time.Now()
+	return s.setWalletFrozen(ctx, actor, walletID, reason, &now)
+}
+
+func (s *AdminService) UnfreezeWallet(ctx context.Context, actor string, walletID uint64, reason string) (*domain.Wallet, error) {
+	return s.setWalletFrozen(ctx, actor, walletID, reason, nil)
+}
+
+func (s *AdminService) setWalletFrozen(ctx context.Context, actor string, walletID uint64, reason string, frozenAt *time.Time) (*domain.Wallet, error) {
+	if err := checkChange(actor, reason); err != nil {
+		return nil, err
+	}
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	action := domain.AuditWalletUnfrozen
+	if frozenAt != nil {
+		action = domain.AuditWalletFrozen
+	}
+
+	tx := s.walletRepo.GetDB().WithContext(ctx).Begin()
+	wallet, err := s.walletRepo.GetWalletForUpdate(tx, walletID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.walletRepo.SetFrozen(tx, walletID, frozenAt); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.audit(tx, actor, action, domain.AuditTargetWallet, walletID, reason, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.walletRepo.InvalidateCache(ctx, walletID)
+
+	wallet.FrozenAt = frozenAt
+	return wallet, nil
+}
+
+// VerifyLedger checks that every journal entry is balanced and returns the
+// wallets whose stored balance differs from their postings. It goes through
+// the whole ledger, so only the deadline of ctx applies, not the timeouts.
+func (s *AdminService) VerifyLedger(ctx context.Context) ([]ledger.Mismatch, error) {
+	db := s.walletRepo.GetDB().WithContext(ctx)
+	if err := ledger.CheckInvariant(db); err != nil {
+		return nil, err
+	}
+	return s.ledger.VerifyWalletBalances(db)
+}
+
+// RebuildBalances overwrites the stored balances that differ from the ledger
+// and returns the IDs of the corrected wallets. Like VerifyLedger, only the
+// deadline of ctx applies.
+func (s *AdminService) RebuildBalances(ctx context.Context, actor, reason string) ([]uint64, error) {
+	if err := checkChange(actor, reason); err != nil {
+		return nil, err
+	}
+
+	db := s.walletRepo.GetDB().WithContext(ctx)
+	corrected, err := s.ledger.RebuildWalletBalances(db)
+	if len(corrected) > 0 {
+		// Audited afterwards, each wallet is rebuilt in a transaction of its own
+		tx := db.Begin()
+		auditErr := s.audit(tx, actor, domain.AuditBalancesRebuilt, domain.AuditTargetLedger, 0, reason, map[string]interface{}{
+			"wallet_ids": corrected,
+		})
+		if auditErr == nil {
+			auditErr = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+		if auditErr != nil {
+			logrus.Errorf("error in auditing the rebuild of wallets %v, err: %s", corrected, auditErr)
+		}
+	}
+	return corrected, err
+}
+
+func (s *AdminService) audit(tx *gorm.DB, actor, action, targetType string, targetID uint64, reason string, details map[string]interface{}) error {
+	entry := &domain.AuditEntry{
+		Actor:      strings.TrimSpace(actor),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     strings.TrimSpace(reason),
+	}
+	if details != nil {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = string(encoded)
+	}
+	return s.auditRepo.CreateEntry(tx, entry)
+}
+
+func checkActor(actor string) error {
+	if strings.TrimSpace(actor) == "" {
+		return ErrActorRequired
+	}
+	return nil
+}
+
+func checkChange(actor, reason string) error {
+	if err := checkActor(actor); err != nil {
+		return err
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxReasonLength {
+		return ErrReasonRequired
+	}
+	return nil
+}
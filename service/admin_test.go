@@ -0,0 +1,264 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type adminTestServices struct {
+	admin  *service.AdminService
+	wallet *service.WalletService
+	hold   *service.HoldService
+	user   *service.UserService
+}
+
+func newTestAdminServices(t *testing.T, db *gorm.DB) adminTestServices {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	userRepo := repository.NewUserMySQLRepository(db)
+	walletRepo := repository.NewWalletMySQLRepository(db, cache)
+	transactionRepo := repository.NewTransactionMySQLRepository(db)
+	outboxRepo := repository.NewOutboxMySQLRepository(db, cache)
+	books := ledger.New(walletRepo)
+
+	userSvc := service.NewUserService(userRepo, repository.NewSessionMySQLRepository(db), repository.NewRefreshTokenMySQLRepository(db), outboxRepo, time.Hour, nil, service.Timeouts{})
+	return adminTestServices{
+		admin:  service.NewAdminService(userSvc, userRepo, walletRepo, transactionRepo, repository.NewAuditMySQLRepository(db), outboxRepo, books, service.Timeouts{}),
+		wallet: service.NewWalletService(walletRepo, transactionRepo, repository.NewFXMySQLRepository(db, cache), outboxRepo, books, "EUR", service.Timeouts{}),
+		hold:   service.NewHoldService(repository.NewHoldMySQLRepository(db), walletRepo, transactionRepo, outboxRepo, books, time.Hour, service.Timeouts{}),
+		user:   userSvc,
+	}
+}
+
+func auditEntries(t *testing.T, db *gorm.DB, targetType string, targetID uint64) []domain.AuditEntry {
+	t.Helper()
+
+	var entries []domain.AuditEntry
+	require.NoError(t, db.Where("target_type = ? AND target_id = ?", targetType, targetID).Order("id").Find(&entries).Error)
+	return entries
+}
+
+func TestAdjustBalance(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, svcs.wallet.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+
+	_, err := svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.NewFromInt(10), " ")
+	assert.ErrorIs(t, err, service.ErrReasonRequired)
+	_, err = svcs.admin.AdjustBalance(context.Background(), "", 1, decimal.NewFromInt(10), "goodwill")
+	assert.ErrorIs(t, err, service.ErrActorRequired)
+	_, err = svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.Zero, "goodwill")
+	assert.ErrorIs(t, err, service.ErrInvalidAdjustment)
+	_, err = svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.RequireFromString("0.001"), "goodwill")
+	assert.ErrorIs(t, err, service.ErrAmountPrecision)
+	_, err = svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.NewFromInt(-101), "duplicate credit")
+	assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+	assert.Empty(t, auditEntries(t, db, domain.AuditTargetWallet, 1))
+
+	credit, err := svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.RequireFromString("12.50"), "goodwill for ticket 981")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionTypeCredit, credit.Type)
+	assert.True(t, strings.HasPrefix(credit.Reference, "adjustment_"), "reference is %s", credit.Reference)
+	assert.True(t, credit.BalanceAfter.Equal(decimal.RequireFromString("112.5")), "balance after is %s", credit.BalanceAfter)
+
+	debit, err := svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.NewFromInt(-30), "duplicate credit")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionTypeDebit, debit.Type)
+	assert.True(t, debit.Amount.Equal(decimal.NewFromInt(30)), "amount is %s", debit.Amount)
+	assert.True(t, debit.BalanceAfter.Equal(decimal.RequireFromString("82.5")), "balance after is %s", debit.BalanceAfter)
+
+	wallet, err := svcs.wallet.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.RequireFromString("82.5")), "balance is %s", wallet.Balance)
+
+	entries := auditEntries(t, db, domain.AuditTargetWallet, 1)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, domain.AuditWalletAdjusted, entries[0].Action)
+	assert.Equal(t, "goodwill for ticket 981", entries[0].Reason)
+	assert.Contains(t, entries[0].Details, fmt.Sprintf(`"transaction_id":%d`, credit.ID))
+
+	// Corrected by another adjustment, not reversed
+	_, err = svcs.wallet.ReverseTransaction(context.Background(), debit.ID, decimal.Zero, 1, true)
+	assert.ErrorIs(t, err, service.ErrNotReversible)
+
+	mismatches, err := svcs.admin.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestFreezeWallet(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, svcs.wallet.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+	hold, err := svcs.hold.PlaceHold(context.Background(), 1, decimal.NewFromInt(10), 1)
+	require.NoError(t, err)
+
+	_, err = svcs.admin.FreezeWallet(context.Background(), "alice", 1, "")
+	assert.ErrorIs(t, err, service.ErrReasonRequired)
+	wallet, err := svcs.admin.FreezeWallet(context.Background(), "alice", 1, "suspected fraud")
+	require.NoError(t, err)
+	assert.True(t, wallet.Frozen())
+
+	assert.ErrorIs(t, svcs.wallet.CreditWallet(context.Background(), 1, decimal.NewFromInt(1), 1), repository.ErrWalletFrozen)
+	assert.ErrorIs(t, svcs.wallet.DebitWallet(context.Background(), 1, decimal.NewFromInt(1), 1), repository.ErrWalletFrozen)
+	assert.ErrorIs(t, svcs.wallet.Transfer(context.Background(), 1, 2, decimal.NewFromInt(1), 0, 1), repository.ErrWalletFrozen)
+	assert.ErrorIs(t, svcs.wallet.Transfer(context.Background(), 2, 1, decimal.NewFromInt(1), 0, 1), repository.ErrWalletFrozen)
+	_, err = svcs.hold.PlaceHold(context.Background(), 1, decimal.NewFromInt(1), 1)
+	assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+	_, err = svcs.hold.CaptureHold(context.Background(), 1, hold.ID, decimal.Zero, 1)
+	assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+	// Money already held can still be given back
+	_, err = svcs.hold.ReleaseHold(context.Background(), 1, hold.ID, 1)
+	assert.NoError(t, err)
+
+	// Operators can still correct the balance
+	_, err = svcs.admin.AdjustBalance(context.Background(), "alice", 1, decimal.NewFromInt(-5), "chargeback")
+	require.NoError(t, err)
+
+	wallet, err = svcs.admin.UnfreezeWallet(context.Background(), "bob", 1, "cleared by compliance")
+	require.NoError(t, err)
+	assert.False(t, wallet.Frozen())
+	assert.NoError(t, svcs.wallet.CreditWallet(context.Background(), 1, decimal.NewFromInt(1), 1))
+
+	details, err := svcs.admin.GetWallet(context.Background(), 1, 10)
+	require.NoError(t, err)
+	assert.False(t, details.Wallet.Frozen())
+	assert.True(t, details.LedgerBalance.Equal(decimal.NewFromInt(96)), "ledger balance is %s", details.LedgerBalance)
+	assert.Len(t, details.Transactions, 3)
+
+	var actions []string
+	for _, entry := range details.AuditEntries {
+		actions = append(actions, entry.Action)
+	}
+	assert.ElementsMatch(t, []string{domain.AuditWalletFrozen, domain.AuditWalletAdjusted, domain.AuditWalletUnfrozen}, actions)
+
+	_, err = svcs.admin.GetWallet(context.Background(), 999, 10)
+	assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+}
+
+func TestGetWalletNotPostedTo(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+	createTestUsers(t, db, 1)
+	// A seeded wallet gets its ledger account on its first movement
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	details, err := svcs.admin.GetWallet(context.Background(), 1, 10)
+	require.NoError(t, err)
+	assert.True(t, details.LedgerBalance.Equal(details.Wallet.Balance), "ledger balance is %s", details.LedgerBalance)
+
+	mismatches, err := svcs.admin.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestDisableUser(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+
+	user, err := svcs.admin.CreateUser(context.Background(), "alice", "Carol", "correct horse battery staple")
+	require.NoError(t, err)
+	assert.Equal(t, "carol", user.Username)
+
+	tokens, err := svcs.user.StartSession(context.Background(), user, "agent", "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = svcs.admin.DisableUser(context.Background(), "alice", 999, "left the company")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	disabled, err := svcs.admin.DisableUser(context.Background(), "alice", user.ID, "left the company")
+	require.NoError(t, err)
+	assert.True(t, disabled.Disabled())
+
+	authenticated, _, err := svcs.user.AuthenticateToken(context.Background(), tokens.Token)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+	_, err = svcs.user.StartSession(context.Background(), disabled, "agent", "127.0.0.1")
+	assert.ErrorIs(t, err, service.ErrUserDisabled)
+
+	enabled, err := svcs.admin.EnableUser(context.Background(), "alice", user.ID, "rehired")
+	require.NoError(t, err)
+	assert.False(t, enabled.Disabled())
+	_, err = svcs.user.StartSession(context.Background(), enabled, "agent", "127.0.0.1")
+	assert.NoError(t, err)
+
+	users, err := svcs.admin.ListUsers(context.Background())
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.False(t, users[0].Disabled())
+
+	var actions []string
+	for _, entry := range auditEntries(t, db, domain.AuditTargetUser, user.ID) {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{domain.AuditUserCreated, domain.AuditUserDisabled, domain.AuditUserEnabled}, actions)
+}
+
+func TestCreateUserIsNotKeptWithoutItsAuditEntry(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+	require.NoError(t, db.Migrator().DropTable(&domain.AuditEntry{}))
+
+	_, err := svcs.admin.CreateUser(context.Background(), "alice", "carol", "correct horse battery staple")
+	assert.Error(t, err)
+
+	users, err := svcs.admin.ListUsers(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestVerifyAndRebuildLedger(t *testing.T) {
+	db := newTestDB(t)
+	svcs := newTestAdminServices(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, svcs.wallet.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+
+	// The stored balance drifts from the books, e.g. by a manual update
+	require.NoError(t, db.Model(&domain.Wallet{}).Where("id = ?", 1).Update("balance", decimal.NewFromInt(7)).Error)
+
+	mismatches, err := svcs.admin.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, uint64(1), mismatches[0].WalletID)
+	assert.True(t, mismatches[0].LedgerBalance.Equal(decimal.NewFromInt(100)), "ledger balance is %s", mismatches[0].LedgerBalance)
+
+	_, err = svcs.admin.RebuildBalances(context.Background(), "alice", "")
+	assert.ErrorIs(t, err, service.ErrReasonRequired)
+
+	corrected, err := svcs.admin.RebuildBalances(context.Background(), "alice", "drift after manual update")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, corrected)
+
+	mismatches, err = svcs.admin.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	entries := auditEntries(t, db, domain.AuditTargetLedger, 0)
+	require.Len(t, entries, 1)
+	assert.Equal(t, domain.AuditBalancesRebuilt, entries[0].Action)
+	assert.Contains(t, entries[0].Details, `"wallet_ids":[1]`)
+}
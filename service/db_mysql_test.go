@@ -0,0 +1,52 @@
+//go:build mysql
+
+package service_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mysqlDSNEnv names the server the tests of concurrent operations run
+// against, e.g. root:password@tcp(127.0.0.1:3306)/
+const mysqlDSNEnv = "QUICK_TEST_MYSQL_DSN"
+
+// newConcurrencyTestDB creates a throwaway MySQL database with the
+// application schema, so that concurrent operations take row locks on
+// separate connections like in production.
+func newConcurrencyTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv(mysqlDSNEnv)
+	if dsn == "" {
+		t.Fatalf("%s must be set when testing with -tags mysql", mysqlDSNEnv)
+	}
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	server, err := gorm.Open(mysql.Open(dsn), config)
+	require.NoError(t, err)
+	serverDB, err := server.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { serverDB.Close() })
+
+	name := fmt.Sprintf("quick_test_%d", time.Now().UnixNano())
+	require.NoError(t, server.Exec("CREATE DATABASE `"+name+"`").Error)
+	t.Cleanup(func() { server.Exec("DROP DATABASE `" + name + "`") })
+
+	db, err := gorm.Open(mysql.Open(dsn+name+"?charset=utf8mb4&parseTime=True&loc=Local"), config)
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(20)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrateTestDB(t, db)
+	return db
+}
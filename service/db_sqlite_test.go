@@ -0,0 +1,17 @@
+//go:build !mysql
+
+package service_test
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// newConcurrencyTestDB is the database of the tests of concurrent operations.
+// On SQLite they only check that operations run one after the other add up:
+// the row locks of "SELECT ... FOR UPDATE" and the order they are taken in
+// are not exercised. Run them against MySQL with -tags mysql for that.
+func newConcurrencyTestDB(t *testing.T) *gorm.DB {
+	return newTestDB(t)
+}
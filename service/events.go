@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// WalletEvent is the payload of wallet.credited and wallet.debited, which are
+// emitted for every balance change.
+type WalletEvent struct {
+	WalletID      uint64          `json:"wallet_id"`
+	TransactionID uint64          `json:"transaction_id"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	BalanceAfter  decimal.Decimal `json:"balance_after"`
+	ActorID       uint64          `json:"actor_id"`
+	Reference     string          `json:"reference"`
+	ReversalOf    *uint64         `json:"reversal_of,omitempty"`
+}
+
+// TransferEvent is the payload of transfer.completed. Both legs are emitted as
+// wallet events as well.
+type TransferEvent struct {
+	FromWalletID   uint64          `json:"from_wallet_id"`
+	ToWalletID     uint64          `json:"to_wallet_id"`
+	Amount         decimal.Decimal `json:"amount"`
+	FromCurrency   string          `json:"from_currency"`
+	CreditedAmount decimal.Decimal `json:"credited_amount"`
+	ToCurrency     string          `json:"to_currency"`
+	QuoteID        *uint64         `json:"quote_id,omitempty"`
+	ActorID        uint64          `json:"actor_id"`
+	Reference      string          `json:"reference"`
+}
+
+// UserLoggedInEvent is the payload of user.logged_in.
+type UserLoggedInEvent struct {
+	UserID    uint64 `json:"user_id"`
+	SessionID uint64 `json:"session_id"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// recordEvent writes the event to the outbox inside tx, so that it is only
+// published if tx commits.
+func recordEvent(repo repository.OutboxRepository, tx *gorm.DB, eventType, partitionKey string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return repo.CreateEvent(tx, &domain.OutboxEvent{
+		Type:         eventType,
+		PartitionKey: partitionKey,
+		Payload:      string(data),
+	})
+}
+
+// recordWalletEvent emits the balance change recorded by t.
+func recordWalletEvent(repo repository.OutboxRepository, tx *gorm.DB, t *domain.Transaction, currency string) error {
+	eventType := domain.EventWalletCredited
+	if t.Type == domain.TransactionTypeDebit {
+		eventType = domain.EventWalletDebited
+	}
+
+	return recordEvent(repo, tx, eventType, walletPartitionKey(t.WalletID), WalletEvent{
+		WalletID:      t.WalletID,
+		TransactionID: t.ID,
+		Amount:        t.Amount,
+		Currency:      currency,
+		BalanceAfter:  t.BalanceAfter,
+		ActorID:       t.ActorID,
+		Reference:     t.Reference,
+		ReversalOf:    t.ReversalOfID,
+	})
+}
+
+func walletPartitionKey(walletID uint64) string {
+	return fmt.Sprintf("wallet:%d", walletID)
+}
+
+func userPartitionKey(userID uint64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
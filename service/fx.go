@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultRateTTL  = 5 * time.Minute
+	defaultQuoteTTL = 30 * time.Second
+
+	// Rates are stored with this many decimal places
+	ratePrecision = 12
+)
+
+var ErrSameCurrency = errors.New("cannot convert a currency into itself")
+var ErrAmountTooSmall = errors.New("amount is too small to be converted")
+var ErrQuoteExpired = errors.New("quote has expired")
+var ErrQuoteUsed = errors.New("quote has already been used")
+var ErrQuoteMismatch = errors.New("transfer does not match the quote")
+
+// RateProvider returns how many units of to one unit of from is worth.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (decimal.Decimal, error)
+}
+
+type FXService struct {
+	repo     repository.FXRepository
+	provider RateProvider
+	spread   decimal.Decimal
+	rateTTL  time.Duration
+	quoteTTL time.Duration
+	timeouts Timeouts
+}
+
+// NewFXService returns an FXService which caches the provider's rates for
+// rateTTL and hands out quotes valid for quoteTTL. The spread is the fraction
+// of the rate kept on every conversion, e.g. 0.005.
+func NewFXService(repo repository.FXRepository, provider RateProvider, spread decimal.Decimal, rateTTL, quoteTTL time.Duration, timeouts Timeouts) *FXService {
+	if rateTTL <= 0 {
+		rateTTL = defaultRateTTL
+	}
+	if quoteTTL <= 0 {
+		quoteTTL = defaultQuoteTTL
+	}
+	return &FXService{repo: repo, provider: provider, spread: spread, rateTTL: rateTTL, quoteTTL: quoteTTL, timeouts: timeouts}
+}
+
+// CreateQuote prices the conversion of amount from one currency into another.
+// The converted amount is rounded down to the minor units of the target
+// currency. Transfers between wallets of the two currencies must reference
+// the returned quote before it expires.
+func (s *FXService) CreateQuote(ctx context.Context, userID uint64, fromCode, toCode string, amount decimal.Decimal) (*domain.FXQuote, error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	from, err := currency.Lookup(fromCode)
+	if err != nil {
+		return nil, err
+	}
+	to, err := currency.Lookup(toCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if from.Code == to.Code {
+		return nil, ErrSameCurrency
+	}
+	if !from.Fits(amount) {
+		return nil, ErrAmountPrecision
+	}
+
+	rate, err := s.rate(ctx, from.Code, to.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedRate := rate.Mul(decimal.NewFromInt(1).Sub(s.spread)).Truncate(ratePrecision)
+	converted := amount.Mul(appliedRate).Truncate(to.MinorUnits)
+	if converted.Sign() <= 0 {
+		return nil, ErrAmountTooSmall
+	}
+
+	quote := &domain.FXQuote{
+		UserID:          userID,
+		FromCurrency:    from.Code,
+		ToCurrency:      to.Code,
+		Amount:          amount,
+		ConvertedAmount: converted,
+		Rate:            rate,
+		Spread:          s.spread,
+		AppliedRate:     appliedRate,
+		ExpiresAt:       time.Now().Add(s.quoteTTL),
+	}
+	if err := s.repo.CreateQuote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// rate returns the provider's rate, cached for rateTTL.
+func (s *FXService) rate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	if rate, ok := s.repo.GetCachedRate(ctx, from, to); ok {
+		return rate, nil
+	}
+
+	rate, err := s.provider.Rate(ctx, from, to)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	rate = rate.Truncate(ratePrecision)
+
+	s.repo.CacheRate(ctx, from, to, rate, s.rateTTL)
+	return rate, nil
+}
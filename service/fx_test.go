@@ -0,0 +1,147 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/pkg/fxrate"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// countingProvider serves fixed rates and counts how often it is asked.
+type countingProvider struct {
+	rates map[string]decimal.Decimal
+	calls int
+}
+
+func (p *countingProvider) Rate(_ context.Context, from, to string) (decimal.Decimal, error) {
+	p.calls++
+	rate, ok := p.rates[from+"/"+to]
+	if !ok {
+		return decimal.Zero, fxrate.ErrRateUnavailable
+	}
+	return rate, nil
+}
+
+func newTestFXService(t *testing.T, db *gorm.DB, provider service.RateProvider, quoteTTL time.Duration) *service.FXService {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	fxRepo := repository.NewFXMySQLRepository(db, cache)
+	return service.NewFXService(fxRepo, provider, decimal.RequireFromString("0.01"), time.Minute, quoteTTL, service.Timeouts{})
+}
+
+func TestCreateQuote(t *testing.T) {
+	db := newTestDB(t)
+	provider := &countingProvider{rates: map[string]decimal.Decimal{
+		"EUR/JPY": decimal.RequireFromString("160"),
+		"JPY/EUR": decimal.RequireFromString("0.006"),
+	}}
+	fxSvc := newTestFXService(t, db, provider, time.Minute)
+
+	quote, err := fxSvc.CreateQuote(context.Background(), 1, "eur", "JPY", decimal.RequireFromString("10.05"))
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", quote.FromCurrency)
+	assert.Equal(t, "JPY", quote.ToCurrency)
+	assert.True(t, quote.AppliedRate.Equal(decimal.RequireFromString("158.4")), "applied rate is %s", quote.AppliedRate)
+	// 10.05 * 158.4 = 1591.92, rounded down to whole yen
+	assert.True(t, quote.ConvertedAmount.Equal(decimal.NewFromInt(1591)), "converted amount is %s", quote.ConvertedAmount)
+	assert.True(t, quote.ExpiresAt.After(time.Now()))
+
+	_, err = fxSvc.CreateQuote(context.Background(), 1, "EUR", "JPY", decimal.NewFromInt(5))
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.calls, "the rate must be served from the cache")
+
+	_, err = fxSvc.CreateQuote(context.Background(), 1, "EUR", "EUR", decimal.NewFromInt(5))
+	assert.ErrorIs(t, err, service.ErrSameCurrency)
+
+	_, err = fxSvc.CreateQuote(context.Background(), 1, "EUR", "JPY", decimal.RequireFromString("0.001"))
+	assert.ErrorIs(t, err, service.ErrAmountPrecision)
+
+	// One yen is worth less than a cent
+	_, err = fxSvc.CreateQuote(context.Background(), 1, "JPY", "EUR", decimal.NewFromInt(1))
+	assert.ErrorIs(t, err, service.ErrAmountTooSmall)
+
+	_, err = fxSvc.CreateQuote(context.Background(), 1, "EUR", "USD", decimal.NewFromInt(5))
+	assert.ErrorIs(t, err, fxrate.ErrRateUnavailable)
+}
+
+func TestTransferWithQuote(t *testing.T) {
+	db := newTestDB(t)
+	provider := &countingProvider{rates: map[string]decimal.Decimal{
+		"EUR/JPY": decimal.RequireFromString("160"),
+	}}
+	fxSvc := newTestFXService(t, db, provider, time.Minute)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "JPY", OwnerID: 2}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 3, Balance: decimal.Zero, Currency: "EUR", OwnerID: 2}).Error)
+
+	quote, err := fxSvc.CreateQuote(context.Background(), 1, "EUR", "JPY", decimal.NewFromInt(10))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(10), 0, 1), service.ErrCurrencyMismatch)
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(20), quote.ID, 1), service.ErrQuoteMismatch)
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 3, decimal.NewFromInt(10), quote.ID, 1), service.ErrQuoteMismatch)
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(10), quote.ID+100, 1), repository.ErrQuoteNotFound)
+
+	require.NoError(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(10), quote.ID, 1))
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(10), quote.ID, 1), service.ErrQuoteUsed)
+
+	from, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, from.Balance.Equal(decimal.NewFromInt(90)), "balance is %s", from.Balance)
+
+	to, err := svc.GetBalance(context.Background(), 2, 2)
+	require.NoError(t, err)
+	assert.True(t, to.Balance.Equal(decimal.NewFromInt(1584)), "balance is %s", to.Balance)
+
+	var legs []domain.Transaction
+	require.NoError(t, db.Where("quote_id = ?", quote.ID).Find(&legs).Error)
+	assert.Len(t, legs, 2)
+
+	// 10 EUR were worth 1600 JPY at the provider's rate, the user got 1584
+	var fees ledger.Account
+	require.NoError(t, db.Where("code = ?", "fees:JPY").First(&fees).Error)
+	var posting ledger.Posting
+	require.NoError(t, db.Where("account_id = ?", fees.ID).First(&posting).Error)
+	assert.Equal(t, ledger.Credit, posting.Side)
+	assert.True(t, posting.Amount.Equal(decimal.NewFromInt(16)), "fee is %s", posting.Amount)
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestTransferWithExpiredQuote(t *testing.T) {
+	db := newTestDB(t)
+	provider := &countingProvider{rates: map[string]decimal.Decimal{
+		"EUR/JPY": decimal.RequireFromString("160"),
+	}}
+	fxSvc := newTestFXService(t, db, provider, time.Millisecond)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "JPY", OwnerID: 1}).Error)
+
+	quote, err := fxSvc.CreateQuote(context.Background(), 1, "EUR", "JPY", decimal.NewFromInt(10))
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(10), quote.ID, 1), service.ErrQuoteExpired)
+
+	from, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, from.Balance.Equal(decimal.NewFromInt(100)), "balance is %s", from.Balance)
+}
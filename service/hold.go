@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHoldTTL = 7 * 24 * time.Hour
+
+	// Expired holds listed at once by a sweep
+	sweepBatchSize = 100
+)
+
+var ErrHoldNotActive = errors.New("hold has already been captured, released or has expired")
+var ErrHoldExpired = errors.New("hold has expired")
+var ErrCaptureExceedsHold = errors.New("cannot capture more than the held amount")
+
+type HoldService struct {
+	repo            repository.HoldRepository
+	walletRepo      repository.WalletRepository
+	transactionRepo repository.TransactionRepository
+	outboxRepo      repository.OutboxRepository
+	ledger          *ledger.Ledger
+	ttl             time.Duration
+	timeouts        Timeouts
+}
+
+// NewHoldService returns a HoldService whose holds expire after ttl, which
+// defaults to 7 days. Every call is bounded by timeouts.
+func NewHoldService(repo repository.HoldRepository, walletRepo repository.WalletRepository, transactionRepo repository.TransactionRepository, outboxRepo repository.OutboxRepository, books *ledger.Ledger, ttl time.Duration, timeouts Timeouts) *HoldService {
+	if ttl <= 0 {
+		ttl = defaultHoldTTL
+	}
+	return &HoldService{repo: repo, walletRepo: walletRepo, transactionRepo: transactionRepo, outboxRepo: outboxRepo, ledger: books, ttl: ttl, timeouts: timeouts}
+}
+
+// PlaceHold reserves amount of the wallet. It lowers the available balance,
+// but nothing is booked until the hold is captured.
+func (s *HoldService) PlaceHold(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	wallet, err := s.walletRepo.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.OwnerID != userID {
+		return nil, ErrAccessDenied
+	}
+
+	if err := checkPrecision(wallet, amount); err != nil {
+		return nil, err
+	}
+
+	reference, err := newReference("hold")
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &domain.Hold{
+		WalletID:       walletID,
+		Amount:         amount,
+		CapturedAmount: decimal.Zero,
+		Status:         domain.HoldStatusActive,
+		ExpiresAt:      time.Now().Add(s.ttl),
+		ActorID:        userID,
+		Reference:      reference,
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	if _, err := s.walletRepo.AdjustHeldBalance(tx, walletID, amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.repo.CreateHold(tx, hold); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.walletRepo.InvalidateCache(ctx, walletID)
+	return hold, nil
+}
+
+// CaptureHold debits the wallet by amount, or by the whole held amount if
+// amount is zero, and frees whatever is left of the hold.
+func (s *HoldService) CaptureHold(ctx context.Context, walletID, holdID uint64, amount decimal.Decimal, userID uint64) (*domain.Hold, error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	wallet, err := s.walletRepo.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.OwnerID != userID {
+		return nil, ErrAccessDenied
+	}
+
+	if err := checkPrecision(wallet, amount); err != nil {
+		return nil, err
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	hold, err := s.activeHold(tx, walletID, holdID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if amount.IsZero() {
+		amount = hold.Amount
+	}
+	if amount.GreaterThan(hold.Amount) {
+		tx.Rollback()
+		return nil, ErrCaptureExceedsHold
+	}
+
+	// Free the hold first, so that the debit may spend the held amount
+	if _, err := s.walletRepo.AdjustHeldBalance(tx, walletID, hold.Amount.Neg()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	entry := ledger.NewEntry(hold.Reference, "capture").
+		Debit(ledger.WalletAccount(walletID), amount).
+		Credit(ledger.SystemAccount(ledger.KindCash, wallet.Currency), amount)
+	wallets, err := s.ledger.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	transaction := &domain.Transaction{
+		WalletID:     walletID,
+		Type:         domain.TransactionTypeDebit,
+		Origin:       domain.TransactionOriginCapture,
+		Amount:       amount,
+		BalanceAfter: wallets[walletID].Balance,
+		ActorID:      userID,
+		Reference:    hold.Reference,
+	}
+	if err := s.transactionRepo.CreateTransaction(tx, transaction); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordWalletEvent(s.outboxRepo, tx, transaction, wallet.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	hold.Status = domain.HoldStatusCaptured
+	hold.CapturedAmount = amount
+	if err := s.repo.UpdateHold(tx, hold); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.walletRepo.InvalidateCache(ctx, walletID)
+	return hold, nil
+}
+
+// ReleaseHold frees the held amount without debiting the wallet.
+func (s *HoldService) ReleaseHold(ctx context.Context, walletID, holdID, userID uint64) (*domain.Hold, error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	wallet, err := s.walletRepo.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.OwnerID != userID {
+		return nil, ErrAccessDenied
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	hold, err := s.activeHold(tx, walletID, holdID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.endHold(tx, hold, domain.HoldStatusReleased); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.walletRepo.InvalidateCache(ctx, walletID)
+	return hold, nil
+}
+
+// ExpireHolds releases the active holds whose TTL has passed, batch after
+// batch until none is left, and returns how many it released. A hold that
+// cannot be released is logged and skipped, the next sweep tries it again.
+func (s *HoldService) ExpireHolds(ctx context.Context) (int, error) {
+	now := time.Now()
+	expired := 0
+	var afterID uint64
+	for {
+		holds, err := s.repo.ListExpiredHolds(ctx, now, afterID, sweepBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, h := range holds {
+			released, err := s.expireHold(ctx, h.ID)
+			if err != nil {
+				logrus.Errorf("error in expiring hold %d, err: %s", h.ID, err)
+				continue
+			}
+			if released {
+				expired++
+				s.walletRepo.InvalidateCache(ctx, h.WalletID)
+			}
+		}
+
+		if len(holds) < sweepBatchSize {
+			return expired, nil
+		}
+		afterID = holds[len(holds)-1].ID
+	}
+}
+
+// expireHold releases the hold unless it was captured or released since it
+// was listed.
+func (s *HoldService) expireHold(ctx context.Context, id uint64) (bool, error) {
+	released := false
+	err := s.repo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		hold, err := s.repo.GetHoldForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if hold.Status != domain.HoldStatusActive {
+			return nil
+		}
+		released = true
+		return s.endHold(tx, hold, domain.HoldStatusExpired)
+	})
+	return released && err == nil, err
+}
+
+// RunSweeper expires holds every interval until ctx is done.
+func (s *HoldService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.ExpireHolds(ctx)
+			if err != nil {
+				logrus.Errorf("error in expiring holds, err: %s", err)
+			}
+			if expired > 0 {
+				logrus.Infof("Expired %d holds", expired)
+			}
+		}
+	}
+}
+
+// activeHold locks the hold and makes sure it belongs to the wallet and can
+// still be captured or released.
+func (s *HoldService) activeHold(tx *gorm.DB, walletID, holdID uint64) (*domain.Hold, error) {
+	hold, err := s.repo.GetHoldForUpdate(tx, holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.WalletID != walletID {
+		return nil, repository.ErrHoldNotFound
+	}
+
+	if hold.Status != domain.HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+
+	// The sweeper has not caught up with it yet
+	if !time.Now().Before(hold.ExpiresAt) {
+		return nil, ErrHoldExpired
+	}
+	return hold, nil
+}
+
+// endHold frees the held amount and moves the hold to status.
+func (s *HoldService) endHold(tx *gorm.DB, hold *domain.Hold, status domain.HoldStatus) error {
+	if _, err := s.walletRepo.AdjustHeldBalance(tx, hold.WalletID, hold.Amount.Neg()); err != nil {
+		return err
+	}
+
+	hold.Status = status
+	return s.repo.UpdateHold(tx, hold)
+}
@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestHoldServices returns a wallet and a hold service sharing one cache,
+// so that each sees the balance changes of the other.
+func newTestHoldServices(t *testing.T, db *gorm.DB, ttl time.Duration) (*service.WalletService, *service.HoldService) {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	walletRepo := repository.NewWalletMySQLRepository(db, cache)
+	transactionRepo := repository.NewTransactionMySQLRepository(db)
+	outboxRepo := repository.NewOutboxMySQLRepository(db, cache)
+	books := ledger.New(walletRepo)
+
+	walletSvc := service.NewWalletService(walletRepo, transactionRepo, repository.NewFXMySQLRepository(db, cache), outboxRepo, books, "EUR", service.Timeouts{})
+	holdSvc := service.NewHoldService(repository.NewHoldMySQLRepository(db), walletRepo, transactionRepo, outboxRepo, books, ttl, service.Timeouts{})
+	return walletSvc, holdSvc
+}
+
+func assertBalances(t *testing.T, svc *service.WalletService, walletID uint64, balance, available int64) {
+	t.Helper()
+
+	wallet, err := svc.GetBalance(context.Background(), walletID, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(balance)), "balance is %s", wallet.Balance)
+	assert.True(t, wallet.AvailableBalance().Equal(decimal.NewFromInt(available)), "available balance is %s", wallet.AvailableBalance())
+}
+
+func TestHoldCaptureAndRelease(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc, holdSvc := newTestHoldServices(t, db, time.Hour)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	hold, err := holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(60), 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.HoldStatusActive, hold.Status)
+	assertBalances(t, walletSvc, 1, 100, 40)
+
+	_, err = holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(50), 1)
+	assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+	_, err = holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(10), 2)
+	assert.ErrorIs(t, err, service.ErrAccessDenied)
+
+	// The held amount cannot be spent elsewhere
+	assert.ErrorIs(t, walletSvc.DebitWallet(context.Background(), 1, decimal.NewFromInt(50), 1), repository.ErrInsufficientFunds)
+	require.NoError(t, walletSvc.DebitWallet(context.Background(), 1, decimal.NewFromInt(40), 1))
+	assertBalances(t, walletSvc, 1, 60, 0)
+
+	_, err = holdSvc.CaptureHold(context.Background(), 1, hold.ID, decimal.NewFromInt(70), 1)
+	assert.ErrorIs(t, err, service.ErrCaptureExceedsHold)
+
+	// A partial capture frees the rest
+	hold, err = holdSvc.CaptureHold(context.Background(), 1, hold.ID, decimal.NewFromInt(45), 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.HoldStatusCaptured, hold.Status)
+	assert.True(t, hold.CapturedAmount.Equal(decimal.NewFromInt(45)))
+	assertBalances(t, walletSvc, 1, 15, 15)
+
+	_, err = holdSvc.CaptureHold(context.Background(), 1, hold.ID, decimal.Zero, 1)
+	assert.ErrorIs(t, err, service.ErrHoldNotActive)
+
+	other, err := holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(15), 1)
+	require.NoError(t, err)
+	assertBalances(t, walletSvc, 1, 15, 0)
+
+	other, err = holdSvc.ReleaseHold(context.Background(), 1, other.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.HoldStatusReleased, other.Status)
+	assertBalances(t, walletSvc, 1, 15, 15)
+
+	_, err = holdSvc.ReleaseHold(context.Background(), 1, other.ID, 1)
+	assert.ErrorIs(t, err, service.ErrHoldNotActive)
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestCaptureWholeHold(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc, holdSvc := newTestHoldServices(t, db, time.Hour)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	hold, err := holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(30), 1)
+	require.NoError(t, err)
+
+	hold, err = holdSvc.CaptureHold(context.Background(), 1, hold.ID, decimal.Zero, 1)
+	require.NoError(t, err)
+	assert.True(t, hold.CapturedAmount.Equal(decimal.NewFromInt(30)))
+	assertBalances(t, walletSvc, 1, 70, 70)
+
+	var transaction domain.Transaction
+	require.NoError(t, db.Where("reference = ?", hold.Reference).First(&transaction).Error)
+	assert.Equal(t, domain.TransactionTypeDebit, transaction.Type)
+}
+
+func TestExpireHolds(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc, holdSvc := newTestHoldServices(t, db, time.Millisecond)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	hold, err := holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(30), 1)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = holdSvc.CaptureHold(context.Background(), 1, hold.ID, decimal.Zero, 1)
+	assert.ErrorIs(t, err, service.ErrHoldExpired)
+
+	expired, err := holdSvc.ExpireHolds(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assertBalances(t, walletSvc, 1, 100, 100)
+
+	expired, err = holdSvc.ExpireHolds(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, expired)
+
+	stored := &domain.Hold{}
+	require.NoError(t, db.First(stored, hold.ID).Error)
+	assert.Equal(t, domain.HoldStatusExpired, stored.Status)
+}
+
+func TestExpireHoldsReleasesTheWholeBacklog(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc, holdSvc := newTestHoldServices(t, db, time.Millisecond)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(1000), Currency: "EUR", OwnerID: 1}).Error)
+
+	// A hold of a wallet that is gone cannot be released, it does not hold
+	// back the others
+	require.NoError(t, db.Create(&domain.Hold{WalletID: 99, Amount: decimal.NewFromInt(1), Status: domain.HoldStatusActive, ExpiresAt: time.Now()}).Error)
+
+	const holds = 250
+	for i := 0; i < holds; i++ {
+		_, err := holdSvc.PlaceHold(context.Background(), 1, decimal.NewFromInt(1), 1)
+		require.NoError(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	expired, err := holdSvc.ExpireHolds(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, holds, expired)
+	assertBalances(t, walletSvc, 1, 1000, 1000)
+
+	var active int64
+	require.NoError(t, db.Model(&domain.Hold{}).Where("status = ?", domain.HoldStatusActive).Count(&active).Error)
+	assert.Equal(t, int64(1), active)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/metrics"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/shopspring/decimal"
+)
+
+// recordWalletOperation counts a credit, debit or transfer, or its failure by
+// the kind of error. currency is the one of the (source) wallet.
+func recordWalletOperation(operation, currency string, amount decimal.Decimal, err error) {
+	if err != nil {
+		metrics.WalletOperationFailed(operation, failureReason(err))
+		return
+	}
+	metrics.WalletOperationSucceeded(operation, currency, amount)
+}
+
+// failureReason names err with a label of low cardinality, errors that are
+// not expected from a client are all "internal".
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, repository.ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, ErrAccessDenied):
+		return "access_denied"
+	case errors.Is(err, repository.ErrWalletNotFound):
+		return "wallet_not_found"
+	case errors.Is(err, repository.ErrWalletFrozen):
+		return "wallet_frozen"
+	case errors.Is(err, ErrSameWallet):
+		return "same_wallet"
+	case errors.Is(err, ErrCurrencyMismatch):
+		return "currency_mismatch"
+	case errors.Is(err, ErrAmountPrecision), errors.Is(err, ledger.ErrInvalidPosting):
+		return "invalid_amount"
+	case errors.Is(err, repository.ErrQuoteNotFound), errors.Is(err, ErrQuoteExpired),
+		errors.Is(err, ErrQuoteUsed), errors.Is(err, ErrQuoteMismatch):
+		return "invalid_quote"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrNotReversible = errors.New("only credits and debits can be reversed")
+var ErrReversalNeedsAdmin = errors.New("only admins can reverse debits")
+var ErrAlreadyReversed = errors.New("transaction has already been reversed in full")
+var ErrReversalExceedsRemaining = errors.New("cannot reverse more than the unreversed amount")
+
+// ReverseTransaction compensates a credit, debit or hold capture with a
+// transaction in the opposite direction, which is linked to the original. An
+// amount of zero reverses whatever has not been reversed yet; smaller amounts
+// allow partial refunds. The original stays locked until the reversal is
+// booked, so two reversals cannot both spend the same remainder.
+//
+// Reversing a debit pays the money back into the wallet, only admins may do
+// that. The owner of the wallet may give back a credit.
+func (s *WalletService) ReverseTransaction(ctx context.Context, transactionID uint64, amount decimal.Decimal, userID uint64, admin bool) (reversal *domain.Transaction, err error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.ReverseTransaction", attribute.Int64("transaction.id", int64(transactionID)))
+	defer func() { endSpan(span, err) }()
+
+	reference, err := newReference("reversal")
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	original, err := s.transactionRepo.GetTransactionForUpdate(tx, transactionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// The ledger locks the wallet anyway; taking the lock here keeps the order
+	// transaction, then wallet
+	wallet, err := s.repo.GetWalletForUpdate(tx, original.WalletID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if wallet.OwnerID != userID && !admin {
+		tx.Rollback()
+		return nil, ErrAccessDenied
+	}
+
+	// A leg of a transfer cannot be undone without its counterpart, reversals
+	// are undone by a new credit or debit and adjustments by another adjustment
+	switch original.Origin {
+	case domain.TransactionOriginCredit:
+	case domain.TransactionOriginDebit, domain.TransactionOriginCapture:
+		if !admin {
+			tx.Rollback()
+			return nil, ErrReversalNeedsAdmin
+		}
+	default:
+		tx.Rollback()
+		return nil, ErrNotReversible
+	}
+
+	remaining := original.Amount.Sub(original.ReversedAmount)
+	if remaining.Sign() <= 0 {
+		tx.Rollback()
+		return nil, ErrAlreadyReversed
+	}
+
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if amount.GreaterThan(remaining) {
+		tx.Rollback()
+		return nil, ErrReversalExceedsRemaining
+	}
+
+	if err := checkPrecision(wallet, amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Reversing a credit pays the money back out, which the ledger only allows
+	// if the wallet still has it available
+	cash := ledger.SystemAccount(ledger.KindCash, wallet.Currency)
+	entry := ledger.NewEntry(reference, "reversal")
+	reversalType := domain.TransactionTypeCredit
+	if original.Type == domain.TransactionTypeCredit {
+		reversalType = domain.TransactionTypeDebit
+		entry.Debit(ledger.WalletAccount(wallet.ID), amount).Credit(cash, amount)
+	} else {
+		entry.Debit(cash, amount).Credit(ledger.WalletAccount(wallet.ID), amount)
+	}
+
+	wallets, err := s.ledger.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	reversal = &domain.Transaction{
+		WalletID:     wallet.ID,
+		Type:         reversalType,
+		Origin:       domain.TransactionOriginReversal,
+		Amount:       amount,
+		BalanceAfter: wallets[wallet.ID].Balance,
+		ActorID:      userID,
+		Reference:    reference,
+		ReversalOfID: &original.ID,
+	}
+	if err := s.transactionRepo.CreateTransaction(tx, reversal); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordWalletEvent(s.outboxRepo, tx, reversal, wallet.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.transactionRepo.UpdateReversedAmount(tx, original.ID, original.ReversedAmount.Add(amount)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	s.repo.InvalidateCache(ctx, wallet.ID)
+	return reversal, nil
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func lastTransaction(t *testing.T, db *gorm.DB, walletID uint64) *domain.Transaction {
+	t.Helper()
+
+	transaction := &domain.Transaction{}
+	require.NoError(t, db.Where("wallet_id = ?", walletID).Order("id DESC").First(transaction).Error)
+	return transaction
+}
+
+func TestReverseTransaction(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "EUR", OwnerID: 2}).Error)
+
+	require.NoError(t, svc.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+	purchase := lastTransaction(t, db, 1)
+	require.NoError(t, svc.DebitWallet(context.Background(), 1, decimal.NewFromInt(60), 1))
+	debit := lastTransaction(t, db, 1)
+
+	_, err := svc.ReverseTransaction(context.Background(), debit.ID, decimal.NewFromInt(10), 2, false)
+	assert.ErrorIs(t, err, service.ErrAccessDenied)
+
+	// The owner cannot pay a debit back to themselves
+	_, err = svc.ReverseTransaction(context.Background(), debit.ID, decimal.NewFromInt(10), 1, false)
+	assert.ErrorIs(t, err, service.ErrReversalNeedsAdmin)
+
+	_, err = svc.ReverseTransaction(context.Background(), debit.ID, decimal.NewFromInt(61), 2, true)
+	assert.ErrorIs(t, err, service.ErrReversalExceedsRemaining)
+
+	// Two partial refunds of the debit by an admin, then the rest
+	refund, err := svc.ReverseTransaction(context.Background(), debit.ID, decimal.NewFromInt(25), 2, true)
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionTypeCredit, refund.Type)
+	assert.Equal(t, debit.ID, *refund.ReversalOfID)
+	assert.Equal(t, domain.TransactionOriginReversal, refund.Origin)
+	assert.True(t, refund.BalanceAfter.Equal(decimal.NewFromInt(65)), "balance after is %s", refund.BalanceAfter)
+
+	refund, err = svc.ReverseTransaction(context.Background(), debit.ID, decimal.Zero, 2, true)
+	require.NoError(t, err)
+	assert.True(t, refund.Amount.Equal(decimal.NewFromInt(35)), "amount is %s", refund.Amount)
+
+	_, err = svc.ReverseTransaction(context.Background(), debit.ID, decimal.Zero, 2, true)
+	assert.ErrorIs(t, err, service.ErrAlreadyReversed)
+
+	_, err = svc.ReverseTransaction(context.Background(), refund.ID, decimal.Zero, 2, true)
+	assert.ErrorIs(t, err, service.ErrNotReversible)
+
+	stored := &domain.Transaction{}
+	require.NoError(t, db.First(stored, debit.ID).Error)
+	assert.True(t, stored.ReversedAmount.Equal(decimal.NewFromInt(60)), "reversed amount is %s", stored.ReversedAmount)
+
+	// Reversing a credit needs the money to still be there
+	require.NoError(t, svc.DebitWallet(context.Background(), 1, decimal.NewFromInt(50), 1))
+	_, err = svc.ReverseTransaction(context.Background(), purchase.ID, decimal.Zero, 1, false)
+	assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+	// The owner may give back a credit
+	chargeback, err := svc.ReverseTransaction(context.Background(), purchase.ID, decimal.NewFromInt(50), 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, domain.TransactionTypeDebit, chargeback.Type)
+	assert.True(t, chargeback.BalanceAfter.IsZero(), "balance after is %s", chargeback.BalanceAfter)
+
+	require.NoError(t, svc.CreditWallet(context.Background(), 2, decimal.NewFromInt(10), 2))
+	require.NoError(t, svc.Transfer(context.Background(), 2, 1, decimal.NewFromInt(10), 0, 2))
+	_, err = svc.ReverseTransaction(context.Background(), lastTransaction(t, db, 1).ID, decimal.Zero, 1, true)
+	assert.ErrorIs(t, err, service.ErrNotReversible)
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestConcurrentReversalsCannotExceedAmount(t *testing.T) {
+	db := newConcurrencyTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	require.NoError(t, svc.DebitWallet(context.Background(), 1, decimal.NewFromInt(20), 1))
+	debit := lastTransaction(t, db, 1)
+
+	const operations = 50
+	one := decimal.NewFromInt(1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, rejected := 0, 0
+	for i := 0; i < operations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.ReverseTransaction(context.Background(), debit.ID, one, 1, true)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, service.ErrAlreadyReversed):
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 20, succeeded)
+	assert.Equal(t, operations-20, rejected)
+
+	wallet, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)), "balance is %s", wallet.Balance)
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds the database and Redis work of a single service call, on
+// top of the deadline of the caller's context. A zero timeout only uses the
+// caller's deadline.
+type Timeouts struct {
+	// Lookups such as balances, wallet lists and authenticating a token
+	Read time.Duration
+	// Calls that write, such as transfers, registration and signing in
+	Write time.Duration
+}
+
+func (t Timeouts) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Read)
+}
+
+func (t Timeouts) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Write)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts the span of a service method, which endSpan ends.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := otel.Tracer("github.com/mohammadrabetian/quick/service")
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan records err and ends span. Errors caused by the request, such as
+// insufficient funds, are only named by error.reason; the others mark the
+// span as failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if reason := failureReason(err); reason != "internal" {
+			span.SetAttributes(attribute.String("error.reason", reason))
+		} else {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func walletIDAttribute(id uint64) attribute.KeyValue {
+	return attribute.Int64("wallet.id", int64(id))
+}
@@ -1,26 +1,524 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/accesstoken"
+	"github.com/mohammadrabetian/quick/pkg/password"
 	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidUsername = errors.New("username must be 3 to 32 characters of a-z, 0-9, '.', '_' or '-' and start with a letter")
+var ErrWeakPassword = errors.New("password must be 10 to 128 characters, mix at least three of lowercase, uppercase, digits and symbols unless it is 16 or more characters long, and not contain the username")
+var ErrUsernameTaken = errors.New("username is already taken")
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+var ErrRefreshNotSupported = errors.New("refresh tokens are only issued in jwt auth mode")
+var ErrUserDisabled = errors.New("user is disabled")
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+const (
+	defaultSessionTTL = 24 * time.Hour
+
+	// lastUsedResolution limits how often using a session causes a write
+	lastUsedResolution = time.Minute
+
+	// Sessions and refresh tokens deleted at once by a purge
+	purgeBatchSize = 500
+
+	minPasswordLength = 10
+	maxPasswordLength = 128
+	// passphrases this long need no character mix
+	passphraseLength = 16
 )
 
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{2,31}$`)
+
+// AuthTokens is handed out on login. In opaque mode only Token is set, in jwt
+// mode AccessToken and RefreshToken are.
+type AuthTokens struct {
+	Token        string    `json:"token,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
 type UserService struct {
-	repo repository.UserRepository
+	repo             repository.UserRepository
+	sessionRepo      repository.SessionRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	outboxRepo       repository.OutboxRepository
+	sessionTTL       time.Duration
+	tokens           *accesstoken.Manager
+	timeouts         Timeouts
+}
+
+// NewUserService creates the service in opaque token mode when tokens is nil,
+// and in jwt mode otherwise. In jwt mode sessionTTL is how long a session can
+// be kept alive by refreshing without logging in again. Every call is bounded
+// by timeouts.
+func NewUserService(
+	repo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	outboxRepo repository.OutboxRepository,
+	sessionTTL time.Duration,
+	tokens *accesstoken.Manager,
+	timeouts Timeouts,
+) *UserService {
+	if sessionTTL <= 0 {
+		sessionTTL = defaultSessionTTL
+	}
+	return &UserService{
+		repo:             repo,
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		outboxRepo:       outboxRepo,
+		sessionTTL:       sessionTTL,
+		tokens:           tokens,
+		timeouts:         timeouts,
+	}
+}
+
+// GetUserByUsername looks the username up in any case.
+func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+	return s.repo.GetUserByUsername(ctx, domain.NormalizeUsername(username))
+}
+
+func (s *UserService) UpdateUser(ctx context.Context, user *domain.User) error {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	return s.repo.UpdateUser(ctx, user)
+}
+
+// Register creates a new user. Usernames are case-insensitive and stored in
+// lowercase.
+func (s *UserService) Register(ctx context.Context, username, plaintext string) (*domain.User, error) {
+	return s.register(ctx, username, plaintext, nil)
+}
+
+// register creates the user and runs also, if set, in the same transaction,
+// e.g. to audit the creation.
+func (s *UserService) register(ctx context.Context, username, plaintext string, also func(tx *gorm.DB, user *domain.User) error) (*domain.User, error) {
+	username = domain.NormalizeUsername(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if !isStrongPassword(plaintext, username) {
+		return nil, ErrWeakPassword
+	}
+
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	existing, err := s.repo.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	hashed, err := password.Hash(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &domain.User{Username: username, Password: hashed}
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	if err := s.repo.CreateUser(tx, user); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if also != nil {
+		if err := also(tx, user); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+// Login checks the user's password and starts a session on the device. An
+// unknown username takes as long to reject as a wrong password, and both get
+// ErrInvalidCredentials. Disabled users get ErrUserDisabled.
+func (s *UserService) Login(ctx context.Context, username, plaintext, userAgent, ip string) (*AuthTokens, error) {
+	user, err := s.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		password.SimulateVerify(plaintext)
+		return nil, ErrInvalidCredentials
+	}
+
+	match, needsRehash, err := password.Verify(plaintext, user.Password)
+	if err != nil {
+		logrus.Errorf("error in verifying the password of user %d, err: %s", user.ID, err)
+	}
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Upgrade hashes made with outdated parameters, a failure here must not
+	// prevent the login
+	if needsRehash {
+		if hashed, err := password.Hash(plaintext); err != nil {
+			logrus.Errorf("error in rehashing the password of user %d, err: %s", user.ID, err)
+		} else {
+			user.Password = hashed
+			if err := s.UpdateUser(ctx, user); err != nil {
+				logrus.Errorf("error in storing the rehashed password of user %d, err: %s", user.ID, err)
+			}
+		}
+	}
+
+	return s.StartSession(ctx, user, userAgent, ip)
 }
 
-func (s *UserService) GetUserByUsername(username string) (*domain.User, error) {
-	return s.repo.GetUserByUsername(username)
+// StartSession signs the user in on a new device and returns its tokens.
+// Disabled users get ErrUserDisabled.
+func (s *UserService) StartSession(ctx context.Context, user *domain.User, userAgent, ip string) (*AuthTokens, error) {
+	if user.Disabled() {
+		return nil, ErrUserDisabled
+	}
+
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	// In jwt mode the session token is never handed out, it only keeps the
+	// sessions table uniform across both modes.
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &domain.Session{
+		UserID:     user.ID,
+		TokenHash:  hashToken(token),
+		ExpiresAt:  now.Add(s.sessionTTL),
+		LastUsedAt: now,
+		UserAgent:  userAgent,
+		IP:         ip,
+	}
+	tx := s.sessionRepo.GetDB().WithContext(ctx).Begin()
+	if err := s.sessionRepo.CreateSession(tx, session); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = recordEvent(s.outboxRepo, tx, domain.EventUserLoggedIn, userPartitionKey(user.ID), UserLoggedInEvent{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		UserAgent: userAgent,
+		IP:        ip,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	if s.tokens == nil {
+		return &AuthTokens{Token: token, TokenType: "Bearer", ExpiresAt: session.ExpiresAt}, nil
+	}
+	return s.issueTokens(ctx, user, session)
 }
 
-func (s *UserService) GetUserByToken(token string) (*domain.User, error) {
-	return s.repo.GetUserByToken(token)
+// RefreshSession exchanges a refresh token for new tokens. Every refresh token
+// works once, using it a second time revokes the session it belongs to.
+func (s *UserService) RefreshSession(ctx context.Context, refreshToken string) (*AuthTokens, error) {
+	if s.tokens == nil {
+		return nil, ErrRefreshNotSupported
+	}
+
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+
+	stored, err := s.refreshTokenRepo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		s.revokeLeakedSession(ctx, stored.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	now := time.Now()
+	if !now.Before(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.GetSessionByID(ctx, stored.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || !now.Before(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	marked, err := s.refreshTokenRepo.MarkRefreshTokenUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		// Another request used the same token in the meantime
+		s.revokeLeakedSession(ctx, stored.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled() {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session.ExpiresAt = now.Add(s.sessionTTL)
+	if err := s.sessionRepo.ExtendSession(ctx, session.ID, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if err := s.sessionRepo.TouchSession(ctx, session.ID, now); err != nil {
+		logrus.Errorf("error in updating the last use of session %d, err: %s", session.ID, err)
+	}
+
+	return s.issueTokens(ctx, user, session)
+}
+
+func (s *UserService) issueTokens(ctx context.Context, user *domain.User, session *domain.Session) (*AuthTokens, error) {
+	refreshToken, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.refreshTokenRepo.CreateRefreshToken(ctx, &domain.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := s.tokens.Issue(user.ID, user.Username, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// revokeLeakedSession is not canceled with the request, so that a client
+// giving up on the refresh does not keep the leaked session alive.
+func (s *UserService) revokeLeakedSession(ctx context.Context, sessionID uint64) {
+	logrus.Warnf("refresh token reuse detected, revoking session %d", sessionID)
+
+	ctx, cancel := s.timeouts.write(util.WithoutCancel(ctx))
+	defer cancel()
+
+	session, err := s.sessionRepo.GetSessionByID(ctx, sessionID)
+	if err == nil && session != nil {
+		err = s.sessionRepo.DeleteSession(ctx, session.UserID, session.ID)
+	}
+	if err == nil {
+		err = s.refreshTokenRepo.DeleteRefreshTokensBySession(ctx, sessionID)
+	}
+	if err != nil {
+		logrus.Errorf("error in revoking session %d, err: %s", sessionID, err)
+	}
+}
+
+// AuthenticateToken returns the user and session ID the bearer token belongs
+// to, or a nil user if the token is unknown, revoked or expired, or its user
+// is disabled.
+//
+// In jwt mode this does not touch the database: the returned user only has
+// its ID and username set, and revoking a session only stops its refresh
+// tokens, access tokens stay valid until they expire.
+func (s *UserService) AuthenticateToken(ctx context.Context, token string) (*domain.User, uint64, error) {
+	if s.tokens != nil {
+		claims, err := s.tokens.Parse(token)
+		if err != nil {
+			return nil, 0, nil
+		}
+		userID, _ := claims.UserID()
+		return &domain.User{ID: userID, Username: claims.Username}, claims.SessionID, nil
+	}
+
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+
+	session, err := s.sessionRepo.GetSessionByTokenHash(ctx, hashToken(token))
+	if err != nil || session == nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		return nil, 0, nil
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil || user == nil {
+		return nil, 0, err
+	}
+	if user.Disabled() {
+		return nil, 0, nil
+	}
+
+	if now.Sub(session.LastUsedAt) > lastUsedResolution {
+		if err := s.sessionRepo.TouchSession(ctx, session.ID, now); err != nil {
+			logrus.Errorf("error in updating the last use of session %d, err: %s", session.ID, err)
+		}
+	}
+
+	return user, session.ID, nil
+}
+
+func (s *UserService) ListSessions(ctx context.Context, userID uint64) ([]domain.Session, error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+	return s.sessionRepo.ListSessionsByUser(ctx, userID)
+}
+
+func (s *UserService) RevokeSession(ctx context.Context, userID, sessionID uint64) error {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	return s.sessionRepo.DeleteSession(ctx, userID, sessionID)
+}
+
+// RevokeAllSessions signs the user out everywhere and returns the number of
+// revoked sessions.
+func (s *UserService) RevokeAllSessions(ctx context.Context, userID uint64) (int64, error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	return s.sessionRepo.DeleteSessionsByUser(ctx, userID)
+}
+
+// PurgeSessions deletes the sessions which expired or were revoked, batch
+// after batch, and then the refresh tokens left without a session. It returns
+// how many sessions it deleted.
+func (s *UserService) PurgeSessions(ctx context.Context) (int64, error) {
+	now := time.Now()
+	var purged int64
+	for {
+		deleted, err := s.sessionRepo.PurgeSessions(ctx, now, purgeBatchSize)
+		purged += deleted
+		if err != nil {
+			return purged, err
+		}
+		if deleted < purgeBatchSize {
+			break
+		}
+	}
+
+	for {
+		deleted, err := s.refreshTokenRepo.PurgeRefreshTokens(ctx, now, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if deleted < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// RunSessionPurger purges sessions every interval until ctx is done.
+func (s *UserService) RunSessionPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeSessions(ctx)
+			if err != nil {
+				logrus.Errorf("error in purging sessions, err: %s", err)
+			}
+			if purged > 0 {
+				logrus.Infof("Purged %d expired or revoked sessions", purged)
+			}
+		}
+	}
+}
+
+func GenerateSecureToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(tokenBytes), nil
+}
+
+func isStrongPassword(plaintext, username string) bool {
+	length := len([]rune(plaintext))
+	if length < minPasswordLength || length > maxPasswordLength {
+		return false
+	}
+	if strings.Contains(strings.ToLower(plaintext), username) {
+		return false
+	}
+	if length >= passphraseLength {
+		return true
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range plaintext {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes >= 3
 }
 
-func (s *UserService) UpdateUser(user *domain.User) error {
-	return s.repo.UpdateUser(user)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
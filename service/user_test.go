@@ -0,0 +1,238 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/accesstoken"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func newTestUserService(t *testing.T, db *gorm.DB, tokens *accesstoken.Manager) *service.UserService {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	return service.NewUserService(
+		repository.NewUserMySQLRepository(db),
+		repository.NewSessionMySQLRepository(db),
+		repository.NewRefreshTokenMySQLRepository(db),
+		repository.NewOutboxMySQLRepository(db, cache),
+		time.Hour,
+		tokens,
+		service.Timeouts{Read: time.Second, Write: time.Second},
+	)
+}
+
+func newTestTokenManager(t *testing.T) *accesstoken.Manager {
+	t.Helper()
+
+	tokens, err := accesstoken.NewManager(util.JWTConfig{
+		AccessTTL:    time.Minute,
+		SigningKeyID: "test",
+		Keys: []util.JWTKeyConfig{
+			{ID: "test", Algorithm: "HS256", Secret: "0123456789abcdef0123456789abcdef"},
+		},
+	})
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestOpaqueSessions(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, nil)
+	user := &domain.User{ID: 1, Username: "user1", Password: "hash"}
+	require.NoError(t, db.Create(user).Error)
+
+	tokens, err := svc.StartSession(context.Background(), user, "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.Token)
+	assert.Empty(t, tokens.RefreshToken)
+
+	authenticated, sessionID, err := svc.AuthenticateToken(context.Background(), tokens.Token)
+	require.NoError(t, err)
+	require.NotNil(t, authenticated)
+	assert.Equal(t, "user1", authenticated.Username)
+
+	var stored domain.Session
+	require.NoError(t, db.First(&stored, sessionID).Error)
+	assert.NotEqual(t, tokens.Token, stored.TokenHash, "the raw token must not be stored")
+
+	var event domain.OutboxEvent
+	require.NoError(t, db.Where("type = ?", domain.EventUserLoggedIn).First(&event).Error)
+	assert.Equal(t, "user:1", event.PartitionKey)
+	assert.Contains(t, event.Payload, fmt.Sprintf(`"session_id":%d`, sessionID))
+
+	require.NoError(t, svc.RevokeSession(context.Background(), user.ID, sessionID))
+	authenticated, _, err = svc.AuthenticateToken(context.Background(), tokens.Token)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+
+	_, err = svc.RefreshSession(context.Background(), "anything")
+	assert.ErrorIs(t, err, service.ErrRefreshNotSupported)
+}
+
+func TestExpiredSession(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, nil)
+	user := &domain.User{ID: 1, Username: "user1", Password: "hash"}
+	require.NoError(t, db.Create(user).Error)
+
+	tokens, err := svc.StartSession(context.Background(), user, "agent", "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&domain.Session{}).Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error)
+
+	authenticated, _, err := svc.AuthenticateToken(context.Background(), tokens.Token)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, newTestTokenManager(t))
+	user := &domain.User{ID: 1, Username: "user1", Password: "hash"}
+	require.NoError(t, db.Create(user).Error)
+
+	first, err := svc.StartSession(context.Background(), user, "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, first.Token)
+	assert.NotEmpty(t, first.AccessToken)
+
+	authenticated, sessionID, err := svc.AuthenticateToken(context.Background(), first.AccessToken)
+	require.NoError(t, err)
+	require.NotNil(t, authenticated)
+	assert.Equal(t, user.ID, authenticated.ID)
+
+	second, err := svc.RefreshSession(context.Background(), first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// Replaying the first refresh token revokes the session, so the token
+	// issued in the meantime stops working as well
+	_, err = svc.RefreshSession(context.Background(), first.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrRefreshTokenReused)
+
+	_, err = svc.RefreshSession(context.Background(), second.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	sessions, err := svc.ListSessions(context.Background(), user.ID)
+	require.NoError(t, err)
+	for _, s := range sessions {
+		assert.NotEqual(t, sessionID, s.ID)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, nil)
+
+	user, err := svc.Register(context.Background(), "  NewUser ", "Correct-Horse-1")
+	require.NoError(t, err)
+	assert.Equal(t, "newuser", user.Username)
+	assert.NotEqual(t, "Correct-Horse-1", user.Password)
+
+	_, err = svc.Register(context.Background(), "newuser", "Another-Pass-2")
+	assert.ErrorIs(t, err, service.ErrUsernameTaken)
+
+	invalidUsernames := []string{"ab", "1user", "user name", "user@example.com", "a-very-long-username-that-goes-past-32"}
+	for _, username := range invalidUsernames {
+		_, err := svc.Register(context.Background(), username, "Correct-Horse-1")
+		assert.ErrorIs(t, err, service.ErrInvalidUsername, username)
+	}
+
+	weakPasswords := []string{"Short-1", "lowercaseonly", "lowercase123", "Quickuser1-x"}
+	for _, password := range weakPasswords {
+		_, err := svc.Register(context.Background(), "quickuser", password)
+		assert.ErrorIs(t, err, service.ErrWeakPassword, password)
+	}
+
+	_, err = svc.Register(context.Background(), "phraseuser", "a long and memorable passphrase")
+	assert.NoError(t, err)
+}
+
+func TestLogin(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, nil)
+	ctx := context.Background()
+
+	user, err := svc.Register(ctx, "user1", "Correct-Horse-1")
+	require.NoError(t, err)
+
+	tokens, err := svc.Login(ctx, "user1", "Correct-Horse-1", "quick-test", "127.0.0.1")
+	require.NoError(t, err)
+	authenticated, _, err := svc.AuthenticateToken(ctx, tokens.Token)
+	require.NoError(t, err)
+	require.NotNil(t, authenticated)
+	assert.Equal(t, user.ID, authenticated.ID)
+
+	// Usernames are case-insensitive
+	_, err = svc.Login(ctx, " User1", "Correct-Horse-1", "quick-test", "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = svc.Login(ctx, "user1", "wrong-password", "quick-test", "127.0.0.1")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "nobody", "Correct-Horse-1", "quick-test", "127.0.0.1")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+
+	// Hashes made with outdated parameters are upgraded
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-1"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&domain.User{}).Where("id = ?", user.ID).Update("password", string(bcryptHash)).Error)
+	_, err = svc.Login(ctx, "user1", "Correct-Horse-1", "quick-test", "127.0.0.1")
+	require.NoError(t, err)
+	upgraded, err := svc.GetUserByUsername(ctx, "user1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(upgraded.Password, "$argon2id$"), upgraded.Password)
+
+	require.NoError(t, db.Model(&domain.User{}).Where("id = ?", user.ID).Update("disabled_at", time.Now()).Error)
+	_, err = svc.Login(ctx, "user1", "Correct-Horse-1", "quick-test", "127.0.0.1")
+	assert.ErrorIs(t, err, service.ErrUserDisabled)
+}
+
+func TestPurgeSessions(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestUserService(t, db, newTestTokenManager(t))
+	user := &domain.User{ID: 1, Username: "user1", Password: "hash"}
+	require.NoError(t, db.Create(user).Error)
+
+	var sessionIDs []uint64
+	for i := 0; i < 3; i++ {
+		tokens, err := svc.StartSession(context.Background(), user, "agent", "127.0.0.1")
+		require.NoError(t, err)
+		_, sessionID, err := svc.AuthenticateToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+
+	require.NoError(t, svc.RevokeSession(context.Background(), user.ID, sessionIDs[0]))
+	require.NoError(t, db.Model(&domain.Session{}).Where("id = ?", sessionIDs[1]).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	purged, err := svc.PurgeSessions(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	var sessions, refreshTokens int64
+	require.NoError(t, db.Unscoped().Model(&domain.Session{}).Count(&sessions).Error)
+	require.NoError(t, db.Unscoped().Model(&domain.RefreshToken{}).Count(&refreshTokens).Error)
+	assert.Equal(t, int64(1), sessions)
+	assert.Equal(t, int64(1), refreshTokens)
+
+	listed, err := svc.ListSessions(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, sessionIDs[2], listed[0].ID)
+}
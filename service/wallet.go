@@ -1,81 +1,401 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"time"
 
 	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/pkg/currency"
 	"github.com/mohammadrabetian/quick/repository"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
 )
 
 var ErrAccessDenied = errors.New("access denied")
+var ErrSameWallet = errors.New("cannot transfer to the same wallet")
+var ErrAmountPrecision = errors.New("amount has more decimal places than the currency allows")
+var ErrCurrencyMismatch = errors.New("wallets hold different currencies, an explicit conversion is required")
 
 type WalletService struct {
-	repo repository.WalletRepository
+	repo            repository.WalletRepository
+	transactionRepo repository.TransactionRepository
+	fxRepo          repository.FXRepository
+	outboxRepo      repository.OutboxRepository
+	ledger          *ledger.Ledger
+	defaultCurrency string
+	timeouts        Timeouts
 }
 
-func NewWalletService(repo repository.WalletRepository) *WalletService {
-	return &WalletService{repo: repo}
+// NewWalletService returns a WalletService that books every balance change in
+// books, emits it through the outbox and opens wallets in defaultCurrency when
+// no currency is asked for. Every call is bounded by timeouts.
+func NewWalletService(repo repository.WalletRepository, transactionRepo repository.TransactionRepository, fxRepo repository.FXRepository, outboxRepo repository.OutboxRepository, books *ledger.Ledger, defaultCurrency string, timeouts Timeouts) *WalletService {
+	return &WalletService{repo: repo, transactionRepo: transactionRepo, fxRepo: fxRepo, outboxRepo: outboxRepo, ledger: books, defaultCurrency: defaultCurrency, timeouts: timeouts}
 }
 
-func (s *WalletService) GetBalance(walletID uint64, username string) (*domain.Wallet, error) {
-	wallet, err := s.repo.GetWallet(walletID)
+func (s *WalletService) GetBalance(ctx context.Context, walletID, userID uint64) (wallet *domain.Wallet, err error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.GetBalance", walletIDAttribute(walletID))
+	defer func() { endSpan(span, err) }()
+
+	wallet, err = s.repo.GetWallet(ctx, walletID)
 	if err != nil {
 		return nil, err
 	}
 
-	if wallet.UserID != username {
+	if wallet.OwnerID != userID {
 		return nil, ErrAccessDenied
 	}
 
 	return wallet, nil
 }
 
-func (s *WalletService) CreditWallet(walletID uint64, amount decimal.Decimal, username string) error {
-	wallet, err := s.repo.GetWallet(walletID)
+// CreateWallet opens a new, empty wallet for the user in the given ISO 4217
+// currency, or in the default currency if currencyCode is empty.
+func (s *WalletService) CreateWallet(ctx context.Context, userID uint64, currencyCode string) (wallet *domain.Wallet, err error) {
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.CreateWallet")
+	defer func() { endSpan(span, err) }()
+
+	if currencyCode == "" {
+		currencyCode = s.defaultCurrency
+	}
+	cur, err := currency.Lookup(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet = &domain.Wallet{Balance: decimal.Zero, Currency: cur.Code, OwnerID: userID}
+	if err := s.repo.CreateWallet(ctx, wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+func (s *WalletService) ListWallets(ctx context.Context, userID uint64) (wallets []domain.Wallet, err error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.ListWallets")
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.ListWalletsByOwner(ctx, userID)
+}
+
+func (s *WalletService) CreditWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error {
+	return s.changeBalance(ctx, walletID, amount, domain.TransactionTypeCredit, userID)
+}
+
+func (s *WalletService) DebitWallet(ctx context.Context, walletID uint64, amount decimal.Decimal, userID uint64) error {
+	return s.changeBalance(ctx, walletID, amount, domain.TransactionTypeDebit, userID)
+}
+
+// changeBalance books amount between the wallet and the cash account of its
+// currency and records the transaction. Ownership is checked against the
+// cached wallet, since it never changes, while the balance itself is only
+// read and written under a row lock by the ledger.
+func (s *WalletService) changeBalance(ctx context.Context, walletID uint64, amount decimal.Decimal, transactionType domain.TransactionType, userID uint64) (err error) {
+	spanName := "WalletService.DebitWallet"
+	if transactionType == domain.TransactionTypeCredit {
+		spanName = "WalletService.CreditWallet"
+	}
+	var currencyCode string
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, spanName, walletIDAttribute(walletID))
+	defer func() {
+		recordWalletOperation(string(transactionType), currencyCode, amount, err)
+		endSpan(span, err)
+	}()
+
+	wallet, err := s.repo.GetWallet(ctx, walletID)
 	if err != nil {
 		return err
 	}
+	currencyCode = wallet.Currency
 
-	if wallet.UserID != username {
+	if wallet.OwnerID != userID {
 		return ErrAccessDenied
 	}
 
-	newBalance := wallet.Balance.Add(amount)
+	if err := checkPrecision(wallet, amount); err != nil {
+		return err
+	}
 
-	tx := s.repo.GetDB().Begin()
-	err = s.repo.UpdateWallet(tx, walletID, newBalance)
+	reference, err := newReference(string(transactionType))
 	if err != nil {
+		return err
+	}
+
+	// Credits bring money in from outside, debits pay it out
+	cash := ledger.SystemAccount(ledger.KindCash, wallet.Currency)
+	entry := ledger.NewEntry(reference, string(transactionType))
+	if transactionType == domain.TransactionTypeCredit {
+		entry.Debit(cash, amount).Credit(ledger.WalletAccount(walletID), amount)
+	} else {
+		entry.Debit(ledger.WalletAccount(walletID), amount).Credit(cash, amount)
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+	wallets, err := s.ledger.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	transaction := &domain.Transaction{
+		WalletID:     walletID,
+		Type:         transactionType,
+		Origin:       domain.TransactionOrigin(transactionType),
+		Amount:       amount,
+		BalanceAfter: wallets[walletID].Balance,
+		ActorID:      userID,
+		Reference:    reference,
+	}
+	if err := s.transactionRepo.CreateTransaction(tx, transaction); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	tx.Commit()
+	if err := recordWalletEvent(s.outboxRepo, tx, transaction, wallet.Currency); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	s.repo.InvalidateCache(ctx, walletID)
 	return nil
 }
 
-func (s *WalletService) DebitWallet(walletID uint64, amount decimal.Decimal, username string) error {
-	wallet, err := s.repo.GetWallet(walletID)
+// Transfer moves amount from one wallet to another in a single database
+// transaction. Only the source wallet has to belong to the user. Wallets of
+// different currencies need the ID of an unexpired quote from FXService for
+// exactly this conversion; quoteID is 0 otherwise.
+func (s *WalletService) Transfer(ctx context.Context, fromWalletID, toWalletID uint64, amount decimal.Decimal, quoteID, userID uint64) (err error) {
+	var currencyCode string
+	ctx, cancel := s.timeouts.write(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.Transfer",
+		walletIDAttribute(fromWalletID), attribute.Int64("wallet.to_id", int64(toWalletID)))
+	defer func() {
+		recordWalletOperation("transfer", currencyCode, amount, err)
+		endSpan(span, err)
+	}()
+
+	if fromWalletID == toWalletID {
+		return ErrSameWallet
+	}
+
+	from, err := s.repo.GetWallet(ctx, fromWalletID)
 	if err != nil {
 		return err
 	}
+	currencyCode = from.Currency
 
-	if wallet.UserID != username {
+	if from.OwnerID != userID {
 		return ErrAccessDenied
 	}
 
-	newBalance := wallet.Balance.Sub(amount)
-	if newBalance.IsNegative() {
-		return repository.ErrInsufficientFunds
+	to, err := s.repo.GetWallet(ctx, toWalletID)
+	if err != nil {
+		return err
+	}
+
+	if quoteID == 0 && from.Currency != to.Currency {
+		return ErrCurrencyMismatch
+	}
+
+	if err := checkPrecision(from, amount); err != nil {
+		return err
+	}
+
+	reference, err := newReference("transfer")
+	if err != nil {
+		return err
+	}
+
+	tx := s.repo.GetDB().WithContext(ctx).Begin()
+
+	// Without a conversion the destination receives what the source sends
+	credited := amount
+	var usedQuoteID *uint64
+	entry := ledger.NewEntry(reference, "transfer")
+	if quoteID == 0 {
+		entry.Debit(ledger.WalletAccount(fromWalletID), amount).Credit(ledger.WalletAccount(toWalletID), amount)
+	} else {
+		quote, err := s.useQuote(tx, quoteID, from, to, amount, userID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		credited = quote.ConvertedAmount
+		usedQuoteID = &quote.ID
+		bookConversion(entry, from, to, quote)
+	}
+
+	wallets, err := s.ledger.Post(tx, entry)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Both legs share the reference, so either side can find its counterpart
+	legs := []*domain.Transaction{
+		{
+			WalletID:     fromWalletID,
+			Type:         domain.TransactionTypeDebit,
+			Origin:       domain.TransactionOriginTransfer,
+			Amount:       amount,
+			BalanceAfter: wallets[fromWalletID].Balance,
+			ActorID:      userID,
+			Reference:    reference,
+			QuoteID:      usedQuoteID,
+		},
+		{
+			WalletID:     toWalletID,
+			Type:         domain.TransactionTypeCredit,
+			Origin:       domain.TransactionOriginTransfer,
+			Amount:       credited,
+			BalanceAfter: wallets[toWalletID].Balance,
+			ActorID:      userID,
+			Reference:    reference,
+			QuoteID:      usedQuoteID,
+		},
+	}
+	currencies := []string{from.Currency, to.Currency}
+	for i, leg := range legs {
+		if err := s.transactionRepo.CreateTransaction(tx, leg); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := recordWalletEvent(s.outboxRepo, tx, leg, currencies[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
-	tx := s.repo.GetDB().Begin()
-	err = s.repo.UpdateWallet(tx, walletID, newBalance)
+	err = recordEvent(s.outboxRepo, tx, domain.EventTransferCompleted, walletPartitionKey(fromWalletID), TransferEvent{
+		FromWalletID:   fromWalletID,
+		ToWalletID:     toWalletID,
+		Amount:         amount,
+		FromCurrency:   from.Currency,
+		CreditedAmount: credited,
+		ToCurrency:     to.Currency,
+		QuoteID:        usedQuoteID,
+		ActorID:        userID,
+		Reference:      reference,
+	})
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	s.repo.InvalidateCache(ctx, fromWalletID, toWalletID)
 	return nil
 }
+
+// bookConversion adds the postings of a transfer between currencies to entry.
+// The source currency goes into our FX position and the quoted amount comes
+// out of it in the target currency. The spread, i.e. what the amount was worth
+// at the provider's rate minus what the user receives, is booked as fees.
+func bookConversion(entry *ledger.Entry, from, to *domain.Wallet, quote *domain.FXQuote) {
+	entry.
+		Debit(ledger.WalletAccount(from.ID), quote.Amount).
+		Credit(ledger.SystemAccount(ledger.KindFX, from.Currency), quote.Amount).
+		Debit(ledger.SystemAccount(ledger.KindFX, to.Currency), quote.ConvertedAmount).
+		Credit(ledger.WalletAccount(to.ID), quote.ConvertedAmount)
+
+	fee := quote.Amount.Mul(quote.Rate).Truncate(8).Sub(quote.ConvertedAmount)
+	if fee.Sign() > 0 {
+		entry.
+			Debit(ledger.SystemAccount(ledger.KindFX, to.Currency), fee).
+			Credit(ledger.SystemAccount(ledger.KindFees, to.Currency), fee)
+	}
+}
+
+// useQuote locks the quote inside tx, makes sure it prices exactly this
+// transfer and marks it as used.
+func (s *WalletService) useQuote(tx *gorm.DB, quoteID uint64, from, to *domain.Wallet, amount decimal.Decimal, userID uint64) (*domain.FXQuote, error) {
+	quote, err := s.fxRepo.GetQuoteForUpdate(tx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Other users' quotes are reported as missing
+	if quote.UserID != userID {
+		return nil, repository.ErrQuoteNotFound
+	}
+
+	if quote.UsedAt != nil {
+		return nil, ErrQuoteUsed
+	}
+
+	now := time.Now()
+	if !now.Before(quote.ExpiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	if quote.FromCurrency != from.Currency || quote.ToCurrency != to.Currency || !quote.Amount.Equal(amount) {
+		return nil, ErrQuoteMismatch
+	}
+
+	if err := s.fxRepo.MarkQuoteUsed(tx, quote.ID, now); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// ListTransactions returns one page of the wallet's transactions, newest first,
+// together with the total number of transactions matching the filter.
+func (s *WalletService) ListTransactions(ctx context.Context, walletID uint64, filter repository.TransactionFilter, userID uint64) (transactions []domain.Transaction, total int64, err error) {
+	ctx, cancel := s.timeouts.read(ctx)
+	defer cancel()
+	ctx, span := startSpan(ctx, "WalletService.ListTransactions", walletIDAttribute(walletID))
+	defer func() { endSpan(span, err) }()
+
+	wallet, err := s.repo.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if wallet.OwnerID != userID {
+		return nil, 0, ErrAccessDenied
+	}
+
+	return s.transactionRepo.ListTransactions(ctx, walletID, filter)
+}
+
+// checkPrecision makes sure amount can be expressed in the minor units of the
+// wallet's currency, e.g. that no fractional yen are moved.
+func checkPrecision(wallet *domain.Wallet, amount decimal.Decimal) error {
+	cur, err := currency.Lookup(wallet.Currency)
+	if err != nil {
+		return err
+	}
+
+	if !cur.Fits(amount) {
+		return ErrAmountPrecision
+	}
+	return nil
+}
+
+// newReference returns a random identifier like "transfer_3f2a..." used to
+// link transactions that belong to the same operation.
+func newReference(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + "_" + hex.EncodeToString(b), nil
+}
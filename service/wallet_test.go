@@ -0,0 +1,439 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/ledger"
+	"github.com/mohammadrabetian/quick/pkg/currency"
+	"github.com/mohammadrabetian/quick/pkg/tracing"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a throwaway SQLite database with the application schema.
+// Its single connection runs the transactions one after the other, the tests
+// of concurrent operations use newConcurrencyTestDB instead.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "quick.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrateTestDB(t, db)
+	return db
+}
+
+func migrateTestDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	require.NoError(t, db.AutoMigrate(
+		&domain.Wallet{},
+		&domain.User{},
+		&domain.Transaction{},
+		&domain.Session{},
+		&domain.RefreshToken{},
+		&domain.FXQuote{},
+		&domain.Hold{},
+		&domain.OutboxEvent{},
+		&domain.WebhookSubscription{},
+		&domain.WebhookDelivery{},
+		&domain.AuditEntry{},
+	))
+	require.NoError(t, db.AutoMigrate(ledger.Models()...))
+}
+
+// createTestUsers creates user1 to userN with IDs 1 to N.
+func createTestUsers(t *testing.T, db *gorm.DB, n int) {
+	t.Helper()
+
+	for i := 1; i <= n; i++ {
+		user := &domain.User{ID: uint64(i), Username: fmt.Sprintf("user%d", i), Password: "hash"}
+		require.NoError(t, db.Create(user).Error)
+	}
+}
+
+func newTestWalletService(t *testing.T, db *gorm.DB) *service.WalletService {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	walletRepo := repository.NewWalletMySQLRepository(db, cache)
+	transactionRepo := repository.NewTransactionMySQLRepository(db)
+	fxRepo := repository.NewFXMySQLRepository(db, cache)
+	outboxRepo := repository.NewOutboxMySQLRepository(db, cache)
+	return service.NewWalletService(walletRepo, transactionRepo, fxRepo, outboxRepo, ledger.New(walletRepo), "EUR", service.Timeouts{})
+}
+
+func TestConcurrentCreditsAndDebits(t *testing.T) {
+	db := newConcurrencyTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(1000), Currency: "EUR", OwnerID: 1}).Error)
+
+	const operations = 200
+	one := decimal.NewFromInt(1)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*operations)
+	for i := 0; i < operations; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- svc.CreditWallet(context.Background(), 1, one, 1)
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- svc.DebitWallet(context.Background(), 1, one, 1)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	wallet, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(1000)), "balance is %s", wallet.Balance)
+
+	var count int64
+	require.NoError(t, db.Model(&domain.Transaction{}).Where("wallet_id = ?", 1).Count(&count).Error)
+	assert.Equal(t, int64(2*operations), count)
+}
+
+func TestConcurrentDebitsCannotOverdraw(t *testing.T) {
+	db := newConcurrencyTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(50), Currency: "EUR", OwnerID: 1}).Error)
+
+	// Warm up the cache, so that a stale cached balance would be visible
+	_, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+
+	const operations = 300
+	one := decimal.NewFromInt(1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, rejected := 0, 0
+	for i := 0; i < operations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := svc.DebitWallet(context.Background(), 1, one, 1)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, repository.ErrInsufficientFunds):
+				rejected++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, succeeded)
+	assert.Equal(t, operations-50, rejected)
+
+	wallet, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.IsZero(), "balance is %s", wallet.Balance)
+}
+
+func TestConcurrentOppositeTransfers(t *testing.T) {
+	db := newConcurrencyTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 2}).Error)
+
+	const operations = 100
+	one := decimal.NewFromInt(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < operations; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, svc.Transfer(context.Background(), 1, 2, one, 0, 1))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, svc.Transfer(context.Background(), 2, 1, one, 0, 2))
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range []uint64{1, 2} {
+		wallet := &domain.Wallet{}
+		require.NoError(t, db.First(wallet, id).Error)
+		assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)), "wallet %d balance is %s", id, wallet.Balance)
+	}
+
+	assert.NoError(t, ledger.CheckInvariant(db))
+}
+
+func TestCurrencyRules(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+
+	eur, err := svc.CreateWallet(context.Background(), 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", eur.Currency)
+
+	jpy, err := svc.CreateWallet(context.Background(), 1, "jpy")
+	require.NoError(t, err)
+	assert.Equal(t, "JPY", jpy.Currency)
+
+	_, err = svc.CreateWallet(context.Background(), 1, "ABC")
+	assert.ErrorIs(t, err, currency.ErrUnknownCurrency)
+
+	require.NoError(t, svc.CreditWallet(context.Background(), eur.ID, decimal.RequireFromString("10.25"), 1))
+	assert.ErrorIs(t, svc.CreditWallet(context.Background(), eur.ID, decimal.RequireFromString("0.001"), 1), service.ErrAmountPrecision)
+
+	require.NoError(t, svc.CreditWallet(context.Background(), jpy.ID, decimal.NewFromInt(1000), 1))
+	assert.ErrorIs(t, svc.CreditWallet(context.Background(), jpy.ID, decimal.RequireFromString("0.5"), 1), service.ErrAmountPrecision)
+	assert.ErrorIs(t, svc.DebitWallet(context.Background(), jpy.ID, decimal.RequireFromString("0.5"), 1), service.ErrAmountPrecision)
+
+	assert.ErrorIs(t, svc.Transfer(context.Background(), eur.ID, jpy.ID, decimal.NewFromInt(1), 0, 1), service.ErrCurrencyMismatch)
+
+	wallet, err := svc.GetBalance(context.Background(), jpy.ID, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(1000)), "balance is %s", wallet.Balance)
+}
+
+func TestBalanceChangesAreWrittenToOutbox(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "EUR", OwnerID: 2}).Error)
+
+	require.NoError(t, svc.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+	require.NoError(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(30), 0, 1))
+
+	// A rejected change emits nothing
+	assert.ErrorIs(t, svc.DebitWallet(context.Background(), 1, decimal.NewFromInt(500), 1), repository.ErrInsufficientFunds)
+
+	var events []domain.OutboxEvent
+	require.NoError(t, db.Order("id").Find(&events).Error)
+	require.Len(t, events, 4)
+
+	assert.Equal(t, domain.EventWalletCredited, events[0].Type)
+	assert.Equal(t, "wallet:1", events[0].PartitionKey)
+	var credited service.WalletEvent
+	require.NoError(t, json.Unmarshal([]byte(events[0].Payload), &credited))
+	assert.True(t, credited.BalanceAfter.Equal(decimal.NewFromInt(100)), "balance after is %s", credited.BalanceAfter)
+	assert.Equal(t, "EUR", credited.Currency)
+
+	assert.Equal(t, domain.EventWalletDebited, events[1].Type)
+	assert.Equal(t, "wallet:1", events[1].PartitionKey)
+	assert.Equal(t, domain.EventWalletCredited, events[2].Type)
+	assert.Equal(t, "wallet:2", events[2].PartitionKey)
+
+	assert.Equal(t, domain.EventTransferCompleted, events[3].Type)
+	var transfer service.TransferEvent
+	require.NoError(t, json.Unmarshal([]byte(events[3].Payload), &transfer))
+	assert.Equal(t, uint64(1), transfer.FromWalletID)
+	assert.Equal(t, uint64(2), transfer.ToWalletID)
+	assert.True(t, transfer.CreditedAmount.Equal(decimal.NewFromInt(30)), "credited amount is %s", transfer.CreditedAmount)
+}
+
+// metricValue returns the value of the counter name with exactly labels, or 0
+// when it has not been counted yet.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := len(metric.GetLabel()) == len(labels)
+			for _, label := range metric.GetLabel() {
+				matched = matched && labels[label.GetName()] == label.GetValue()
+			}
+			if matched {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestWalletOperationsAreCounted(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "JPY", OwnerID: 1}).Error)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 2, Balance: decimal.Zero, Currency: "JPY", OwnerID: 2}).Error)
+
+	// The counters are shared by all tests, so only their increase is checked
+	type counter struct {
+		name   string
+		labels map[string]string
+		delta  float64
+	}
+	counters := []counter{
+		{"quick_wallet_operations_total", map[string]string{"operation": "credit", "currency": "JPY"}, 2},
+		{"quick_wallet_operation_amount_total", map[string]string{"operation": "credit", "currency": "JPY"}, 150},
+		{"quick_wallet_operations_total", map[string]string{"operation": "transfer", "currency": "JPY"}, 1},
+		{"quick_wallet_operation_amount_total", map[string]string{"operation": "transfer", "currency": "JPY"}, 30},
+		{"quick_wallet_operations_total", map[string]string{"operation": "debit", "currency": "JPY"}, 0},
+		{"quick_wallet_operation_failures_total", map[string]string{"operation": "debit", "reason": "insufficient_funds"}, 1},
+		{"quick_wallet_operation_failures_total", map[string]string{"operation": "transfer", "reason": "access_denied"}, 1},
+	}
+	before := make([]float64, len(counters))
+	for i, c := range counters {
+		before[i] = metricValue(t, c.name, c.labels)
+	}
+
+	require.NoError(t, svc.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+	require.NoError(t, svc.CreditWallet(context.Background(), 1, decimal.NewFromInt(50), 1))
+	require.NoError(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(30), 0, 1))
+	assert.ErrorIs(t, svc.DebitWallet(context.Background(), 1, decimal.NewFromInt(500), 1), repository.ErrInsufficientFunds)
+	assert.ErrorIs(t, svc.Transfer(context.Background(), 1, 2, decimal.NewFromInt(1), 0, 2), service.ErrAccessDenied)
+
+	for i, c := range counters {
+		assert.Equal(t, before[i]+c.delta, metricValue(t, c.name, c.labels), "%s %v", c.name, c.labels)
+	}
+}
+
+func TestWalletOperationsAreTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	db := newTestDB(t)
+	require.NoError(t, db.Use(tracing.GormPlugin{}))
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	require.NoError(t, svc.CreditWallet(ctx, 1, decimal.NewFromInt(10), 1))
+	assert.ErrorIs(t, svc.DebitWallet(ctx, 1, decimal.NewFromInt(500), 1), repository.ErrInsufficientFunds)
+	request.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	var sqlParents []trace.SpanID
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		if strings.HasPrefix(span.Name(), "gorm.") {
+			sqlParents = append(sqlParents, span.Parent().SpanID())
+		}
+	}
+
+	credit := spans["WalletService.CreditWallet"]
+	require.NotNil(t, credit)
+	assert.Equal(t, request.SpanContext().SpanID(), credit.Parent().SpanID())
+	assert.Contains(t, credit.Attributes(), attribute.Int64("wallet.id", 1))
+	assert.Equal(t, codes.Unset, credit.Status().Code)
+	// The queries of the credit are its children
+	assert.Contains(t, sqlParents, credit.SpanContext().SpanID())
+
+	// Rejected requests are not failures of the service
+	debit := spans["WalletService.DebitWallet"]
+	require.NotNil(t, debit)
+	assert.Contains(t, debit.Attributes(), attribute.String("error.reason", "insufficient_funds"))
+	assert.Equal(t, codes.Unset, debit.Status().Code)
+}
+
+func TestCanceledOperationsStopTheirWork(t *testing.T) {
+	db := newTestDB(t)
+	svc := newTestWalletService(t, db)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	// A client that went away
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := svc.GetBalance(canceled, 1, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, svc.DebitWallet(canceled, 1, decimal.NewFromInt(10), 1), context.Canceled)
+
+	// The configured timeout applies even without a deadline on the request
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer cache.Close()
+	walletRepo := repository.NewWalletMySQLRepository(db, cache)
+	timedOut := service.NewWalletService(walletRepo, repository.NewTransactionMySQLRepository(db), repository.NewFXMySQLRepository(db, cache),
+		repository.NewOutboxMySQLRepository(db, cache), ledger.New(walletRepo), "EUR", service.Timeouts{Read: time.Nanosecond, Write: time.Nanosecond})
+	_, err = timedOut.ListWallets(context.Background(), 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, timedOut.CreditWallet(context.Background(), 1, decimal.NewFromInt(10), 1), context.DeadlineExceeded)
+
+	wallet, err := svc.GetBalance(context.Background(), 1, 1)
+	require.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)), "balance is %s", wallet.Balance)
+
+	var count int64
+	require.NoError(t, db.Model(&domain.Transaction{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestCacheIsInvalidatedAfterTheRequestIsCanceled(t *testing.T) {
+	db := newTestDB(t)
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(100), Currency: "EUR", OwnerID: 1}).Error)
+
+	server := miniredis.RunT(t)
+	cache := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer cache.Close()
+	walletRepo := repository.NewWalletMySQLRepository(db, cache)
+
+	_, err := walletRepo.GetWallet(context.Background(), 1)
+	require.NoError(t, err)
+	keys := server.Keys()
+	require.Len(t, keys, 1)
+	// Wallets whose invalidation failed are not served forever
+	assert.Greater(t, server.TTL(keys[0]), time.Duration(0))
+
+	// The client went away between the commit and the invalidation
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	walletRepo.InvalidateCache(canceled, 1)
+	assert.Empty(t, server.Keys())
+}
@@ -0,0 +1,488 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/pkg/webhook"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Due deliveries sent per pass, and how many of them at once
+	deliveryBatchSize   = 50
+	deliveryConcurrency = 8
+
+	minWebhookSecretLength = 16
+	// lastErrorLength is the size of the last_error column
+	lastErrorLength = 255
+)
+
+var ErrInvalidWebhookURL = errors.New("webhook url must be an absolute http or https url")
+var ErrInvalidEventTypes = errors.New("event types must be a non-empty list of wallet.credited, wallet.debited, transfer.completed or user.logged_in")
+var ErrWeakWebhookSecret = errors.New("webhook secret must be at least 16 characters long")
+var ErrDeliveryInProgress = errors.New("webhook delivery is being sent")
+
+// webhookEventTypes are the events a subscription can ask for
+var webhookEventTypes = map[string]bool{
+	domain.EventWalletCredited:    true,
+	domain.EventWalletDebited:     true,
+	domain.EventTransferCompleted: true,
+	domain.EventUserLoggedIn:      true,
+}
+
+// RetryPolicy tells how failed deliveries are retried. The n-th retry waits
+// BackoffBase * 2^(n-1), at most BackoffMax, of which a random half is
+// jitter, so that a recovering endpoint is not hit by all retries at once.
+type RetryPolicy struct {
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// DisableAfter failed attempts in a row the subscription is disabled
+	DisableAfter int
+}
+
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.BackoffBase
+	for i := 1; i < attempts && delay < p.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > p.BackoffMax {
+		delay = p.BackoffMax
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// WebhookUpdate holds the fields of a subscription to change; nil fields are
+// left alone.
+type WebhookUpdate struct {
+	URL        *string
+	EventTypes []string
+	Active     *bool
+}
+
+// webhookBody is what receivers get, with the event's payload as data.
+type webhookBody struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type WebhookService struct {
+	repo       repository.WebhookRepository
+	walletRepo repository.WalletRepository
+	client     *http.Client
+	policy     RetryPolicy
+}
+
+// NewWebhookService returns a WebhookService which sends deliveries with
+// client. Unset fields of policy default to 8 attempts, backoff from 30
+// seconds up to an hour, and disabling after 20 failures in a row.
+func NewWebhookService(repo repository.WebhookRepository, walletRepo repository.WalletRepository, client *http.Client, policy RetryPolicy) *WebhookService {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 8
+	}
+	if policy.BackoffBase <= 0 {
+		policy.BackoffBase = 30 * time.Second
+	}
+	if policy.BackoffMax < policy.BackoffBase {
+		policy.BackoffMax = time.Hour
+	}
+	if policy.DisableAfter <= 0 {
+		policy.DisableAfter = 20
+	}
+	return &WebhookService{repo: repo, walletRepo: walletRepo, client: client, policy: policy}
+}
+
+// CreateSubscription registers an endpoint of the user. A secret is generated
+// if none is given; it is only ever returned here.
+func (s *WebhookService) CreateSubscription(ctx context.Context, userID uint64, rawURL, secret string, eventTypes []string) (*domain.WebhookSubscription, error) {
+	if err := validateWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	events, err := joinEventTypes(eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		secret, err = GenerateSecureToken()
+		if err != nil {
+			return nil, err
+		}
+	} else if len(secret) < minWebhookSecretLength {
+		return nil, ErrWeakWebhookSecret
+	}
+
+	subscription := &domain.WebhookSubscription{
+		UserID:     userID,
+		URL:        rawURL,
+		Secret:     secret,
+		EventTypes: events,
+		Active:     true,
+	}
+	if err := s.repo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context, userID uint64) ([]domain.WebhookSubscription, error) {
+	return s.repo.ListSubscriptions(ctx, userID)
+}
+
+func (s *WebhookService) GetSubscription(ctx context.Context, userID, id uint64) (*domain.WebhookSubscription, error) {
+	return s.repo.GetSubscription(ctx, userID, id)
+}
+
+// UpdateSubscription changes the subscription. Activating a disabled
+// subscription gives it a fresh start, its pending deliveries resume.
+func (s *WebhookService) UpdateSubscription(ctx context.Context, userID, id uint64, update WebhookUpdate) (*domain.WebhookSubscription, error) {
+	subscription, err := s.repo.GetSubscription(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.URL != nil {
+		if err := validateWebhookURL(*update.URL); err != nil {
+			return nil, err
+		}
+		subscription.URL = *update.URL
+	}
+
+	if update.EventTypes != nil {
+		events, err := joinEventTypes(update.EventTypes)
+		if err != nil {
+			return nil, err
+		}
+		subscription.EventTypes = events
+	}
+
+	if update.Active != nil && *update.Active != subscription.Active {
+		subscription.Active = *update.Active
+		if subscription.Active {
+			subscription.ConsecutiveFailures = 0
+			subscription.DisabledAt = nil
+		} else {
+			now := time.Now()
+			subscription.DisabledAt = &now
+		}
+	}
+
+	if err := s.repo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, userID, id uint64) error {
+	return s.repo.DeleteSubscription(ctx, userID, id)
+}
+
+// ListDeliveries returns one page of the subscription's deliveries, newest
+// first, and their total number.
+func (s *WebhookService) ListDeliveries(ctx context.Context, userID, subscriptionID uint64, page, pageSize int) ([]domain.WebhookDelivery, int64, error) {
+	if _, err := s.repo.GetSubscription(ctx, userID, subscriptionID); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListDeliveries(ctx, subscriptionID, page, pageSize)
+}
+
+// Redeliver sends a delivery again right away, whatever its status, and
+// returns it with the outcome. It also works for disabled subscriptions, so
+// that an endpoint can be tested before it is activated again. The delivery is
+// claimed like the deliverer does, so the two do not send it side by side.
+func (s *WebhookService) Redeliver(ctx context.Context, userID, subscriptionID, deliveryID uint64) (*domain.WebhookDelivery, error) {
+	subscription, err := s.repo.GetSubscription(ctx, userID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.repo.GetDelivery(ctx, subscriptionID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := s.repo.ClaimDelivery(ctx, delivery.ID, delivery.Status, delivery.NextAttemptAt, s.leaseUntil())
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrDeliveryInProgress
+	}
+
+	if err := s.deliver(ctx, subscription, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Publish queues a delivery of the event for every active subscription of the
+// users it concerns. It makes WebhookService an outbox.Sink; the deliveries
+// themselves are sent by RunDeliverer.
+func (s *WebhookService) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	userIDs, err := s.eventUsers(ctx, event)
+	if err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	subscriptions, err := s.repo.ListActiveSubscriptions(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookBody{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []domain.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, domain.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Body:           string(body),
+			Status:         domain.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	return s.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// DeliverDue sends the deliveries whose next attempt is due and returns how
+// many it attempted. Each delivery is claimed first, so that several
+// instances can deliver side by side.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := s.repo.ListDueDeliveries(ctx, time.Now(), deliveryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	attempted := 0
+	sem := make(chan struct{}, deliveryConcurrency)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		// Claimed once a slot is free, so the lease starts with the attempt
+		sem <- struct{}{}
+		claimed, err := s.repo.ClaimDelivery(ctx, delivery.ID, domain.WebhookDeliveryPending, delivery.NextAttemptAt, s.leaseUntil())
+		if err != nil {
+			logrus.Errorf("error in claiming webhook delivery %d, err: %s", delivery.ID, err)
+		}
+		if err != nil || !claimed || delivery.Subscription == nil {
+			<-sem
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := s.deliver(ctx, delivery.Subscription, delivery); err != nil {
+				logrus.Errorf("error in recording webhook delivery %d, err: %s", delivery.ID, err)
+			}
+			mu.Lock()
+			attempted++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return attempted, nil
+}
+
+// leaseUntil returns until when a delivery claimed now is left alone, long
+// enough for its request to time out before another instance retries it.
+func (s *WebhookService) leaseUntil() time.Time {
+	return time.Now().Add(s.client.Timeout + time.Minute)
+}
+
+// RunDeliverer sends due deliveries every interval until ctx is done.
+func (s *WebhookService) RunDeliverer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DeliverDue(ctx); err != nil {
+				logrus.Errorf("error in delivering webhooks, err: %s", err)
+			}
+		}
+	}
+}
+
+// deliver makes one attempt to send the delivery, and records its outcome on
+// the delivery and the subscription. The returned error is about recording
+// it; a failed attempt is not an error.
+func (s *WebhookService) deliver(ctx context.Context, subscription *domain.WebhookSubscription, delivery *domain.WebhookDelivery) error {
+	now := time.Now()
+	statusCode, sendErr := s.send(ctx, subscription, delivery, now)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	succeeded := sendErr == nil
+	delivered := delivery.Status == domain.WebhookDeliverySucceeded
+	if succeeded {
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = sendErr.Error()
+		if len(delivery.LastError) > lastErrorLength {
+			delivery.LastError = delivery.LastError[:lastErrorLength]
+		}
+		switch {
+		case delivered:
+			// A failed redelivery of a delivered event is not retried
+		case delivery.Attempts >= s.policy.MaxAttempts:
+			delivery.Status = domain.WebhookDeliveryFailed
+		default:
+			delivery.Status = domain.WebhookDeliveryPending
+			delivery.NextAttemptAt = now.Add(s.policy.backoff(delivery.Attempts))
+		}
+	}
+
+	// The attempt was made, so it is recorded even if ctx has been canceled
+	// since, e.g. by a shutdown or by the client of a redelivery going away
+	ctx = util.WithoutCancel(ctx)
+	if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+
+	updated, err := s.repo.RecordAttempt(ctx, subscription.ID, succeeded, s.policy.DisableAfter, now)
+	if err != nil {
+		return err
+	}
+	if updated.DisabledAt != nil && updated.DisabledAt.Equal(now) {
+		logrus.Warnf("disabled webhook %d of user %d after %d failed deliveries in a row", updated.ID, updated.UserID, updated.ConsecutiveFailures)
+	}
+	return nil
+}
+
+// send posts the delivery's body, signed with the subscription's secret. Only
+// 2xx responses count as delivered.
+func (s *WebhookService) send(ctx context.Context, subscription *domain.WebhookSubscription, delivery *domain.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "quick-webhooks/1.0")
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(subscription.Secret, now, body))
+	req.Header.Set(webhook.EventHeader, delivery.EventType)
+	req.Header.Set(webhook.DeliveryHeader, strconv.FormatUint(delivery.ID, 10))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little, so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// eventUsers returns the users an event concerns: the owners of the wallets it
+// mentions, or the user it is about.
+func (s *WebhookService) eventUsers(ctx context.Context, event *domain.OutboxEvent) ([]uint64, error) {
+	var refs struct {
+		WalletID     uint64 `json:"wallet_id"`
+		FromWalletID uint64 `json:"from_wallet_id"`
+		ToWalletID   uint64 `json:"to_wallet_id"`
+		UserID       uint64 `json:"user_id"`
+	}
+	if err := json.Unmarshal([]byte(event.Payload), &refs); err != nil {
+		return nil, err
+	}
+
+	seen := map[uint64]bool{}
+	var userIDs []uint64
+	add := func(userID uint64) {
+		if userID != 0 && !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	add(refs.UserID)
+	for _, walletID := range []uint64{refs.WalletID, refs.FromWalletID, refs.ToWalletID} {
+		if walletID == 0 {
+			continue
+		}
+		wallet, err := s.walletRepo.GetWallet(ctx, walletID)
+		if err != nil {
+			return nil, err
+		}
+		add(wallet.OwnerID)
+	}
+	return userIDs, nil
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(rawURL) > 2048 {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// joinEventTypes validates the event types and stores them comma separated.
+func joinEventTypes(eventTypes []string) (string, error) {
+	if len(eventTypes) == 0 {
+		return "", ErrInvalidEventTypes
+	}
+
+	seen := map[string]bool{}
+	var events []string
+	for _, t := range eventTypes {
+		if !webhookEventTypes[t] {
+			return "", ErrInvalidEventTypes
+		}
+		if !seen[t] {
+			seen[t] = true
+			events = append(events, t)
+		}
+	}
+	return strings.Join(events, ","), nil
+}
@@ -0,0 +1,313 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mohammadrabetian/quick/domain"
+	"github.com/mohammadrabetian/quick/outbox"
+	"github.com/mohammadrabetian/quick/pkg/webhook"
+	"github.com/mohammadrabetian/quick/repository"
+	"github.com/mohammadrabetian/quick/service"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// receivedWebhook is a request the test receiver got
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver is an endpoint which answers with status and remembers what
+// it received.
+type webhookReceiver struct {
+	*httptest.Server
+	status   atomic.Int32
+	mu       sync.Mutex
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+
+	receiver := &webhookReceiver{}
+	receiver.status.Store(int32(status))
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.received = append(receiver.received, receivedWebhook{header: r.Header.Clone(), body: body})
+		receiver.mu.Unlock()
+		w.WriteHeader(int(receiver.status.Load()))
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) requests() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.received...)
+}
+
+// newTestWebhookService returns a WebhookService and a relay which publishes
+// the outbox to it.
+func newTestWebhookService(t *testing.T, db *gorm.DB, policy service.RetryPolicy) (*service.WebhookService, *outbox.Relay) {
+	t.Helper()
+
+	cache := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cache.Close() })
+
+	svc := service.NewWebhookService(
+		repository.NewWebhookMySQLRepository(db),
+		repository.NewWalletMySQLRepository(db, cache),
+		webhook.NewClient(time.Second, true),
+		policy,
+	)
+	return svc, outbox.NewRelay(repository.NewOutboxMySQLRepository(db, cache), svc, 10, 3)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc := newTestWalletService(t, db)
+	webhookSvc, relay := newTestWebhookService(t, db, service.RetryPolicy{})
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	subscription, err := webhookSvc.CreateSubscription(context.Background(), 1, receiver.URL, "", []string{domain.EventWalletCredited})
+	require.NoError(t, err)
+	assert.NotEmpty(t, subscription.Secret)
+
+	// Neither of these get the credit: one is for other events, the other of another user
+	_, err = webhookSvc.CreateSubscription(context.Background(), 1, receiver.URL, "", []string{domain.EventTransferCompleted})
+	require.NoError(t, err)
+	_, err = webhookSvc.CreateSubscription(context.Background(), 2, receiver.URL, "", []string{domain.EventWalletCredited})
+	require.NoError(t, err)
+
+	require.NoError(t, walletSvc.CreditWallet(context.Background(), 1, decimal.NewFromInt(100), 1))
+
+	published, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	// Publishing again queues no duplicates
+	var event domain.OutboxEvent
+	require.NoError(t, db.First(&event).Error)
+	require.NoError(t, webhookSvc.Publish(context.Background(), &event))
+
+	attempted, err := webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	requests := receiver.requests()
+	require.Len(t, requests, 1)
+	request := requests[0]
+	assert.Equal(t, domain.EventWalletCredited, request.header.Get(webhook.EventHeader))
+
+	timestamp, err := strconv.ParseInt(request.header.Get(webhook.TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.True(t, webhook.Verify(subscription.Secret, time.Unix(timestamp, 0), request.body, request.header.Get(webhook.SignatureHeader)))
+
+	var body struct {
+		ID   uint64              `json:"id"`
+		Type string              `json:"type"`
+		Data service.WalletEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(request.body, &body))
+	assert.Equal(t, event.ID, body.ID)
+	assert.Equal(t, domain.EventWalletCredited, body.Type)
+	assert.Equal(t, uint64(1), body.Data.WalletID)
+	assert.True(t, body.Data.Amount.Equal(decimal.NewFromInt(100)), "amount is %s", body.Data.Amount)
+
+	deliveries, total, err := webhookSvc.ListDeliveries(context.Background(), 1, subscription.ID, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].LastStatusCode)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+	assert.Equal(t, strconv.FormatUint(deliveries[0].ID, 10), request.header.Get(webhook.DeliveryHeader))
+
+	// Nothing is due anymore
+	attempted, err = webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+}
+
+func TestWebhookRetriesAndDisabling(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc := newTestWalletService(t, db)
+	webhookSvc, relay := newTestWebhookService(t, db, service.RetryPolicy{
+		MaxAttempts:  5,
+		BackoffBase:  time.Minute,
+		BackoffMax:   time.Hour,
+		DisableAfter: 2,
+	})
+	createTestUsers(t, db, 2)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	subscription, err := webhookSvc.CreateSubscription(context.Background(), 1, receiver.URL, "0123456789abcdef", []string{domain.EventWalletCredited})
+	require.NoError(t, err)
+
+	require.NoError(t, walletSvc.CreditWallet(context.Background(), 1, decimal.NewFromInt(10), 1))
+	require.NoError(t, walletSvc.CreditWallet(context.Background(), 1, decimal.NewFromInt(20), 1))
+	_, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+
+	before := time.Now()
+	attempted, err := webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempted)
+
+	deliveries, _, err := webhookSvc.ListDeliveries(context.Background(), 1, subscription.ID, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Equal(t, domain.WebhookDeliveryPending, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+		assert.NotEmpty(t, delivery.LastError)
+		// The first retry waits between half and all of the base backoff
+		assert.True(t, delivery.NextAttemptAt.After(before.Add(30*time.Second-time.Second)), "next attempt at %s", delivery.NextAttemptAt)
+		assert.True(t, delivery.NextAttemptAt.Before(time.Now().Add(time.Minute+time.Second)), "next attempt at %s", delivery.NextAttemptAt)
+	}
+
+	// Two failures in a row disabled the endpoint
+	subscription, err = webhookSvc.GetSubscription(context.Background(), 1, subscription.ID)
+	require.NoError(t, err)
+	assert.False(t, subscription.Active)
+	assert.NotNil(t, subscription.DisabledAt)
+	assert.Equal(t, 2, subscription.ConsecutiveFailures)
+
+	// Deliveries of disabled endpoints are not sent, even when due
+	require.NoError(t, db.Model(&domain.WebhookDelivery{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+	attempted, err = webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+
+	// The endpoint is fixed; a manual redelivery works while it is disabled
+	receiver.status.Store(http.StatusNoContent)
+	delivery, err := webhookSvc.Redeliver(context.Background(), 1, subscription.ID, deliveries[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.WebhookDeliverySucceeded, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.LastStatusCode)
+
+	// A failed redelivery does not make a delivered event pending again
+	receiver.status.Store(http.StatusInternalServerError)
+	delivery, err = webhookSvc.Redeliver(context.Background(), 1, subscription.ID, deliveries[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.WebhookDeliverySucceeded, delivery.Status)
+	assert.NotNil(t, delivery.DeliveredAt)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+	receiver.status.Store(http.StatusNoContent)
+
+	// Activating it again sends the rest
+	active := true
+	subscription, err = webhookSvc.UpdateSubscription(context.Background(), 1, subscription.ID, service.WebhookUpdate{Active: &active})
+	require.NoError(t, err)
+	assert.True(t, subscription.Active)
+	assert.Nil(t, subscription.DisabledAt)
+	assert.Zero(t, subscription.ConsecutiveFailures)
+
+	attempted, err = webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	assert.Len(t, receiver.requests(), 5)
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	db := newTestDB(t)
+	walletSvc := newTestWalletService(t, db)
+	webhookSvc, relay := newTestWebhookService(t, db, service.RetryPolicy{MaxAttempts: 2, DisableAfter: 10})
+	createTestUsers(t, db, 1)
+	require.NoError(t, db.Create(&domain.Wallet{ID: 1, Balance: decimal.Zero, Currency: "EUR", OwnerID: 1}).Error)
+
+	receiver := newWebhookReceiver(t, http.StatusBadGateway)
+	subscription, err := webhookSvc.CreateSubscription(context.Background(), 1, receiver.URL, "", []string{domain.EventWalletCredited})
+	require.NoError(t, err)
+
+	require.NoError(t, walletSvc.CreditWallet(context.Background(), 1, decimal.NewFromInt(10), 1))
+	_, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Model(&domain.WebhookDelivery{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+		attempted, err := webhookSvc.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, attempted)
+	}
+
+	deliveries, _, err := webhookSvc.ListDeliveries(context.Background(), 1, subscription.ID, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+
+	require.NoError(t, db.Model(&domain.WebhookDelivery{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+	attempted, err := webhookSvc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, attempted)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	db := newTestDB(t)
+	webhookSvc, _ := newTestWebhookService(t, db, service.RetryPolicy{})
+	createTestUsers(t, db, 2)
+
+	_, err := webhookSvc.CreateSubscription(context.Background(), 1, "ftp://example.com/hook", "", []string{domain.EventWalletCredited})
+	assert.ErrorIs(t, err, service.ErrInvalidWebhookURL)
+	_, err = webhookSvc.CreateSubscription(context.Background(), 1, "/hook", "", []string{domain.EventWalletCredited})
+	assert.ErrorIs(t, err, service.ErrInvalidWebhookURL)
+	_, err = webhookSvc.CreateSubscription(context.Background(), 1, "https://example.com/hook", "", nil)
+	assert.ErrorIs(t, err, service.ErrInvalidEventTypes)
+	_, err = webhookSvc.CreateSubscription(context.Background(), 1, "https://example.com/hook", "", []string{"wallet.exploded"})
+	assert.ErrorIs(t, err, service.ErrInvalidEventTypes)
+	_, err = webhookSvc.CreateSubscription(context.Background(), 1, "https://example.com/hook", "short", []string{domain.EventWalletCredited})
+	assert.ErrorIs(t, err, service.ErrWeakWebhookSecret)
+
+	subscription, err := webhookSvc.CreateSubscription(context.Background(), 1, "https://example.com/hook", "", []string{domain.EventWalletCredited, domain.EventWalletDebited, domain.EventWalletCredited})
+	require.NoError(t, err)
+	assert.Equal(t, []string{domain.EventWalletCredited, domain.EventWalletDebited}, subscription.Events())
+
+	url := "https://example.com/other"
+	updated, err := webhookSvc.UpdateSubscription(context.Background(), 1, subscription.ID, service.WebhookUpdate{URL: &url, EventTypes: []string{domain.EventUserLoggedIn}})
+	require.NoError(t, err)
+	assert.Equal(t, url, updated.URL)
+	assert.True(t, updated.Subscribes(domain.EventUserLoggedIn))
+	assert.False(t, updated.Subscribes(domain.EventWalletCredited))
+
+	// Other users cannot see or touch it
+	_, err = webhookSvc.GetSubscription(context.Background(), 2, subscription.ID)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+	_, err = webhookSvc.UpdateSubscription(context.Background(), 2, subscription.ID, service.WebhookUpdate{URL: &url})
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+	_, _, err = webhookSvc.ListDeliveries(context.Background(), 2, subscription.ID, 1, 20)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+	_, err = webhookSvc.Redeliver(context.Background(), 2, subscription.ID, 1)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+	assert.ErrorIs(t, webhookSvc.DeleteSubscription(context.Background(), 2, subscription.ID), repository.ErrWebhookNotFound)
+
+	subscriptions, err := webhookSvc.ListSubscriptions(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+
+	require.NoError(t, webhookSvc.DeleteSubscription(context.Background(), 1, subscription.ID))
+	_, err = webhookSvc.GetSubscription(context.Background(), 1, subscription.ID)
+	assert.ErrorIs(t, err, repository.ErrWebhookNotFound)
+}
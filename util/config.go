@@ -2,13 +2,29 @@ package util
 
 import (
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 type HTTPServerConfig struct {
-	Address string `mapstructure:"address"`
+	Address           string        `mapstructure:"address"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	// How long /readyz reports not ready before the listeners stop, so load
+	// balancers stop sending new requests first
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// Deadline for in-flight requests and workers to finish on shutdown
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+type GRPCServerConfig struct {
+	Address string `mapstructure:"address"` // empty disables the gRPC API
+	// Lets clients such as grpcurl list the services
+	Reflection bool `mapstructure:"reflection"`
 }
 
 type RedisConfig struct {
@@ -23,6 +39,135 @@ type MySQLConfig struct {
 	Password string `mapstructure:"password"`
 	Port     int32  `mapstructure:"port"`
 	Host     string `mapstructure:"host"`
+	// Delay between connection attempts, doubled after each failure
+	BackoffBase time.Duration `mapstructure:"backoff_base"`
+	BackoffMax  time.Duration `mapstructure:"backoff_max"`
+	// How long commands such as migrate wait for MySQL, the server waits for
+	// it as long as it runs
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+}
+
+// JWTKeyConfig describes a signing key. The secret and the private key are
+// better kept out of the config file: the QUICK_JWT_<ID>_SECRET and
+// QUICK_JWT_<ID>_PRIVATE_KEY environment variables, or else the files named by
+// secret_file and private_key_file, take precedence over them.
+type JWTKeyConfig struct {
+	ID        string `mapstructure:"id"`
+	Algorithm string `mapstructure:"algorithm"` // HS256 or EdDSA
+	// HS256 shared secret
+	Secret     string `mapstructure:"secret"`
+	SecretFile string `mapstructure:"secret_file"`
+	// EdDSA keys, base64 encoded. Retired keys only need the public key.
+	PrivateKey     string `mapstructure:"private_key"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKey      string `mapstructure:"public_key"`
+}
+
+type JWTConfig struct {
+	AccessTTL    time.Duration  `mapstructure:"access_ttl"`
+	RefreshTTL   time.Duration  `mapstructure:"refresh_ttl"`
+	SigningKeyID string         `mapstructure:"signing_key_id"`
+	Keys         []JWTKeyConfig `mapstructure:"keys"`
+}
+
+type AuthConfig struct {
+	Mode       string        `mapstructure:"mode"` // opaque or jwt
+	SessionTTL time.Duration `mapstructure:"session_ttl"`
+	JWT        JWTConfig     `mapstructure:"jwt"`
+	// Usernames allowed to use the admin endpoints, e.g. /debug/status
+	Admins []string `mapstructure:"admins"`
+	// How often expired and revoked sessions are deleted
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+type WalletConfig struct {
+	// Currency of wallets opened without one, and of wallets created before
+	// wallets had a currency.
+	DefaultCurrency string `mapstructure:"default_currency"`
+}
+
+type FXRateConfig struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+	Rate string `mapstructure:"rate"` // units of To for one unit of From
+}
+
+type FXHTTPConfig struct {
+	URL     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type FXConfig struct {
+	Provider string `mapstructure:"provider"` // static or http
+	// Fraction of the rate kept as our margin, e.g. 0.005 for half a percent
+	Spread   string        `mapstructure:"spread"`
+	RateTTL  time.Duration `mapstructure:"rate_ttl"`
+	QuoteTTL time.Duration `mapstructure:"quote_ttl"`
+
+	// Rates of the static provider
+	Rates []FXRateConfig `mapstructure:"rates"`
+	HTTP  FXHTTPConfig   `mapstructure:"http"`
+}
+
+type HoldsConfig struct {
+	TTL           time.Duration `mapstructure:"ttl"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+}
+
+type OutboxConfig struct {
+	Sink        string        `mapstructure:"sink"` // redis
+	Stream      string        `mapstructure:"stream"`
+	MaxLen      int64         `mapstructure:"max_len"` // approximate length the stream is trimmed to, 0 keeps everything
+	BatchSize   int           `mapstructure:"batch_size"`
+	Interval    time.Duration `mapstructure:"interval"`
+	MaxAttempts int           `mapstructure:"max_attempts"` // failed attempts after which an event is dead-lettered
+}
+
+type WebhooksConfig struct {
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	BackoffBase  time.Duration `mapstructure:"backoff_base"`
+	BackoffMax   time.Duration `mapstructure:"backoff_max"`
+	DisableAfter int           `mapstructure:"disable_after"` // failed attempts in a row
+	Interval     time.Duration `mapstructure:"interval"`
+	// Lets webhooks reach private and loopback addresses, for development only
+	AllowPrivateURLs bool `mapstructure:"allow_private_urls"`
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+type HealthConfig struct {
+	// Deadline of each dependency check of /readyz and /debug/status
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// TimeoutsConfig bounds the database and Redis work of each wallet and user
+// operation, whatever the deadline of the request is.
+type TimeoutsConfig struct {
+	// Lookups such as balances, listings and authenticating tokens
+	Read time.Duration `mapstructure:"read"`
+	// Operations that write, such as transfers and signing in
+	Write time.Duration `mapstructure:"write"`
+}
+
+type TracingConfig struct {
+	Exporter string `mapstructure:"exporter"` // otlp, stdout or none
+	// host:port of the OTLP gRPC collector
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"` // plaintext instead of TLS
+	// Share of the traces started here that are recorded, from 0 to 1.
+	// Requests that arrive with a sampled traceparent are always recorded.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+type SeedConfig struct {
+	// Loads the fixtures outside of the development and testing environments
+	Enabled bool `mapstructure:"enabled"`
+	// YAML or JSON files, relative to the working directory
+	Fixtures []string `mapstructure:"fixtures"`
 }
 
 // The values are read by viper from a config file or environment variable.
@@ -30,8 +175,21 @@ type Config struct {
 	Environment string `mapstructure:"ENVIRONMENT"`
 
 	HTTPServer HTTPServerConfig `mapstructure:"http_server"`
+	GRPCServer GRPCServerConfig `mapstructure:"grpc_server"`
 	Redis      RedisConfig      `mapstructure:"redis"`
 	MySQL      MySQLConfig      `mapstructure:"mysql"`
+
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Wallet      WalletConfig      `mapstructure:"wallet"`
+	FX          FXConfig          `mapstructure:"fx"`
+	Holds       HoldsConfig       `mapstructure:"holds"`
+	Outbox      OutboxConfig      `mapstructure:"outbox"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Seed        SeedConfig        `mapstructure:"seed"`
+	Health      HealthConfig      `mapstructure:"health"`
+	Timeouts    TimeoutsConfig    `mapstructure:"timeouts"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
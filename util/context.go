@@ -0,0 +1,33 @@
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// WithoutCancel returns a context that keeps the values of parent, such as the
+// trace span, but is never canceled and has no deadline. It is
+// context.WithoutCancel of Go 1.21, which the module does not require yet.
+func WithoutCancel(parent context.Context) context.Context {
+	return withoutCancelCtx{parent}
+}
+
+type withoutCancelCtx struct {
+	parent context.Context
+}
+
+func (withoutCancelCtx) Deadline() (deadline time.Time, ok bool) {
+	return time.Time{}, false
+}
+
+func (withoutCancelCtx) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancelCtx) Err() error {
+	return nil
+}
+
+func (c withoutCancelCtx) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}